@@ -1,18 +1,26 @@
 package agents
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/internal/tracing"
 	"github.com/natexcvi/go-llm/memory"
 	toolsPkg "github.com/natexcvi/go-llm/tools"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/maps"
 )
 
@@ -25,11 +33,20 @@ const (
 	EndMarker       = "<END>"
 	MessageFormat   = "%s: %s<END>"
 	MessagePrefix   = "%s: "
+	// The instruction that asks the engine to
+	// continue a response that was cut off.
+	ContinuationPrompt = "Your response was cut off. Continue it exactly where it stopped, without repeating any of it."
+	// The instruction that asks the engine for the final
+	// answer when it is structured by the answer schema.
+	StructuredAnswerPrompt = "Now give your final answer as JSON that follows the required schema."
+	// Follows StructuredAnswerPrompt for engines that
+	// cannot constrain their responses to the schema.
+	StructuredAnswerSchemaFormat = "The schema is: %s"
 )
 
 var (
 	actionRegex              = regexp.MustCompile(`^(?P<tool>.*?)\((?P<args>[\s\S]*)\)`)
-	operationRegex           = regexp.MustCompile(`(?P<code>[A-Za-z]+):\s*(?P<content>[\s\S]*)(?:<END>)`)
+	operationRegex           = regexp.MustCompile(`(?P<code>[A-Za-z]+):\s*(?P<content>[\s\S]*?)(?:<END>)`)
 	operationRegexWithoutEnd = regexp.MustCompile(`(?P<code>[A-Za-z]+):\s*(?P<content>[\s\S]*)`)
 )
 
@@ -42,6 +59,26 @@ type Agent[T any, S any] interface {
 	Run(input T) (S, error)
 }
 
+// An Agent whose runs can be cancelled
+// through a context.
+type AgentWithContext[T any, S any] interface {
+	Agent[T, S]
+	RunContext(ctx context.Context, input T) (S, error)
+}
+
+// RunContext runs the agent, passing ctx along if the
+// agent supports it. Agents that are not context aware
+// are only checked for cancellation before they run.
+func RunContext[T any, S any](ctx context.Context, agent Agent[T, S], input T) (output S, err error) {
+	if agent, ok := agent.(AgentWithContext[T, S]); ok {
+		return agent.RunContext(ctx, input)
+	}
+	if err := ctx.Err(); err != nil {
+		return output, err
+	}
+	return agent.Run(input)
+}
+
 type ChainAgentThought struct {
 	Content string
 }
@@ -62,10 +99,26 @@ func ParseChainAgentThought(thought *engines.ChatMessage) *ChainAgentThought {
 type ChainAgentAction struct {
 	Tool toolsPkg.Tool
 	Args json.RawMessage
+	// The ID of the native tool call
+	// requesting the action, if any.
+	ID string
 }
 
 func (a *ChainAgentAction) Encode(targetEngine engines.LLM) *engines.ChatMessage {
-	if _, ok := targetEngine.(engines.LLMWithFunctionCalls); ok {
+	if engines.SupportsFunctionCalls(targetEngine) && a.ID != "" {
+		return &engines.ChatMessage{
+			Role: engines.ConvRoleAssistant,
+			ToolCalls: []*engines.ToolCall{{
+				ID:   a.ID,
+				Type: "function",
+				Function: engines.FunctionCall{
+					Name: a.Tool.Name(),
+					Args: string(a.Args),
+				},
+			}},
+		}
+	}
+	if engines.SupportsFunctionCalls(targetEngine) {
 		return &engines.ChatMessage{
 			Role: engines.ConvRoleAssistant,
 			FunctionCall: &engines.FunctionCall{
@@ -81,23 +134,50 @@ func (a *ChainAgentAction) Encode(targetEngine engines.LLM) *engines.ChatMessage
 	}
 }
 
-func (a *ChainAgent[T, S]) parseNativeFunctionCall(msg *engines.ChatMessage) (*ChainAgentAction, error) {
-	if msg.FunctionCall == nil {
-		return nil, errors.New("no function call found")
-	}
-	tool, ok := a.Tools[msg.FunctionCall.Name]
+// toolNames returns the names of the agent's
+// tools in alphabetical order.
+func (a *ChainAgent[T, S]) toolNames() []string {
+	names := maps.Keys(a.Tools)
+	sort.Strings(names)
+	return names
+}
+
+func (a *ChainAgent[T, S]) parseToolCall(ctx context.Context, call *engines.ToolCall) (*ChainAgentAction, error) {
+	tool, ok := a.Tools[call.Function.Name]
 	if !ok {
-		return nil, fmt.Errorf("tool %q not found. Available tools: %s", msg.FunctionCall.Name, strings.Join(maps.Keys(a.Tools), ", "))
+		return nil, fmt.Errorf("tool %q not found. Available tools: %s", call.Function.Name, strings.Join(a.toolNames(), ", "))
+	}
+	args, err := a.preprocessArgs(ctx, tool, []byte(call.Function.Args))
+	if err != nil {
+		return nil, err
 	}
 	return &ChainAgentAction{
 		Tool: tool,
-		Args: []byte(msg.FunctionCall.Args),
+		Args: args,
+		ID:   call.ID,
 	}, nil
 }
 
+// preprocessArgs runs the arguments to the tool
+// through the ActionArgPreprocessors.
+func (a *ChainAgent[T, S]) preprocessArgs(ctx context.Context, tool toolsPkg.Tool, args json.RawMessage) (json.RawMessage, error) {
+	for _, processor := range a.ActionArgPreprocessors {
+		var err error
+		args, err = toolsPkg.ProcessForTool(ctx, processor, tool, args)
+		if err != nil {
+			return nil, fmt.Errorf("error while preprocessing action args: %s", err.Error())
+		}
+	}
+	return args, nil
+}
+
 func (a *ChainAgent[T, S]) ParseChainAgentAction(msg *engines.ChatMessage) (*ChainAgentAction, error) {
-	if msg.FunctionCall != nil {
-		return a.parseNativeFunctionCall(msg)
+	return a.parseChainAgentAction(context.Background(), msg)
+}
+
+func (a *ChainAgent[T, S]) parseChainAgentAction(ctx context.Context, msg *engines.ChatMessage) (*ChainAgentAction, error) {
+	if calls := msg.Calls(); len(calls) > 0 {
+		return a.parseToolCall(ctx, calls[0])
 	}
 	matches := actionRegex.FindStringSubmatch(msg.Text)
 	if len(matches) != 3 {
@@ -108,16 +188,12 @@ func (a *ChainAgent[T, S]) ParseChainAgentAction(msg *engines.ChatMessage) (*Cha
 
 	tool, ok := a.Tools[toolName]
 	if !ok {
-		return nil, fmt.Errorf("tool %q not found. Available tools: %s", toolName, strings.Join(maps.Keys(a.Tools), ", "))
+		return nil, fmt.Errorf("tool %q not found. Available tools: %s", toolName, strings.Join(a.toolNames(), ", "))
 	}
 
-	jsonArgs := json.RawMessage(toolArgs)
-	for _, processor := range a.ActionArgPreprocessors {
-		var err error
-		jsonArgs, err = processor.Process(jsonArgs)
-		if err != nil {
-			return nil, fmt.Errorf("error while preprocessing action args: %s", err.Error())
-		}
+	jsonArgs, err := a.preprocessArgs(ctx, tool, json.RawMessage(toolArgs))
+	if err != nil {
+		return nil, err
 	}
 
 	return &ChainAgentAction{
@@ -151,7 +227,22 @@ type ChainAgent[T Representable, S Representable] struct {
 	Memory                 memory.Memory
 	ActionConfirmation     func(action *ChainAgentAction) bool
 	ActionArgPreprocessors []toolsPkg.PreprocessingTool
-	nativeFunctionSpecs    []engines.FunctionSpecs
+	StreamHandler          func(chunk *ChainAgentStreamChunk)
+	// The maximum number of actions from a single
+	// response that are executed concurrently.
+	// Actions run sequentially if it is at most 1.
+	MaxParallelActions int
+	Observers          []Observer
+	// The budget that the requests of each
+	// run are charged to, if any.
+	Budget *engines.Budget
+	// The maximum number of times a response cut off
+	// by the engine's output limit is continued.
+	MaxContinuations int
+	// The JSON schema of the answer, if the final answer is
+	// given in a request constrained to it.
+	AnswerSchema        *engines.ParameterSpecs
+	nativeFunctionSpecs []engines.FunctionSpecs
 }
 
 type ChainAgentMessage interface {
@@ -161,10 +252,23 @@ type ChainAgentMessage interface {
 type ChainAgentError struct {
 	Content  string
 	ToolName string
+	// The ID of the native tool call
+	// the error replies to, if any.
+	ToolCallID string
+	// How long the failed tool execution took.
+	Latency time.Duration
 }
 
 func (a *ChainAgentError) Encode(targetEngine engines.LLM) *engines.ChatMessage {
-	if _, ok := targetEngine.(engines.LLMWithFunctionCalls); ok {
+	if engines.SupportsFunctionCalls(targetEngine) && a.ToolCallID != "" {
+		return &engines.ChatMessage{
+			Role:       engines.ConvRoleTool,
+			ToolCallID: a.ToolCallID,
+			Name:       a.ToolName,
+			Text:       fmt.Sprintf("An error has occured: %s", a.Content),
+		}
+	}
+	if engines.SupportsFunctionCalls(targetEngine) {
 		return &engines.ChatMessage{
 			Role: engines.ConvRoleFunction,
 			Name: a.ToolName,
@@ -180,10 +284,23 @@ func (a *ChainAgentError) Encode(targetEngine engines.LLM) *engines.ChatMessage
 type ChainAgentObservation struct {
 	Content  string
 	ToolName string
+	// The ID of the native tool call the
+	// observation replies to, if any.
+	ToolCallID string
+	// How long the tool execution took.
+	Latency time.Duration
 }
 
 func (a *ChainAgentObservation) Encode(targetEngine engines.LLM) *engines.ChatMessage {
-	if _, ok := targetEngine.(engines.LLMWithFunctionCalls); ok {
+	if engines.SupportsFunctionCalls(targetEngine) && a.ToolCallID != "" {
+		return &engines.ChatMessage{
+			Role:       engines.ConvRoleTool,
+			ToolCallID: a.ToolCallID,
+			Name:       a.ToolName,
+			Text:       a.Content,
+		}
+	}
+	if engines.SupportsFunctionCalls(targetEngine) {
 		return &engines.ChatMessage{
 			Role: engines.ConvRoleFunction,
 			Name: a.ToolName,
@@ -196,43 +313,156 @@ func (a *ChainAgentObservation) Encode(targetEngine engines.LLM) *engines.ChatMe
 	}
 }
 
-func (a *ChainAgent[T, S]) executeAction(action *ChainAgentAction) (obs ChainAgentMessage) {
+func (a *ChainAgent[T, S]) executeAction(ctx context.Context, action *ChainAgentAction) (obs ChainAgentMessage) {
+	if obs := a.confirmAction(action); obs != nil {
+		return obs
+	}
+	return a.runAction(ctx, action)
+}
+
+// confirmAction returns an error message if
+// the user declines the action, and nil otherwise.
+func (a *ChainAgent[T, S]) confirmAction(action *ChainAgentAction) ChainAgentMessage {
 	if a.ActionConfirmation != nil && !a.ActionConfirmation(action) {
 		return &ChainAgentError{
-			Content:  "action cancelled by the user",
-			ToolName: action.Tool.Name(),
+			Content:    "action cancelled by the user",
+			ToolName:   action.Tool.Name(),
+			ToolCallID: action.ID,
+		}
+	}
+	return nil
+}
+
+// executeActions executes the actions, running up to
+// MaxParallelActions of them at a time, and returns
+// their results in the order of the actions. Actions
+// are confirmed one by one before any of them runs,
+// and tools that are not concurrency safe run alone.
+func (a *ChainAgent[T, S]) executeActions(ctx context.Context, actions []*ChainAgentAction) []ChainAgentMessage {
+	results := make([]ChainAgentMessage, len(actions))
+	if a.MaxParallelActions <= 1 {
+		for i, action := range actions {
+			a.notify(ctx, func(o Observer) { o.OnAction(ctx, action) })
+			results[i] = a.executeAction(ctx, action)
+			a.notifyResult(ctx, action, results[i])
 		}
+		return results
+	}
+	for i, action := range actions {
+		a.notify(ctx, func(o Observer) { o.OnAction(ctx, action) })
+		results[i] = a.confirmAction(action)
+	}
+	defer func() {
+		for i, action := range actions {
+			a.notifyResult(ctx, action, results[i])
+		}
+	}()
+	var exclusive sync.RWMutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, a.MaxParallelActions)
+	for i, action := range actions {
+		if results[i] != nil {
+			continue
+		}
+		i, action := i, action
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			if toolsPkg.IsConcurrencySafe(action.Tool) {
+				exclusive.RLock()
+				defer exclusive.RUnlock()
+			} else {
+				exclusive.Lock()
+				defer exclusive.Unlock()
+			}
+			results[i] = a.runAction(ctx, action)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (a *ChainAgent[T, S]) notifyResult(ctx context.Context, action *ChainAgentAction, result ChainAgentMessage) {
+	switch result := result.(type) {
+	case *ChainAgentObservation:
+		a.notify(ctx, func(o Observer) { o.OnObservation(ctx, action, result) })
+	case *ChainAgentError:
+		a.notify(ctx, func(o Observer) { o.OnError(ctx, action, result) })
 	}
-	actionOutput, err := action.Tool.Execute(action.Args)
+}
+
+// errorMessage reports an error that is not caused by
+// an action, and returns the message informing the
+// agent about it.
+func (a *ChainAgent[T, S]) errorMessage(ctx context.Context, err error) *engines.ChatMessage {
+	a.notify(ctx, func(o Observer) { o.OnError(ctx, nil, &ChainAgentError{Content: err.Error()}) })
+	return &engines.ChatMessage{
+		Role: engines.ConvRoleSystem,
+		Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
+	}
+}
+
+func (a *ChainAgent[T, S]) runAction(ctx context.Context, action *ChainAgentAction) ChainAgentMessage {
+	start := time.Now()
+	actionOutput, err := toolsPkg.ExecuteContext(ctx, action.Tool, action.Args)
 	if err != nil {
 		return &ChainAgentError{
-			Content:  err.Error(),
-			ToolName: action.Tool.Name(),
+			Content:    err.Error(),
+			ToolName:   action.Tool.Name(),
+			ToolCallID: action.ID,
+			Latency:    time.Since(start),
 		}
 	}
 	return &ChainAgentObservation{
-		Content:  string(actionOutput),
-		ToolName: action.Tool.Name(),
+		Content:    string(actionOutput),
+		ToolName:   action.Tool.Name(),
+		ToolCallID: action.ID,
+		Latency:    time.Since(start),
 	}
 }
 
-func (a *ChainAgent[T, S]) processFunctionCallMessage(response *engines.ChatMessage) (nextMessages []*engines.ChatMessage, answer *ChainAgentAnswer[S]) {
-	action, err := a.parseNativeFunctionCall(response)
-	if err != nil {
-		nextMessages = append(nextMessages, &engines.ChatMessage{
-			Role: engines.ConvRoleFunction,
-			Name: response.FunctionCall.Name,
-			Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
-		})
-		return
+// processFunctionCallMessage executes each tool call
+// requested by the response, replying to every call.
+func (a *ChainAgent[T, S]) processFunctionCallMessage(ctx context.Context, response *engines.ChatMessage) (nextMessages []*engines.ChatMessage, answer *ChainAgentAnswer[S]) {
+	var actions []*ChainAgentAction
+	var slots []int
+	for _, call := range response.Calls() {
+		action, err := a.parseToolCall(ctx, call)
+		if err != nil {
+			a.notify(ctx, func(o Observer) {
+				o.OnError(ctx, nil, &ChainAgentError{
+					Content:    err.Error(),
+					ToolName:   call.Function.Name,
+					ToolCallID: call.ID,
+				})
+			})
+			reply := &engines.ChatMessage{
+				Role: engines.ConvRoleFunction,
+				Name: call.Function.Name,
+				Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
+			}
+			if call.ID != "" {
+				reply.Role = engines.ConvRoleTool
+				reply.ToolCallID = call.ID
+			}
+			nextMessages = append(nextMessages, reply)
+			continue
+		}
+		actions = append(actions, action)
+		slots = append(slots, len(nextMessages))
+		nextMessages = append(nextMessages, nil)
+	}
+	for i, obs := range a.executeActions(ctx, actions) {
+		nextMessages[slots[i]] = obs.Encode(a.Engine)
 	}
-	nextMessages = append(nextMessages, a.executeAction(action).Encode(a.Engine))
 	return
 }
 
-func (a *ChainAgent[T, S]) parseResponse(response *engines.ChatMessage) (nextMessages []*engines.ChatMessage, answer *ChainAgentAnswer[S]) {
-	if response.FunctionCall != nil {
-		return a.processFunctionCallMessage(response)
+func (a *ChainAgent[T, S]) parseResponse(ctx context.Context, response *engines.ChatMessage) (nextMessages []*engines.ChatMessage, answer *ChainAgentAnswer[S]) {
+	if len(response.Calls()) > 0 {
+		return a.processFunctionCallMessage(ctx, response)
 	}
 	var exp *regexp.Regexp
 	var ops [][]string
@@ -244,56 +474,120 @@ func (a *ChainAgent[T, S]) parseResponse(response *engines.ChatMessage) (nextMes
 		}
 	}
 	if len(ops) == 0 {
-		return // consider the message a thought anyway
+		// consider the message a thought anyway
+		a.notify(ctx, func(o Observer) { o.OnThought(ctx, ParseChainAgentThought(response)) })
+		return
 	}
+	// in parallel mode, actions are collected and executed
+	// together once the whole response has been parsed
+	var pendingActions []*ChainAgentAction
+	var pendingSlots []int
+	executePending := func() {
+		for i, obs := range a.executeActions(ctx, pendingActions) {
+			nextMessages[pendingSlots[i]] = obs.Encode(a.Engine)
+		}
+	}
+	defer executePending()
 	for _, op := range ops {
 		opCode := op[exp.SubexpIndex("code")]
 		opContent := op[exp.SubexpIndex("content")]
 		switch opCode {
-		case ThoughtCode:
-			break
 		case ActionCode:
-			action, err := a.ParseChainAgentAction(&engines.ChatMessage{
+			action, err := a.parseChainAgentAction(ctx, &engines.ChatMessage{
 				Role: engines.ConvRoleAssistant,
 				Text: opContent,
 			})
 			if err != nil {
-				nextMessages = append(nextMessages, &engines.ChatMessage{
-					Role: engines.ConvRoleSystem,
-					Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
-				})
+				nextMessages = append(nextMessages, a.errorMessage(ctx, err))
+				break
+			}
+			if a.MaxParallelActions > 1 {
+				pendingActions = append(pendingActions, action)
+				pendingSlots = append(pendingSlots, len(nextMessages))
+				nextMessages = append(nextMessages, nil)
 				break
 			}
-			obs := a.executeAction(action)
+			obs := a.executeActions(ctx, []*ChainAgentAction{action})[0]
 			nextMessages = append(nextMessages, obs.Encode(a.Engine))
 		case AnswerCode:
-			answer, err := a.parseChainAgentAnswer(&engines.ChatMessage{
-				Role: engines.ConvRoleAssistant,
-				Text: opContent,
-			})
+			answer, err := a.parseAnswer(ctx, opContent)
 			if err != nil {
-				nextMessages = append(nextMessages, &engines.ChatMessage{
-					Role: engines.ConvRoleSystem,
-					Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
-				})
+				nextMessages = append(nextMessages, a.errorMessage(ctx, err))
 				break
 			}
 			err = a.validateAnswer(answer.Content)
 			if err != nil {
-				nextMessages = append(nextMessages, &engines.ChatMessage{
-					Role: engines.ConvRoleSystem,
-					Text: fmt.Sprintf(MessageFormat, ErrorCode, err.Error()),
-				})
+				nextMessages = append(nextMessages, a.errorMessage(ctx, err))
 				break
 			}
+			a.notify(ctx, func(o Observer) { o.OnAnswer(ctx, Representable(answer.Content)) })
 			return nextMessages, answer
 		default:
-			break // consider the message a thought
+			// consider anything else a thought
+			thought := &ChainAgentThought{Content: opContent}
+			a.notify(ctx, func(o Observer) { o.OnThought(ctx, thought) })
 		}
 	}
 	return nextMessages, nil
 }
 
+func (a *ChainAgent[T, S]) parseAnswer(ctx context.Context, content string) (*ChainAgentAnswer[S], error) {
+	if a.AnswerSchema != nil {
+		return a.structuredAnswer(ctx)
+	}
+	return a.parseChainAgentAnswer(&engines.ChatMessage{
+		Role: engines.ConvRoleAssistant,
+		Text: content,
+	})
+}
+
+// structuredAnswer asks the engine for the final answer
+// in a request whose response follows the answer schema.
+func (a *ChainAgent[T, S]) structuredAnswer(ctx context.Context) (*ChainAgentAnswer[S], error) {
+	instruction := StructuredAnswerPrompt
+	if !engines.SupportsResponseFormat(a.Engine) {
+		schema, err := json.Marshal(a.AnswerSchema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode answer schema: %w", err)
+		}
+		instruction += " " + fmt.Sprintf(StructuredAnswerSchemaFormat, schema)
+	}
+	prompt, err := memory.PromptContext(ctx, a.Memory, &engines.ChatMessage{
+		Role: engines.ConvRoleUser,
+		Text: instruction,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate prompt: %w", err)
+	}
+	a.notify(ctx, func(o Observer) { o.OnPrompt(ctx, prompt) })
+	chatCtx := engines.ContextWithGenerationOptions(
+		engines.ContextWithComponent(ctx, engines.ComponentAgent),
+		engines.GenerationOptions{
+			ResponseFormat: engines.JSONSchemaFormat("answer", a.AnswerSchema, true),
+			ToolChoice:     &engines.ToolChoice{Mode: "none"},
+		},
+	)
+	var response *engines.ChatMessage
+	if engine, ok := a.Engine.(engines.LLMWithFunctionCalls); ok && engines.SupportsFunctionCalls(a.Engine) {
+		// some providers only accept a history with tool
+		// calls along with the tools, which the tool
+		// choice keeps the model from calling
+		response, err = engines.ChatWithFunctionsContext(chatCtx, engine, prompt, a.nativeFunctionSpecs)
+	} else {
+		response, err = engines.ChatContext(chatCtx, a.Engine, prompt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to predict structured answer: %w", err)
+	}
+	a.notify(ctx, func(o Observer) { o.OnResponse(ctx, response) })
+	a.logMessages(response)
+	if err := memory.AddContext(ctx, a.Memory, response); err != nil {
+		return nil, fmt.Errorf("failed to add response to memory: %w", err)
+	}
+	a.notify(ctx, func(o Observer) { o.OnMemoryUpdate(ctx, []*engines.ChatMessage{response}) })
+	return a.parseChainAgentAnswer(response)
+}
+
 func (a *ChainAgent[T, S]) validateAnswer(answer S) error {
 	var answerErr *multierror.Error
 	for _, validator := range a.OutputValidators {
@@ -304,22 +598,124 @@ func (a *ChainAgent[T, S]) validateAnswer(answer S) error {
 
 func (a *ChainAgent[T, S]) logMessages(msg ...*engines.ChatMessage) {
 	for _, m := range msg {
-		if m.FunctionCall != nil {
-			log.Debugf("[%s] [function_call] %s(%s)", m.Role, m.FunctionCall.Name, m.FunctionCall.Args)
+		if calls := m.Calls(); len(calls) > 0 {
+			for _, call := range calls {
+				log.Debugf("[%s] [function_call] %s(%s)", m.Role, call.Function.Name, call.Function.Args)
+			}
 			continue
 		}
 		log.Debugf("[%s] %s", m.Role, m.Text)
 	}
 }
 
-func (a *ChainAgent[T, S]) chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
-	if engine, ok := a.Engine.(engines.LLMWithFunctionCalls); ok {
-		return engine.ChatWithFunctions(prompt, a.nativeFunctionSpecs)
+func (a *ChainAgent[T, S]) chat(ctx context.Context, prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	a.notify(ctx, func(o Observer) { o.OnPrompt(ctx, prompt) })
+	chatCtx := engines.ContextWithComponent(ctx, engines.ComponentAgent)
+	textMode := !engines.SupportsFunctionCalls(a.Engine)
+	if textMode {
+		chatCtx = engines.ContextWithGenerationOptions(chatCtx, engines.GenerationOptions{
+			Stop: a.stopSequences(),
+		})
+	}
+	response, err := a.sendPrompt(chatCtx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < a.MaxContinuations && isCutOff(response); i++ {
+		continuation, err := a.sendPrompt(chatCtx, continuationPrompt(prompt, response))
+		if err != nil {
+			return nil, fmt.Errorf("failed to continue response: %w", err)
+		}
+		response = joinResponses(response, continuation)
+	}
+	if textMode {
+		response = withEndMarker(response)
+	}
+	a.notify(ctx, func(o Observer) { o.OnResponse(ctx, response) })
+	return response, nil
+}
+
+// stopSequences returns the sequences that stop the model
+// after each operation, before it makes up the observation
+// of an action. With parallel actions, the model may request
+// several actions in a response, so it is stopped only at the
+// first observation.
+func (a *ChainAgent[T, S]) stopSequences() []string {
+	if a.MaxParallelActions > 1 {
+		return []string{ObservationCode + ":"}
+	}
+	return []string{EndMarker, ObservationCode + ":"}
+}
+
+// withEndMarker restores the EndMarker that the stop
+// sequences leave out of a response, so that the history
+// shows the model operations in the expected format.
+func withEndMarker(response *engines.ChatMessage) *engines.ChatMessage {
+	text := strings.TrimRightFunc(response.Text, unicode.IsSpace)
+	if response.Metadata == nil || response.Metadata.FinishReason != engines.FinishReasonStop ||
+		text == "" || strings.HasSuffix(text, EndMarker) {
+		return response
+	}
+	marked := *response
+	marked.Text = text + EndMarker
+	return &marked
+}
+
+// isCutOff reports whether the engine stopped generating the
+// text of the response because it reached its output limit.
+// Cut off tool calls are not continued, since their arguments
+// cannot be completed reliably.
+func isCutOff(response *engines.ChatMessage) bool {
+	return response.Metadata != nil &&
+		response.Metadata.FinishReason == engines.FinishReasonLength &&
+		len(response.Calls()) == 0
+}
+
+func continuationPrompt(prompt *engines.ChatPrompt, response *engines.ChatMessage) *engines.ChatPrompt {
+	history := make([]*engines.ChatMessage, 0, len(prompt.History)+2)
+	history = append(history, prompt.History...)
+	history = append(history,
+		&engines.ChatMessage{Role: engines.ConvRoleAssistant, Text: response.Text},
+		&engines.ChatMessage{Role: engines.ConvRoleUser, Text: ContinuationPrompt},
+	)
+	return &engines.ChatPrompt{History: history}
+}
+
+// joinResponses appends the continuation to the response.
+// The metadata of the result adds up the usage and latency
+// of both, and reports the rest as the continuation does.
+func joinResponses(response, continuation *engines.ChatMessage) *engines.ChatMessage {
+	joined := *continuation
+	joined.Role = response.Role
+	joined.Text = response.Text + continuation.Text
+	if response.Metadata != nil && continuation.Metadata != nil {
+		metadata := *continuation.Metadata
+		metadata.Usage.PromptTokens += response.Metadata.Usage.PromptTokens
+		metadata.Usage.CompletionTokens += response.Metadata.Usage.CompletionTokens
+		metadata.Latency += response.Metadata.Latency
+		joined.Metadata = &metadata
+	}
+	return &joined
+}
+
+func (a *ChainAgent[T, S]) sendPrompt(ctx context.Context, prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	if engine, ok := a.Engine.(engines.LLMWithStreaming); ok && a.StreamHandler != nil && engines.SupportsStreaming(a.Engine) {
+		var functions []engines.FunctionSpecs
+		if engines.SupportsFunctionCalls(a.Engine) {
+			functions = a.nativeFunctionSpecs
+		}
+		parser := newStreamParser(a.StreamHandler)
+		response, err := engine.ChatStream(ctx, prompt, functions, parser.write)
+		parser.flush()
+		return response, err
+	}
+	if engine, ok := a.Engine.(engines.LLMWithFunctionCalls); ok && engines.SupportsFunctionCalls(a.Engine) {
+		return engines.ChatWithFunctionsContext(ctx, engine, prompt, a.nativeFunctionSpecs)
 	}
-	return a.Engine.Chat(prompt)
+	return engines.ChatContext(ctx, a.Engine, prompt)
 }
 
-func (a *ChainAgent[T, S]) run(input T) (output S, err error) {
+func (a *ChainAgent[T, S]) run(ctx context.Context, input T) (output S, err error) {
 	var inputErr *multierror.Error
 	for _, validator := range a.InputValidators {
 		inputErr = multierror.Append(inputErr, validator(input))
@@ -328,57 +724,94 @@ func (a *ChainAgent[T, S]) run(input T) (output S, err error) {
 		return output, fmt.Errorf("invalid input: %w", inputErr)
 	}
 	visibleTools := a.Tools
-	if _, ok := a.Engine.(engines.LLMWithFunctionCalls); ok {
+	if engines.SupportsFunctionCalls(a.Engine) {
 		visibleTools = map[string]toolsPkg.Tool{}
 	}
-	taskPrompt := a.Task.Compile(input, visibleTools)
+	taskPrompt, err := a.Task.compile(input, visibleTools)
+	if err != nil {
+		return output, fmt.Errorf("failed to compile task prompt: %w", err)
+	}
 	a.logMessages(taskPrompt.History...)
-	err = a.Memory.AddPrompt(taskPrompt)
+	err = memory.AddPromptContext(ctx, a.Memory, taskPrompt)
 	if err != nil {
 		return output, fmt.Errorf("failed to add prompt to memory: %w", err)
 	}
-	response, err := a.chat(taskPrompt)
+	a.notify(ctx, func(o Observer) { o.OnMemoryUpdate(ctx, taskPrompt.History) })
+	response, err := a.chat(ctx, taskPrompt)
 	if err != nil {
 		return output, fmt.Errorf("failed to predict response: %w", err)
 	}
 	a.logMessages(response)
-	err = a.Memory.Add(response)
+	err = memory.AddContext(ctx, a.Memory, response)
 	if err != nil {
 		return output, fmt.Errorf("failed to add response to memory: %w", err)
 	}
+	a.notify(ctx, func(o Observer) { o.OnMemoryUpdate(ctx, []*engines.ChatMessage{response}) })
 	stepsExecuted := 0
 	for {
-		nextMessages, answer := a.parseResponse(response)
+		nextMessages, answer := a.parseResponse(ctx, response)
 		a.logMessages(nextMessages...)
 		if answer != nil {
 			return answer.Content, nil
 		}
-		prompt, err := a.Memory.PromptWithContext(nextMessages...)
+		if err := ctx.Err(); err != nil {
+			return output, err
+		}
+		prompt, err := memory.PromptContext(ctx, a.Memory, nextMessages...)
 		if err != nil {
 			return output, fmt.Errorf("failed to generate prompt: %w", err)
 		}
+		a.notify(ctx, func(o Observer) { o.OnMemoryUpdate(ctx, nextMessages) })
 		if a.MaxSolutionAttempts > 0 && stepsExecuted > a.MaxSolutionAttempts {
 			return output, errors.New("max solution attempts reached")
 		}
-		response, err = a.chat(prompt)
+		response, err = a.chat(ctx, prompt)
 		if err != nil {
 			return output, fmt.Errorf("failed to predict response: %w", err)
 		}
 		a.logMessages(response)
-		err = a.Memory.Add(response)
+		err = memory.AddContext(ctx, a.Memory, response)
 		if err != nil {
 			return output, fmt.Errorf("failed to add response to memory: %w", err)
 		}
+		a.notify(ctx, func(o Observer) { o.OnMemoryUpdate(ctx, []*engines.ChatMessage{response}) })
 		stepsExecuted++
 	}
 }
 
+// runAttempt runs the agent in a span
+// of its own.
+func (a *ChainAgent[T, S]) runAttempt(ctx context.Context, input T, attempt int) (output S, err error) {
+	ctx, span := tracing.Start(ctx, "agents", "ChainAgent.Run",
+		trace.WithAttributes(attribute.Int("agent.attempt", attempt)),
+	)
+	defer func() { tracing.End(span, err) }()
+	return a.run(ctx, input)
+}
+
 func (a *ChainAgent[T, S]) Run(input T) (output S, err error) {
+	return a.RunContext(context.Background(), input)
+}
+
+func (a *ChainAgent[T, S]) RunContext(ctx context.Context, input T) (output S, err error) {
+	ctx = contextWithObservers(ctx, a.Observers)
+	ctx = contextWithObserversLock(ctx)
+	ctx = contextWithAgentDepth(ctx)
+	if a.Budget != nil {
+		ctx = engines.ContextWithBudget(ctx, a.Budget)
+	}
 	for i := 0; i <= a.MaxRestarts; i++ {
-		output, err = a.run(input)
+		if i > 0 {
+			a.notify(ctx, func(o Observer) { o.OnRestart(ctx, i, err) })
+		}
+		output, err = a.runAttempt(ctx, input, i)
 		if err == nil {
 			return output, nil
 		}
+		// restarting would not help
+		if ctx.Err() != nil || errors.Is(err, engines.ErrBudgetExceeded) {
+			return output, err
+		}
 	}
 	return output, err
 }
@@ -391,13 +824,13 @@ func NewChainAgent[T Representable, S Representable](engine engines.LLM, task *T
 		Memory: memory,
 		ActionArgPreprocessors: []toolsPkg.PreprocessingTool{
 			toolsPkg.NewJSONAutoFixer(engine, 3),
+			toolsPkg.NewArgsValidator(),
 		},
 	}
 }
 
 func (a *ChainAgent[T, S]) setNativeLLMFunctions(tools ...toolsPkg.Tool) (err error) {
-	_, ok := a.Engine.(engines.LLMWithFunctionCalls)
-	if !ok {
+	if !engines.SupportsFunctionCalls(a.Engine) {
 		return errNativeFunctionsUnsupported
 	}
 	functions := make([]engines.FunctionSpecs, len(tools))
@@ -426,6 +859,18 @@ func (a *ChainAgent[T, S]) WithTools(tools ...toolsPkg.Tool) *ChainAgent[T, S] {
 	return a
 }
 
+// Converts obvious mismatches in the arguments of actions,
+// such as numeric strings, to the types their tool expects,
+// rather than report them to the agent.
+func (a *ChainAgent[T, S]) WithArgCoercion() *ChainAgent[T, S] {
+	for _, preprocessor := range a.ActionArgPreprocessors {
+		if validator, ok := preprocessor.(*toolsPkg.ArgsValidator); ok {
+			validator.Coerce = true
+		}
+	}
+	return a
+}
+
 func (a *ChainAgent[T, S]) WithInputValidators(validators ...func(T) error) *ChainAgent[T, S] {
 	a.InputValidators = append(a.InputValidators, validators...)
 	return a
@@ -450,3 +895,53 @@ func (a *ChainAgent[T, S]) WithRestarts(maxRestarts int) *ChainAgent[T, S] {
 	a.MaxRestarts = maxRestarts
 	return a
 }
+
+// Registers observers that are notified of the
+// steps of each run, including the runs of agents
+// started by GenericAgentTool.
+func (a *ChainAgent[T, S]) WithObservers(observers ...Observer) *ChainAgent[T, S] {
+	a.Observers = append(a.Observers, observers...)
+	return a
+}
+
+// Continues responses that the engine cut off because
+// they reached its output limit, up to maxContinuations
+// times per response, by asking the engine to resume
+// where it stopped.
+func (a *ChainAgent[T, S]) WithMaxContinuations(maxContinuations int) *ChainAgent[T, S] {
+	a.MaxContinuations = maxContinuations
+	return a
+}
+
+// Gives the final answer in a separate request, whose
+// response follows the schema, once the agent answers.
+// The JSON response is parsed by the task's AnswerParser.
+// Engines that cannot constrain responses, such as Claude,
+// are given the schema in the prompt and asked to follow it.
+func (a *ChainAgent[T, S]) WithStructuredAnswer(schema *engines.ParameterSpecs) *ChainAgent[T, S] {
+	a.AnswerSchema = schema
+	return a
+}
+
+// Charges the requests of each run to the budget,
+// including those made by the agent's memory, its
+// JSONAutoFixer and agents started by GenericAgentTool.
+func (a *ChainAgent[T, S]) WithBudget(budget *engines.Budget) *ChainAgent[T, S] {
+	a.Budget = budget
+	return a
+}
+
+// Executes up to maxWorkers of the actions requested
+// in a single response concurrently. All actions in the
+// response are parsed before any of them is executed.
+func (a *ChainAgent[T, S]) WithParallelActions(maxWorkers int) *ChainAgent[T, S] {
+	a.MaxParallelActions = maxWorkers
+	return a
+}
+
+// Streams partial response text to the handler as it is
+// generated, if the engine supports streaming.
+func (a *ChainAgent[T, S]) WithStreamHandler(handler func(chunk *ChainAgentStreamChunk)) *ChainAgent[T, S] {
+	a.StreamHandler = handler
+	return a
+}
@@ -1,9 +1,13 @@
 package agents
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/natexcvi/go-llm/engines"
@@ -265,3 +269,619 @@ func TestChainAgent(t *testing.T) {
 		})
 	}
 }
+
+func TestChainAgentRunContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	toolCalls := 0
+	agent := &ChainAgent[*Str, *Str]{
+		Engine: &MockEngine{
+			Responses: []*engines.ChatMessage{
+				{
+					Role: engines.ConvRoleAssistant,
+					Text: `Action: echo("world")`,
+				},
+				{
+					Role: engines.ConvRoleAssistant,
+					Text: `Answer: "Hello world"`,
+				},
+			},
+		},
+		Task: &Task[*Str, *Str]{
+			Description: "Say hello to an entity you find yourself",
+			AnswerParser: func(text string) (*Str, error) {
+				return newStr(text), nil
+			},
+		},
+		Memory: newMockMemory(t),
+		Tools: map[string]tools.Tool{
+			"echo": newMockTool(
+				t,
+				"echo",
+				"echoes the input",
+				json.RawMessage(`"the string to echo"`),
+				func(args json.RawMessage) (json.RawMessage, error) {
+					toolCalls++
+					cancel()
+					return args, nil
+				},
+			),
+		},
+		MaxRestarts: 2,
+	}
+	_, err := agent.RunContext(ctx, newStr("hello"))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, toolCalls)
+}
+
+type MockFunctionsEngine struct {
+	MockEngine
+	Prompts []*engines.ChatPrompt
+}
+
+func (engine *MockFunctionsEngine) ChatWithFunctions(prompt *engines.ChatPrompt, functions []engines.FunctionSpecs) (*engines.ChatMessage, error) {
+	engine.Prompts = append(engine.Prompts, &engines.ChatPrompt{
+		History: append([]*engines.ChatMessage{}, prompt.History...),
+	})
+	return engine.Chat(prompt)
+}
+
+func TestChainAgentParallelToolCalls(t *testing.T) {
+	engine := &MockFunctionsEngine{
+		MockEngine: MockEngine{
+			Responses: []*engines.ChatMessage{
+				{
+					Role: engines.ConvRoleAssistant,
+					ToolCalls: []*engines.ToolCall{
+						{ID: "call_a", Type: "function", Function: engines.FunctionCall{Name: "echo", Args: `"Hello"`}},
+						{ID: "call_b", Type: "function", Function: engines.FunctionCall{Name: "shout", Args: `"world"`}},
+						{ID: "call_c", Type: "function", Function: engines.FunctionCall{Name: "echo", Args: `"!"`}},
+					},
+				},
+				{
+					Role: engines.ConvRoleAssistant,
+					Text: `Answer: Hello world!`,
+				},
+			},
+		},
+	}
+	var executed []string
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Say hello to the world",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(newMockTool(
+		t,
+		"echo",
+		"echoes the input",
+		json.RawMessage(`"the string to echo"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			executed = append(executed, string(args))
+			return args, nil
+		},
+	))
+	output, err := agent.Run(newStr("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world!", string(*output))
+	assert.Equal(t, []string{`"Hello"`, `"!"`}, executed)
+
+	require.Len(t, engine.Prompts, 2)
+	history := engine.Prompts[1].History
+	replies := history[len(history)-3:]
+	for i, id := range []string{"call_a", "call_b", "call_c"} {
+		assert.Equal(t, engines.ConvRoleTool, replies[i].Role)
+		assert.Equal(t, id, replies[i].ToolCallID)
+	}
+	assert.Equal(t, `"Hello"`, replies[0].Text)
+	assert.Contains(t, replies[1].Text, `tool "shout" not found`)
+	assert.Equal(t, `"!"`, replies[2].Text)
+}
+
+func TestChainAgentFallbackToTextEngine(t *testing.T) {
+	// the primary engine fails, and the text only
+	// fallback serves the run in text actions
+	primary := &MockFunctionsEngine{}
+	fallback := &MockRecordingEngine{
+		MockEngine: MockEngine{
+			Responses: []*engines.ChatMessage{
+				{Role: engines.ConvRoleAssistant, Text: `Action: echo("world")<END>`},
+				{Role: engines.ConvRoleAssistant, Text: `Answer: Hello world`},
+			},
+		},
+	}
+	agent := NewChainAgent[*Str, *Str](engines.NewFallbackEngine(primary, fallback), &Task[*Str, *Str]{
+		Description: "Say hello to the world",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(newMockTool(t, "echo", "echoes the input", json.RawMessage(`"the string to echo"`),
+		func(args json.RawMessage) (json.RawMessage, error) { return args, nil },
+	))
+	output, err := agent.Run(newStr("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", string(*output))
+	assert.Empty(t, primary.Prompts)
+	require.Len(t, fallback.Prompts, 2)
+	assert.Contains(t, fallback.Prompts[0].History[1].Text, "echo(")
+}
+
+type mockUnsafeTool struct {
+	*toolmocks.MockTool
+}
+
+func (tool *mockUnsafeTool) ConcurrencySafe() bool {
+	return false
+}
+
+func TestChainAgentParallelActions(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, unsafeOverlaps := 0, 0, 0
+	unsafeRunning := false
+	track := func(unsafe bool, impl func()) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if unsafeRunning || unsafe && running > 1 {
+			unsafeOverlaps++
+		}
+		unsafeRunning = unsafeRunning || unsafe
+		mu.Unlock()
+		impl()
+		mu.Lock()
+		running--
+		if unsafe {
+			unsafeRunning = false
+		}
+		mu.Unlock()
+	}
+	// each call to wait blocks until the other one is made,
+	// so the test deadlocks unless the actions run concurrently
+	barrier := make(chan struct{})
+	wait := newMockTool(t, "wait", "waits for a peer", json.RawMessage(`"a name"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			track(false, func() {
+				select {
+				case barrier <- struct{}{}:
+				case <-barrier:
+				}
+			})
+			return args, nil
+		},
+	)
+	sleep := newMockTool(t, "sleep", "sleeps", json.RawMessage(`"a name"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			track(false, func() { time.Sleep(10 * time.Millisecond) })
+			return args, nil
+		},
+	)
+	unsafe := &mockUnsafeTool{newMockTool(t, "unsafe", "must run alone", json.RawMessage(`"a name"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			track(true, func() { time.Sleep(10 * time.Millisecond) })
+			return args, nil
+		},
+	)}
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{
+				Role: engines.ConvRoleAssistant,
+				Text: `Action: wait("a")<END>` + "\n" +
+					`Action: sleep("b")<END>` + "\n" +
+					`Action: wait("c")<END>` + "\n" +
+					`Action: unsafe("d")<END>` + "\n" +
+					`Action: sleep("e")<END>`,
+			},
+			{
+				Role: engines.ConvRoleAssistant,
+				Text: `Answer: done`,
+			},
+		},
+	}
+	memory := newMockMemory(t)
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Run some actions",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, memory).WithTools(wait, sleep, unsafe).WithParallelActions(3)
+	agent.ActionArgPreprocessors = nil
+
+	response, err := engine.Chat(nil)
+	require.NoError(t, err)
+	nextMessages, answer := agent.parseResponse(context.Background(), response)
+	require.Nil(t, answer)
+	var observations []string
+	for _, msg := range nextMessages {
+		observations = append(observations, msg.Text)
+	}
+	assert.Equal(t, []string{
+		`Observation: "a"<END>`,
+		`Observation: "b"<END>`,
+		`Observation: "c"<END>`,
+		`Observation: "d"<END>`,
+		`Observation: "e"<END>`,
+	}, observations)
+	assert.LessOrEqual(t, maxRunning, 3)
+	assert.Zero(t, unsafeOverlaps)
+}
+
+type MockRecordingEngine struct {
+	MockEngine
+	Prompts []*engines.ChatPrompt
+}
+
+func (engine *MockRecordingEngine) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	engine.Prompts = append(engine.Prompts, prompt)
+	return engine.MockEngine.Chat(prompt)
+}
+
+func TestChainAgentContinuation(t *testing.T) {
+	cutOff := func(text string, usage engines.Usage) *engines.ChatMessage {
+		return &engines.ChatMessage{
+			Role:     engines.ConvRoleAssistant,
+			Text:     text,
+			Metadata: &engines.ResponseMetadata{Usage: usage, FinishReason: engines.FinishReasonLength},
+		}
+	}
+	testCases := []struct {
+		name             string
+		maxContinuations int
+		responses        []*engines.ChatMessage
+		expectedPrompts  int
+		expectedOutput   string
+		expectedUsage    engines.Usage
+	}{
+		{
+			name:             "continued",
+			maxContinuations: 2,
+			responses: []*engines.ChatMessage{
+				cutOff(`Answer: "Hello`, engines.Usage{PromptTokens: 10, CompletionTokens: 5}),
+				cutOff(` wor`, engines.Usage{PromptTokens: 16, CompletionTokens: 5}),
+				{
+					Role:     engines.ConvRoleAssistant,
+					Text:     `ld"`,
+					Metadata: &engines.ResponseMetadata{Usage: engines.Usage{PromptTokens: 20, CompletionTokens: 2}, FinishReason: engines.FinishReasonStop},
+				},
+			},
+			expectedPrompts: 3,
+			expectedOutput:  `"Hello world"`,
+			expectedUsage:   engines.Usage{PromptTokens: 46, CompletionTokens: 12},
+		},
+		{
+			name: "not continued by default",
+			responses: []*engines.ChatMessage{
+				cutOff(`Answer: "Hello`, engines.Usage{PromptTokens: 10, CompletionTokens: 5}),
+			},
+			expectedPrompts: 1,
+			expectedOutput:  `"Hello`,
+			expectedUsage:   engines.Usage{PromptTokens: 10, CompletionTokens: 5},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &MockRecordingEngine{MockEngine: MockEngine{Responses: tc.responses}}
+			transcript := NewTranscript()
+			agent := NewChainAgent(engine, &Task[*Str, *Str]{
+				Description: "Say hello",
+				AnswerParser: func(text string) (*Str, error) {
+					return newStr(text), nil
+				},
+			}, newMockMemory(t)).WithMaxContinuations(tc.maxContinuations).WithObservers(transcript)
+
+			output, err := agent.Run(newStr("hello"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOutput, string(*output))
+			assert.Equal(t, tc.expectedUsage, transcript.Usage())
+			require.Len(t, engine.Prompts, tc.expectedPrompts)
+			if tc.expectedPrompts == 1 {
+				return
+			}
+			// each continuation is asked for with the
+			// text of the response so far
+			continuation := engine.Prompts[len(engine.Prompts)-1].History
+			assert.Equal(t, `Answer: "Hello wor`, continuation[len(continuation)-2].Text)
+			assert.Equal(t, ContinuationPrompt, continuation[len(continuation)-1].Text)
+		})
+	}
+}
+
+// MockContextEngine records the generation
+// options of the requests it serves.
+type MockContextEngine struct {
+	MockEngine
+	Options []engines.GenerationOptions
+}
+
+func (engine *MockContextEngine) ChatContext(ctx context.Context, prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	engine.Options = append(engine.Options, engines.GenerationOptionsFromContext(ctx))
+	return engine.Chat(prompt)
+}
+
+func TestChainAgentStopSequences(t *testing.T) {
+	stopped := func(text string) *engines.ChatMessage {
+		return &engines.ChatMessage{
+			Role:     engines.ConvRoleAssistant,
+			Text:     text,
+			Metadata: &engines.ResponseMetadata{FinishReason: engines.FinishReasonStop},
+		}
+	}
+	engine := &MockContextEngine{MockEngine: MockEngine{Responses: []*engines.ChatMessage{
+		stopped("Thought: I should echo"),
+		stopped(`Action: echo("world")` + "\n"),
+		stopped(`Answer: "Hello world"`),
+	}}}
+	transcript := NewTranscript()
+	agent := NewChainAgent(engine, &Task[*Str, *Str]{
+		Description: "Say hello",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(newMockTool(
+		t,
+		"echo",
+		"echoes the input",
+		json.RawMessage(`"the string to echo"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			return args, nil
+		},
+	)).WithObservers(transcript)
+
+	output, err := agent.Run(newStr("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, `"Hello world"`, string(*output))
+	require.Len(t, engine.Options, 3)
+	for _, options := range engine.Options {
+		assert.Equal(t, []string{EndMarker, "Observation:"}, options.Stop)
+	}
+	// the end markers left out by the
+	// stop sequences are restored
+	var responses []string
+	for _, event := range transcript.Events() {
+		if event.Type == TranscriptResponse {
+			responses = append(responses, event.Messages[0].Text)
+		}
+	}
+	assert.Equal(t, []string{
+		"Thought: I should echo<END>",
+		`Action: echo("world")<END>`,
+		`Answer: "Hello world"<END>`,
+	}, responses)
+}
+
+func TestChainAgentParallelActionsStopSequences(t *testing.T) {
+	engine := &MockContextEngine{MockEngine: MockEngine{Responses: []*engines.ChatMessage{
+		{
+			Role:     engines.ConvRoleAssistant,
+			Text:     `Action: echo("a")<END>` + "\n" + `Action: echo("b")<END>` + "\n",
+			Metadata: &engines.ResponseMetadata{FinishReason: engines.FinishReasonStop},
+		},
+		{Role: engines.ConvRoleAssistant, Text: `Answer: "ab"<END>`},
+	}}}
+	var mu sync.Mutex
+	var echoed []string
+	agent := NewChainAgent(engine, &Task[*Str, *Str]{
+		Description: "Echo twice",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(newMockTool(
+		t,
+		"echo",
+		"echoes the input",
+		json.RawMessage(`"the string to echo"`),
+		func(args json.RawMessage) (json.RawMessage, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			echoed = append(echoed, string(args))
+			return args, nil
+		},
+	)).WithParallelActions(2)
+
+	output, err := agent.Run(newStr("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, `"ab"`, string(*output))
+	require.Len(t, engine.Options, 2)
+	for _, options := range engine.Options {
+		assert.Equal(t, []string{"Observation:"}, options.Stop)
+	}
+	assert.ElementsMatch(t, []string{`"a"`, `"b"`}, echoed)
+}
+
+// MockFormatEngine is a MockContextEngine
+// that constrains its responses to formats.
+type MockFormatEngine struct {
+	MockContextEngine
+}
+
+func (engine *MockFormatEngine) SupportsResponseFormat() bool {
+	return true
+}
+
+func TestChainAgentStructuredAnswer(t *testing.T) {
+	schema := &engines.ParameterSpecs{
+		Type:       "object",
+		Properties: map[string]*engines.ParameterSpecs{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}
+	testCases := []struct {
+		name                string
+		constrainsResponses bool
+		expectedInstruction string
+	}{
+		{
+			name:                "engine constrains responses",
+			constrainsResponses: true,
+			expectedInstruction: StructuredAnswerPrompt,
+		},
+		{
+			name:                "schema in prompt",
+			expectedInstruction: StructuredAnswerPrompt + ` The schema is: {"properties":{"city":{"type":"string"}},"required":["city"],"type":"object"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &MockFormatEngine{MockContextEngine{MockEngine: MockEngine{Responses: []*engines.ChatMessage{
+				{Role: engines.ConvRoleAssistant, Text: "Answer: The capital is Paris<END>"},
+				{Role: engines.ConvRoleAssistant, Text: `{"town": "Paris"}`},
+				{Role: engines.ConvRoleAssistant, Text: "Answer: Paris<END>"},
+				{Role: engines.ConvRoleAssistant, Text: `{"city": "Paris"}`},
+			}}}}
+			var llm engines.LLM = &engine.MockContextEngine
+			if tc.constrainsResponses {
+				llm = engine
+			}
+			mem := newMockMemory(t)
+			agent := NewChainAgent(llm, &Task[*Str, *Str]{
+				Description: "Find the capital",
+				AnswerParser: func(text string) (*Str, error) {
+					var answer struct {
+						City string `json:"city"`
+					}
+					if err := json.Unmarshal([]byte(text), &answer); err != nil {
+						return nil, err
+					}
+					if answer.City == "" {
+						return nil, errors.New("missing city")
+					}
+					return newStr(answer.City), nil
+				},
+			}, mem).WithStructuredAnswer(schema)
+
+			output, err := agent.Run(newStr("France"))
+			require.NoError(t, err)
+			assert.Equal(t, "Paris", string(*output))
+			require.Len(t, engine.Options, 4)
+			expectedFormat := engines.JSONSchemaFormat("answer", schema, true)
+			for i, options := range engine.Options {
+				if i%2 == 0 {
+					assert.Nil(t, options.ResponseFormat)
+					continue
+				}
+				// the structured requests are not cut at the
+				// operation stop sequences, nor answered with
+				// tool calls
+				assert.Equal(t, engines.GenerationOptions{
+					ResponseFormat: expectedFormat,
+					ToolChoice:     &engines.ToolChoice{Mode: "none"},
+				}, options)
+			}
+			prompt, err := mem.PromptWithContext()
+			require.NoError(t, err)
+			var texts []string
+			for _, msg := range prompt.History {
+				texts = append(texts, msg.Text)
+			}
+			assert.Contains(t, texts, tc.expectedInstruction)
+			assert.Contains(t, texts, `{"town": "Paris"}`)
+		})
+	}
+}
+
+func TestChainAgentFuzzySchemaToolArgs(t *testing.T) {
+	engine := &MockEngine{Responses: []*engines.ChatMessage{
+		{Role: engines.ConvRoleAssistant, Text: `Action: search({"query": "go", "limit": 5})<END>`},
+		{Role: engines.ConvRoleAssistant, Text: `Action: search({"query": "go"})<END>`},
+		{Role: engines.ConvRoleAssistant, Text: `Answer: "done"<END>`},
+	}}
+	var calls []string
+	mem := newMockMemory(t)
+	agent := NewChainAgent(engine, &Task[*Str, *Str]{
+		Description: "Search",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, mem).WithTools(newMockTool(t, "search", "searches the web", json.RawMessage(`{"query": "search query", "limit": "max number of results"}`), func(args json.RawMessage) (json.RawMessage, error) {
+		calls = append(calls, string(args))
+		return json.RawMessage(`"results"`), nil
+	}))
+
+	_, err := agent.Run(newStr("go"))
+	require.NoError(t, err)
+	// the types and required fields of fuzzy
+	// schemas are guesses, so they are not checked
+	assert.Equal(t, []string{`{"query": "go", "limit": 5}`, `{"query": "go"}`}, calls)
+}
+
+// mockSchemaTool is a mock tool with
+// an exact schema for its arguments.
+type mockSchemaTool struct {
+	*toolmocks.MockTool
+	schema *engines.ParameterSpecs
+}
+
+func (t *mockSchemaTool) ParametersSchema() *engines.ParameterSpecs {
+	return t.schema
+}
+
+func TestChainAgentArgsValidation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		coerce        bool
+		expectedCalls []string
+		expectedError string
+	}{
+		{
+			name:          "invalid args are reported",
+			expectedCalls: []string{`{"count": 2}`},
+			expectedError: "field `count` must be a number",
+		},
+		{
+			name:          "numeric strings are coerced",
+			coerce:        true,
+			expectedCalls: []string{`{"count":3}`, `{"count": 2}`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &MockEngine{Responses: []*engines.ChatMessage{
+				{Role: engines.ConvRoleAssistant, Text: `Action: repeat({"times": 2})<END>`},
+				{Role: engines.ConvRoleAssistant, Text: `Action: repeat({"count": "3"})<END>`},
+				{Role: engines.ConvRoleAssistant, Text: `Action: repeat({"count": 2})<END>`},
+				{Role: engines.ConvRoleAssistant, Text: `Answer: "done"<END>`},
+			}}
+			var calls []string
+			mem := newMockMemory(t)
+			agent := NewChainAgent(engine, &Task[*Str, *Str]{
+				Description: "Repeat",
+				AnswerParser: func(text string) (*Str, error) {
+					return newStr(text), nil
+				},
+			}, mem).WithTools(&mockSchemaTool{
+				MockTool: newMockTool(t, "repeat", "repeats", json.RawMessage(`{"count": 0}`), func(args json.RawMessage) (json.RawMessage, error) {
+					calls = append(calls, string(args))
+					return json.RawMessage(`"ok"`), nil
+				}),
+				schema: &engines.ParameterSpecs{
+					Type:       "object",
+					Properties: map[string]*engines.ParameterSpecs{"count": {Type: "number"}},
+					Required:   []string{"count"},
+				},
+			})
+			if tc.coerce {
+				agent = agent.WithArgCoercion()
+			}
+
+			_, err := agent.Run(newStr("go"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCalls, calls)
+			prompt, err := mem.PromptWithContext()
+			require.NoError(t, err)
+			var errorMessages []string
+			for _, msg := range prompt.History {
+				if strings.HasPrefix(msg.Text, ErrorCode+":") {
+					errorMessages = append(errorMessages, msg.Text)
+				}
+			}
+			require.NotEmpty(t, errorMessages)
+			assert.Contains(t, errorMessages[0], "field `count` is required")
+			if tc.expectedError != "" {
+				require.Len(t, errorMessages, 2)
+				assert.Contains(t, errorMessages[1], tc.expectedError)
+			} else {
+				assert.Len(t, errorMessages, 1)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package agents
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -57,6 +58,10 @@ func (ga *GenericAgentTool) Description() string {
 }
 
 func (ga *GenericAgentTool) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return ga.ExecuteContext(context.Background(), args)
+}
+
+func (ga *GenericAgentTool) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var request genericRequest
 	err := json.Unmarshal(args, &request)
 	if err != nil {
@@ -69,8 +74,10 @@ func (ga *GenericAgentTool) Execute(args json.RawMessage) (json.RawMessage, erro
 			return genericResponse{res}, nil
 		},
 	}
-	agent := NewChainAgent(ga.engine, task, memory.NewBufferedMemory(10)).WithTools(ga.tools...)
-	response, err := agent.Run(request)
+	agent := NewChainAgent(ga.engine, task, memory.NewBufferedMemory(10)).
+		WithTools(ga.tools...).
+		WithObservers(ObserversFromContext(ctx)...)
+	response, err := agent.RunContext(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("error running agent: %s", err.Error())
 	}
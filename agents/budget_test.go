@@ -0,0 +1,45 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exhaustedEngine fails every request with
+// ErrBudgetExceeded, recording the budget and
+// component the request was made with.
+type exhaustedEngine struct {
+	budgets    []*engines.Budget
+	components []string
+}
+
+func (engine *exhaustedEngine) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	return engine.ChatContext(context.Background(), prompt)
+}
+
+func (engine *exhaustedEngine) ChatContext(ctx context.Context, prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	engine.budgets = append(engine.budgets, engines.BudgetFromContext(ctx))
+	engine.components = append(engine.components, engines.ComponentFromContext(ctx))
+	return nil, engines.ErrBudgetExceeded
+}
+
+func TestChainAgentBudget(t *testing.T) {
+	budget := engines.NewBudget().WithMaxTokens(100)
+	engine := &exhaustedEngine{}
+	agent := NewChainAgent(engine, &Task[*Str, *Str]{
+		Description: "Say hello",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithRestarts(3).WithBudget(budget)
+
+	_, err := agent.Run(newStr("hello"))
+	require.ErrorIs(t, err, engines.ErrBudgetExceeded)
+	// the agent does not restart once the budget is exceeded
+	assert.Equal(t, []*engines.Budget{budget}, engine.budgets)
+	assert.Equal(t, []string{engines.ComponentAgent}, engine.components)
+}
@@ -0,0 +1,117 @@
+package agents
+
+import (
+	"context"
+	"sync"
+
+	"github.com/natexcvi/go-llm/engines"
+)
+
+// An Observer is notified of the steps of an agent's
+// run, e.g. to drive a UI, write an audit log or collect
+// metrics. Callbacks are made synchronously, in the
+// order the steps of each agent happen, and never at the
+// same time: those of a run and of the agents started
+// from within its tools are serialized, though the steps
+// of agents running in parallel actions interleave.
+// Embed BaseObserver to implement only some of the
+// callbacks.
+type Observer interface {
+	// Called with each prompt before it
+	// is sent to the engine.
+	OnPrompt(ctx context.Context, prompt *engines.ChatPrompt)
+	// Called with each response of the engine.
+	OnResponse(ctx context.Context, response *engines.ChatMessage)
+	OnThought(ctx context.Context, thought *ChainAgentThought)
+	// Called before an action is executed.
+	OnAction(ctx context.Context, action *ChainAgentAction)
+	OnObservation(ctx context.Context, action *ChainAgentAction, observation *ChainAgentObservation)
+	// Called when an action fails, or when a
+	// response cannot be parsed or its answer is
+	// invalid, in which case action is nil.
+	OnError(ctx context.Context, action *ChainAgentAction, err *ChainAgentError)
+	OnAnswer(ctx context.Context, answer Representable)
+	// Called before the agent restarts
+	// after a failed attempt.
+	OnRestart(ctx context.Context, attempt int, err error)
+	// Called with the messages added to
+	// the agent's memory.
+	OnMemoryUpdate(ctx context.Context, messages []*engines.ChatMessage)
+}
+
+// A no-op Observer, to be embedded in
+// observers that handle only some events.
+type BaseObserver struct{}
+
+func (BaseObserver) OnPrompt(context.Context, *engines.ChatPrompt)    {}
+func (BaseObserver) OnResponse(context.Context, *engines.ChatMessage) {}
+func (BaseObserver) OnThought(context.Context, *ChainAgentThought)    {}
+func (BaseObserver) OnAction(context.Context, *ChainAgentAction)      {}
+
+func (BaseObserver) OnObservation(context.Context, *ChainAgentAction, *ChainAgentObservation) {}
+
+func (BaseObserver) OnError(context.Context, *ChainAgentAction, *ChainAgentError) {}
+
+func (BaseObserver) OnAnswer(context.Context, Representable)                {}
+func (BaseObserver) OnRestart(context.Context, int, error)                  {}
+func (BaseObserver) OnMemoryUpdate(context.Context, []*engines.ChatMessage) {}
+
+type (
+	observersKey     struct{}
+	observersLockKey struct{}
+	agentDepthKey    struct{}
+)
+
+// AgentDepth returns the nesting depth of the agent run
+// that ctx belongs to: 0 for a top level run, 1 for runs
+// started by its tools, and so on.
+func AgentDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(agentDepthKey{}).(int)
+	return depth
+}
+
+func contextWithAgentDepth(ctx context.Context) context.Context {
+	depth, ok := ctx.Value(agentDepthKey{}).(int)
+	if ok {
+		depth++
+	}
+	return context.WithValue(ctx, agentDepthKey{}, depth)
+}
+
+// ObserversFromContext returns the observers of the agent
+// run that ctx belongs to, so that agents started from
+// within its tools can report to them as well.
+func ObserversFromContext(ctx context.Context) []Observer {
+	observers, _ := ctx.Value(observersKey{}).([]Observer)
+	return observers
+}
+
+func contextWithObservers(ctx context.Context, observers []Observer) context.Context {
+	if len(observers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, observersKey{}, observers)
+}
+
+// contextWithObserversLock adds the lock that serializes
+// the callbacks of a run, unless ctx belongs to a run
+// that already has one.
+func contextWithObserversLock(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(observersLockKey{}).(*sync.Mutex); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, observersLockKey{}, &sync.Mutex{})
+}
+
+func (a *ChainAgent[T, S]) notify(ctx context.Context, callback func(observer Observer)) {
+	if len(a.Observers) == 0 {
+		return
+	}
+	if lock, ok := ctx.Value(observersLockKey{}).(*sync.Mutex); ok {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	for _, observer := range a.Observers {
+		callback(observer)
+	}
+}
@@ -0,0 +1,195 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	BaseObserver
+	events []string
+}
+
+func (o *recordingObserver) OnPrompt(_ context.Context, prompt *engines.ChatPrompt) {
+	o.events = append(o.events, "prompt")
+}
+
+func (o *recordingObserver) OnResponse(_ context.Context, response *engines.ChatMessage) {
+	o.events = append(o.events, "response")
+}
+
+func (o *recordingObserver) OnThought(_ context.Context, thought *ChainAgentThought) {
+	o.events = append(o.events, "thought: "+thought.Content)
+}
+
+func (o *recordingObserver) OnAction(_ context.Context, action *ChainAgentAction) {
+	o.events = append(o.events, fmt.Sprintf("action: %s(%s)", action.Tool.Name(), action.Args))
+}
+
+func (o *recordingObserver) OnObservation(_ context.Context, _ *ChainAgentAction, observation *ChainAgentObservation) {
+	o.events = append(o.events, "observation: "+observation.Content)
+}
+
+func (o *recordingObserver) OnError(_ context.Context, action *ChainAgentAction, err *ChainAgentError) {
+	o.events = append(o.events, fmt.Sprintf("error (action: %t): %s", action != nil, err.Content))
+}
+
+func (o *recordingObserver) OnAnswer(_ context.Context, answer Representable) {
+	o.events = append(o.events, "answer: "+answer.Encode())
+}
+
+func (o *recordingObserver) OnRestart(_ context.Context, attempt int, err error) {
+	o.events = append(o.events, fmt.Sprintf("restart %d: %s", attempt, err))
+}
+
+func (o *recordingObserver) OnMemoryUpdate(_ context.Context, messages []*engines.ChatMessage) {
+	o.events = append(o.events, fmt.Sprintf("memory: %d", len(messages)))
+}
+
+func TestChainAgentObservers(t *testing.T) {
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{Role: engines.ConvRoleAssistant, Text: `Thought: I should echo<END>Action: echo("hi")<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Action: fail("x")<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Action: missing("x")<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: hi`},
+		},
+	}
+	observer := &recordingObserver{}
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Echo the input",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(
+		newMockTool(t, "echo", "echoes the input", json.RawMessage(`"a string"`),
+			func(args json.RawMessage) (json.RawMessage, error) { return args, nil },
+		),
+		newMockTool(t, "fail", "always fails", json.RawMessage(`"a string"`),
+			func(args json.RawMessage) (json.RawMessage, error) { return nil, errors.New("boom") },
+		),
+	).WithObservers(observer).WithRestarts(1)
+	agent.ActionArgPreprocessors = nil
+
+	output, err := agent.Run(newStr("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(*output))
+	assert.Equal(t, []string{
+		"memory: 4",
+		"prompt",
+		"response",
+		"memory: 1",
+		"thought: I should echo",
+		`action: echo("hi")`,
+		`observation: "hi"`,
+		"memory: 1",
+		"prompt",
+		"response",
+		"memory: 1",
+		`action: fail("x")`,
+		"error (action: true): boom",
+		"memory: 1",
+		"prompt",
+		"response",
+		"memory: 1",
+		`error (action: false): tool "missing" not found. Available tools: echo, fail`,
+		"memory: 1",
+		"prompt",
+		"response",
+		"memory: 1",
+		"answer: hi",
+	}, observer.events)
+
+	observer.events = nil
+	engine.Responses = []*engines.ChatMessage{{Role: engines.ConvRoleAssistant, Text: "Answer: "}}
+	agent.WithOutputValidators(func(output *Str) error {
+		if *output == "" {
+			return errors.New("output is empty")
+		}
+		return nil
+	})
+	_, err = agent.Run(newStr("hi"))
+	require.Error(t, err)
+	assert.Contains(t, observer.events, "error (action: false): 1 error occurred:\n\t* output is empty\n\n")
+	assert.Contains(t, observer.events, "restart 1: failed to predict response: no more responses")
+}
+
+func TestGenericAgentToolObservers(t *testing.T) {
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{Role: engines.ConvRoleAssistant, Text: `Action: smart_agent({"task": "say hi", "input": "bob"})<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: hi bob`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: done`},
+		},
+	}
+	observer := &recordingObserver{}
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Delegate",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(NewGenericAgentTool(engine, []tools.Tool{})).WithObservers(observer)
+	agent.ActionArgPreprocessors = nil
+
+	_, err := agent.Run(newStr("hi"))
+	require.NoError(t, err)
+	var answers []string
+	for _, event := range observer.events {
+		if len(event) > 8 && event[:8] == "answer: " {
+			answers = append(answers, event)
+		}
+	}
+	assert.Equal(t, []string{"answer: hi bob", "answer: done"}, answers)
+}
+
+// mockAnswerEngine answers every prompt the same
+// way, and is safe for concurrent use.
+type mockAnswerEngine struct {
+	answer string
+}
+
+func (engine *mockAnswerEngine) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	return &engines.ChatMessage{Role: engines.ConvRoleAssistant, Text: "Answer: " + engine.answer}, nil
+}
+
+func TestParallelGenericAgentToolObservers(t *testing.T) {
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{Role: engines.ConvRoleAssistant, Text: `Action: smart_agent({"task": "say hi", "input": "bob"})<END>` +
+				`Action: smart_agent({"task": "say hi", "input": "alice"})<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: done`},
+		},
+	}
+	// recordingObserver does not lock, so the race
+	// detector reports callbacks made concurrently
+	observer := &recordingObserver{}
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Delegate",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).
+		WithTools(NewGenericAgentTool(&mockAnswerEngine{answer: "hi"}, []tools.Tool{})).
+		WithObservers(observer).
+		WithParallelActions(2)
+	agent.ActionArgPreprocessors = nil
+
+	_, err := agent.Run(newStr("hi"))
+	require.NoError(t, err)
+	var answers []string
+	for _, event := range observer.events {
+		if strings.HasPrefix(event, "answer: ") {
+			answers = append(answers, event)
+		}
+	}
+	assert.Equal(t, []string{"answer: hi", "answer: hi", "answer: done"}, answers)
+}
@@ -0,0 +1,266 @@
+package agents
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/tools"
+)
+
+// The text/template templates of the messages that
+// Task.Compile generates. They are executed with
+// PromptData. Templates left empty fall back to the
+// built-in default ones.
+type PromptTemplates struct {
+	// The system message, which explains the
+	// message format to the agent.
+	System string
+	// The system message that lists the tools,
+	// sent only when there are tools.
+	Tools string
+	// The message that describes the task.
+	Task string
+	// The messages of the inputs, both of the
+	// examples and of the task itself.
+	Input string
+	// The answer messages of the examples.
+	ExampleAnswer string
+}
+
+// The data the prompt templates are executed with.
+type PromptData struct {
+	Description  string
+	InputSchema  string
+	AnswerSchema string
+	// The tools, in alphabetical order.
+	Tools    []PromptTool
+	Examples []PromptExample
+	Markers  PromptMarkers
+	// The encoded input, in the Input template.
+	Input string
+	// The encoded answer, in the ExampleAnswer template.
+	Answer string
+}
+
+type PromptTool struct {
+	Name        string
+	Description string
+	ArgsSchema  string
+}
+
+type PromptExample struct {
+	Input  string
+	Answer string
+	Steps  []*engines.ChatMessage
+}
+
+// The codes and markers of the message format.
+type PromptMarkers struct {
+	Thought     string
+	Action      string
+	Answer      string
+	Error       string
+	Observation string
+	End         string
+}
+
+// ParsedPromptTemplates are prompt templates that
+// were parsed and checked by ParsePromptTemplates.
+type ParsedPromptTemplates struct {
+	source        PromptTemplates
+	system        *template.Template
+	tools         *template.Template
+	task          *template.Template
+	input         *template.Template
+	exampleAnswer *template.Template
+}
+
+const (
+	PromptPresetDefault = "default"
+	PromptPresetConcise = "concise"
+)
+
+var (
+	defaultPromptTemplates = PromptTemplates{
+		System: "You are a smart, autonomous agent given the task below. " +
+			"You will be given input from the user in the following format:\n\n" +
+			"{{.InputSchema}}\n\n Complete the task step-by-step, " +
+			"reasoning about your solution steps by sending thought messages in format " +
+			"`{{.Markers.Thought}}: (your reflection){{.Markers.End}}`. When you are ready to return your response, " +
+			"send an answer message in format `{{.Markers.Answer}}: {{.AnswerSchema}}{{.Markers.End}}`. Remember: you are on your own - " +
+			"do not ask for any clarifications, except by using appropriate tools " +
+			"that enable interaction with the user. You should determine when you are " +
+			"done with the task, and return your answer.",
+		Tools: "Here are some tools you can use. To use a tool, " +
+			"send a message in the form of `{{.Markers.Action}}: tool_name(args){{.Markers.End}}`, " +
+			"where `args` is a valid one-line JSON representation of the arguments" +
+			" to the tool, as specified for it. You will get " +
+			"the output in " +
+			"a message beginning with `{{.Markers.Observation}}: `, or an error message beginning " +
+			"with `{{.Markers.Error}}: `.\n\nTools:\n" +
+			"{{range $i, $tool := .Tools}}{{if $i}}\n{{end}}{{$tool.Name}}({{$tool.ArgsSchema}}) # {{$tool.Description}}{{end}}",
+		Task:          "{{.Description}}",
+		Input:         "{{.Input}}",
+		ExampleAnswer: "{{.Markers.Answer}}: {{.Answer}}{{.Markers.End}}",
+	}
+	// The built-in default templates, which Task.Compile
+	// falls back to when other templates fail.
+	builtinPromptTemplates = mustParsePromptTemplates(&defaultPromptTemplates)
+
+	promptPresetsMu sync.RWMutex
+	promptPresets   = map[string]*ParsedPromptTemplates{
+		PromptPresetDefault: builtinPromptTemplates,
+		PromptPresetConcise: mustParsePromptTemplates(&PromptTemplates{
+			System: "Solve the task below step by step. Input format: {{.InputSchema}}\n" +
+				"Think with `{{.Markers.Thought}}: ...{{.Markers.End}}`. " +
+				"Answer with `{{.Markers.Answer}}: {{.AnswerSchema}}{{.Markers.End}}`. " +
+				"Do not ask for clarifications.",
+			Tools: "Call a tool with `{{.Markers.Action}}: tool_name(args){{.Markers.End}}`, args being one-line JSON. " +
+				"Results come as `{{.Markers.Observation}}: `, failures as `{{.Markers.Error}}: `.\nTools:\n" +
+				"{{range $i, $tool := .Tools}}{{if $i}}\n{{end}}{{$tool.Name}}({{$tool.ArgsSchema}}) # {{$tool.Description}}{{end}}",
+		}),
+	}
+)
+
+// ParsePromptTemplates parses the templates once, so that
+// tasks can reuse them, and checks that they execute with
+// PromptData. Empty templates fall back to the built-in
+// default ones.
+func ParsePromptTemplates(templates *PromptTemplates) (*ParsedPromptTemplates, error) {
+	parsed := &ParsedPromptTemplates{source: templates.withDefaults()}
+	for _, field := range []struct {
+		name   string
+		text   string
+		parsed **template.Template
+	}{
+		{"system", parsed.source.System, &parsed.system},
+		{"tools", parsed.source.Tools, &parsed.tools},
+		{"task", parsed.source.Task, &parsed.task},
+		{"input", parsed.source.Input, &parsed.input},
+		{"example answer", parsed.source.ExampleAnswer, &parsed.exampleAnswer},
+	} {
+		tmpl, err := template.New(field.name).Option("missingkey=error").Parse(field.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", field.name, err)
+		}
+		if err := tmpl.Execute(io.Discard, samplePromptData()); err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", field.name, err)
+		}
+		*field.parsed = tmpl
+	}
+	return parsed, nil
+}
+
+func mustParsePromptTemplates(templates *PromptTemplates) *ParsedPromptTemplates {
+	parsed, err := ParsePromptTemplates(templates)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// Templates returns the source of the templates,
+// with the default ones in place of empty ones.
+func (templates *ParsedPromptTemplates) Templates() PromptTemplates {
+	return templates.source
+}
+
+// RegisterPromptPreset parses the templates and makes them
+// available under the name, replacing any preset of that name.
+func RegisterPromptPreset(name string, templates *PromptTemplates) error {
+	parsed, err := ParsePromptTemplates(templates)
+	if err != nil {
+		return err
+	}
+	promptPresetsMu.Lock()
+	defer promptPresetsMu.Unlock()
+	promptPresets[name] = parsed
+	return nil
+}
+
+// PromptPreset returns the templates of the
+// preset, which is either built in or registered.
+func PromptPreset(name string) (*ParsedPromptTemplates, error) {
+	promptPresetsMu.RLock()
+	defer promptPresetsMu.RUnlock()
+	templates, ok := promptPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("prompt preset %q not found", name)
+	}
+	return templates, nil
+}
+
+// withDefaults returns the templates, with the
+// built-in default ones in place of empty ones.
+func (templates *PromptTemplates) withDefaults() PromptTemplates {
+	if templates == nil {
+		return defaultPromptTemplates
+	}
+	merged := *templates
+	for _, field := range []struct{ value, fallback *string }{
+		{&merged.System, &defaultPromptTemplates.System},
+		{&merged.Tools, &defaultPromptTemplates.Tools},
+		{&merged.Task, &defaultPromptTemplates.Task},
+		{&merged.Input, &defaultPromptTemplates.Input},
+		{&merged.ExampleAnswer, &defaultPromptTemplates.ExampleAnswer},
+	} {
+		if *field.value == "" {
+			*field.value = *field.fallback
+		}
+	}
+	return merged
+}
+
+// samplePromptData is the data templates are
+// checked with, with every field populated.
+func samplePromptData() PromptData {
+	return PromptData{
+		Description:  "description",
+		InputSchema:  "input schema",
+		AnswerSchema: "answer schema",
+		Tools:        []PromptTool{{Name: "tool", Description: "description", ArgsSchema: "{}"}},
+		Examples:     []PromptExample{{Input: "input", Answer: "answer"}},
+		Markers:      defaultMarkers(),
+		Input:        "input",
+		Answer:       "answer",
+	}
+}
+
+func executeTemplate(tmpl *template.Template, data PromptData) (string, error) {
+	var output strings.Builder
+	if err := tmpl.Execute(&output, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template: %w", tmpl.Name(), err)
+	}
+	return output.String(), nil
+}
+
+func defaultMarkers() PromptMarkers {
+	return PromptMarkers{
+		Thought:     ThoughtCode,
+		Action:      ActionCode,
+		Answer:      AnswerCode,
+		Error:       ErrorCode,
+		Observation: ObservationCode,
+		End:         EndMarker,
+	}
+}
+
+func promptTools(toolsByName map[string]tools.Tool) []PromptTool {
+	promptTools := make([]PromptTool, 0, len(toolsByName))
+	for name, tool := range toolsByName {
+		promptTools = append(promptTools, PromptTool{
+			Name:        name,
+			Description: tool.Description(),
+			ArgsSchema:  string(tool.ArgsSchema()),
+		})
+	}
+	sort.Slice(promptTools, func(i, j int) bool {
+		return promptTools[i].Name < promptTools[j].Name
+	})
+	return promptTools
+}
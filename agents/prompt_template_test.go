@@ -0,0 +1,150 @@
+package agents
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskCompile(t *testing.T) {
+	echo := newMockTool(t, "echo", "Echoes the input.", []byte(`{"text": "the text"}`), nil)
+	add := newMockTool(t, "add", "Adds numbers.", []byte(`{"a": 1, "b": 2}`), nil)
+	step := &engines.ChatMessage{Role: engines.ConvRoleAssistant, Text: "Thought: hello<END>"}
+	examples := []Example[*Str, *Str]{
+		{
+			Input:             newStr("hi"),
+			IntermediarySteps: []*engines.ChatMessage{step},
+			Answer:            newStr("hello"),
+		},
+	}
+	testCases := []struct {
+		name      string
+		templates *PromptTemplates
+		tools     map[string]tools.Tool
+		expected  []*engines.ChatMessage
+		expectErr string
+	}{
+		{
+			name:  "default",
+			tools: map[string]tools.Tool{"echo": echo, "add": add},
+			expected: []*engines.ChatMessage{
+				{
+					Role: engines.ConvRoleSystem,
+					Text: "You are a smart, autonomous agent given the task below. " +
+						"You will be given input from the user in the following format:\n\n" +
+						"<some text>\n\n Complete the task step-by-step, " +
+						"reasoning about your solution steps by sending thought messages in format " +
+						"`Thought: (your reflection)<END>`. When you are ready to return your response, " +
+						"send an answer message in format `Answer: <some text><END>`. Remember: you are on your own - " +
+						"do not ask for any clarifications, except by using appropriate tools " +
+						"that enable interaction with the user. You should determine when you are " +
+						"done with the task, and return your answer.",
+				},
+				{
+					Role: engines.ConvRoleSystem,
+					Text: "Here are some tools you can use. To use a tool, " +
+						"send a message in the form of `Action: tool_name(args)<END>`, " +
+						"where `args` is a valid one-line JSON representation of the arguments" +
+						" to the tool, as specified for it. You will get " +
+						"the output in " +
+						"a message beginning with `Observation: `, or an error message beginning " +
+						"with `Error: `.\n\nTools:\n" +
+						"add({\"a\": 1, \"b\": 2}) # Adds numbers.\n" +
+						"echo({\"text\": \"the text\"}) # Echoes the input.",
+				},
+				{Role: engines.ConvRoleUser, Text: "Greet the user."},
+				{Role: engines.ConvRoleUser, Text: "hi"},
+				step,
+				{Role: engines.ConvRoleAssistant, Text: fmt.Sprintf(MessageFormat, AnswerCode, "hello")},
+				{Role: engines.ConvRoleUser, Text: "hey"},
+			},
+		},
+		{
+			name: "partial templates",
+			templates: &PromptTemplates{
+				System:        "Entrée : {{.InputSchema}}. Réponse : {{.Markers.Answer}}: {{.AnswerSchema}}{{.Markers.End}}",
+				Input:         "Entrée : {{.Input}}",
+				ExampleAnswer: "{{.Markers.Answer}}: {{.Answer}} ({{len .Examples}} exemple){{.Markers.End}}",
+			},
+			expected: []*engines.ChatMessage{
+				{Role: engines.ConvRoleSystem, Text: "Entrée : <some text>. Réponse : Answer: <some text><END>"},
+				{Role: engines.ConvRoleUser, Text: "Greet the user."},
+				{Role: engines.ConvRoleUser, Text: "Entrée : hi"},
+				step,
+				{Role: engines.ConvRoleAssistant, Text: "Answer: hello (1 exemple)<END>"},
+				{Role: engines.ConvRoleUser, Text: "Entrée : hey"},
+			},
+		},
+		{
+			name:      "invalid template",
+			templates: &PromptTemplates{Task: "{{.Description"},
+			expectErr: "invalid task template",
+		},
+		{
+			name:      "unknown field",
+			templates: &PromptTemplates{Task: "{{.Goal}}"},
+			expectErr: "invalid task template",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := &Task[*Str, *Str]{
+				Description: "Greet the user.",
+				Examples:    examples,
+			}
+			if tc.templates != nil {
+				templates, err := ParsePromptTemplates(tc.templates)
+				if tc.expectErr != "" {
+					assert.ErrorContains(t, err, tc.expectErr)
+					return
+				}
+				require.NoError(t, err)
+				task.Templates = templates
+			}
+			prompt, err := task.compile(newStr("hey"), tc.tools)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, prompt.History)
+			assert.Equal(t, tc.expected, task.Compile(newStr("hey"), tc.tools).History)
+		})
+	}
+}
+
+func TestTaskCompileFallback(t *testing.T) {
+	// Valid for tasks with examples only
+	templates, err := ParsePromptTemplates(&PromptTemplates{Task: "Like {{(index .Examples 0).Answer}}"})
+	require.NoError(t, err)
+	task := &Task[*Str, *Str]{Description: "Greet the user.", Templates: templates}
+	_, err = task.compile(newStr("hey"), nil)
+	assert.ErrorContains(t, err, "failed to execute task template")
+	var prompt *engines.ChatPrompt
+	require.NotPanics(t, func() { prompt = task.Compile(newStr("hey"), nil) })
+	require.Len(t, prompt.History, 3)
+	assert.Equal(t, "Greet the user.", prompt.History[1].Text)
+}
+
+func TestPromptPresets(t *testing.T) {
+	concise, err := PromptPreset(PromptPresetConcise)
+	require.NoError(t, err)
+	task := &Task[*Str, *Str]{Description: "Greet the user.", Templates: concise}
+	prompt := task.Compile(newStr("hey"), nil)
+	require.Len(t, prompt.History, 3)
+	assert.Equal(t, "Solve the task below step by step. Input format: <some text>\n"+
+		"Think with `Thought: ...<END>`. Answer with `Answer: <END>`. Do not ask for clarifications.", prompt.History[0].Text)
+	assert.Equal(t, "Greet the user.", prompt.History[1].Text)
+
+	require.NoError(t, RegisterPromptPreset("test", &PromptTemplates{Task: "Task: {{.Description}}"}))
+	preset, err := PromptPreset("test")
+	require.NoError(t, err)
+	assert.Equal(t, "Task: {{.Description}}", preset.Templates().Task)
+	assert.Equal(t, concise.Templates().Input, preset.Templates().Input)
+	assert.ErrorContains(t, RegisterPromptPreset("invalid", &PromptTemplates{Task: "{{.Goal}}"}), "invalid task template")
+	_, err = PromptPreset("invalid")
+	assert.Error(t, err)
+
+	_, err = PromptPreset("unknown")
+	assert.EqualError(t, err, `prompt preset "unknown" not found`)
+}
@@ -0,0 +1,105 @@
+package agents
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/natexcvi/go-llm/engines"
+)
+
+var (
+	streamPrefixRegex           = regexp.MustCompile(`^\s*(?P<code>[A-Za-z]+):[ \t]*`)
+	streamIncompletePrefixRegex = regexp.MustCompile(`^\s*[A-Za-z]*$`)
+)
+
+// A piece of an agent response, emitted
+// while the response is being streamed.
+type ChainAgentStreamChunk struct {
+	// The code of the operation the text
+	// belongs to, e.g. ThoughtCode.
+	Code string
+	Text string
+}
+
+// streamParser splits streamed response text into
+// operations, emitting their content without the
+// operation prefixes and end markers.
+type streamParser struct {
+	handler func(chunk *ChainAgentStreamChunk)
+	buffer  string
+	code    string
+}
+
+func newStreamParser(handler func(chunk *ChainAgentStreamChunk)) *streamParser {
+	return &streamParser{handler: handler}
+}
+
+func (p *streamParser) emit(text string) {
+	if text == "" {
+		return
+	}
+	p.handler(&ChainAgentStreamChunk{
+		Code: p.code,
+		Text: text,
+	})
+}
+
+func (p *streamParser) write(delta *engines.ChatMessage) {
+	p.buffer += delta.Text
+	for {
+		if p.code == "" {
+			if match := streamPrefixRegex.FindStringSubmatch(p.buffer); match != nil && isStreamedCode(match[streamPrefixRegex.SubexpIndex("code")]) {
+				p.code = match[streamPrefixRegex.SubexpIndex("code")]
+				p.buffer = p.buffer[len(match[0]):]
+				continue
+			}
+			if streamIncompletePrefixRegex.MatchString(p.buffer) {
+				return
+			}
+			p.code = ThoughtCode // consider the message a thought
+		}
+		if idx := strings.Index(p.buffer, EndMarker); idx >= 0 {
+			p.emit(p.buffer[:idx])
+			p.buffer = p.buffer[idx+len(EndMarker):]
+			p.code = ""
+			continue
+		}
+		held := partialSuffixLength(p.buffer, EndMarker)
+		p.emit(p.buffer[:len(p.buffer)-held])
+		p.buffer = p.buffer[len(p.buffer)-held:]
+		return
+	}
+}
+
+// flush emits any text held back while waiting
+// for a possible end marker.
+func (p *streamParser) flush() {
+	if p.code == "" && strings.TrimSpace(p.buffer) != "" {
+		p.code = ThoughtCode
+	}
+	if p.code != "" {
+		p.emit(p.buffer)
+	}
+	p.buffer = ""
+	p.code = ""
+}
+
+func isStreamedCode(code string) bool {
+	switch code {
+	case ThoughtCode, ActionCode, AnswerCode:
+		return true
+	default:
+		return false
+	}
+}
+
+// partialSuffixLength returns the length of the longest
+// suffix of s that is a proper prefix of marker.
+func partialSuffixLength(s, marker string) int {
+	for n := len(marker) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
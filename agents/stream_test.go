@@ -0,0 +1,112 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type MockStreamingEngine struct {
+	MockEngine
+	Deltas [][]string
+}
+
+func (engine *MockStreamingEngine) ChatStream(ctx context.Context, prompt *engines.ChatPrompt, functions []engines.FunctionSpecs, onDelta func(delta *engines.ChatMessage)) (*engines.ChatMessage, error) {
+	deltas := engine.Deltas[0]
+	engine.Deltas = engine.Deltas[1:]
+	for _, delta := range deltas {
+		onDelta(&engines.ChatMessage{Text: delta})
+	}
+	return engine.Chat(prompt)
+}
+
+func TestStreamParser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		deltas   []string
+		expected []ChainAgentStreamChunk
+	}{
+		{
+			name:   "thought and answer",
+			deltas: []string{"Thou", "ght: I ", "know<E", "ND>\nAns", "wer: 42<END>"},
+			expected: []ChainAgentStreamChunk{
+				{Code: ThoughtCode, Text: "I "},
+				{Code: ThoughtCode, Text: "know"},
+				{Code: AnswerCode, Text: "42"},
+			},
+		},
+		{
+			name:   "no operation prefix",
+			deltas: []string{"Hello", " there"},
+			expected: []ChainAgentStreamChunk{
+				{Code: ThoughtCode, Text: "Hello there"},
+			},
+		},
+		{
+			name:   "unknown prefix is a thought",
+			deltas: []string{"Note: <", "b>"},
+			expected: []ChainAgentStreamChunk{
+				{Code: ThoughtCode, Text: "Note: "},
+				{Code: ThoughtCode, Text: "<b>"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var chunks []ChainAgentStreamChunk
+			parser := newStreamParser(func(chunk *ChainAgentStreamChunk) {
+				chunks = append(chunks, *chunk)
+			})
+			for _, delta := range tc.deltas {
+				parser.write(&engines.ChatMessage{Text: delta})
+			}
+			parser.flush()
+			assert.Equal(t, tc.expected, chunks)
+		})
+	}
+}
+
+func TestChainAgentStreaming(t *testing.T) {
+	var chunks []ChainAgentStreamChunk
+	agent := NewChainAgent[*Str, *Str](&MockStreamingEngine{
+		MockEngine: MockEngine{
+			Responses: []*engines.ChatMessage{
+				{
+					Role: engines.ConvRoleAssistant,
+					Text: `Thought: greet<END>`,
+				},
+				{
+					Role: engines.ConvRoleAssistant,
+					Text: `Answer: "Hello world"<END>`,
+				},
+			},
+		},
+		Deltas: [][]string{
+			{"Thought: gr", "eet<END>"},
+			{`Answer: "Hello`, ` world"<END>`},
+		},
+	}, &Task[*Str, *Str]{
+		Description: "Say hello to an entity you find yourself",
+		AnswerParser: func(text string) (*Str, error) {
+			var output string
+			err := json.Unmarshal([]byte(text), &output)
+			require.NoError(t, err)
+			return newStr(output), nil
+		},
+	}, newMockMemory(t)).WithStreamHandler(func(chunk *ChainAgentStreamChunk) {
+		chunks = append(chunks, *chunk)
+	})
+	output, err := agent.Run(newStr("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", string(*output))
+	assert.Equal(t, []ChainAgentStreamChunk{
+		{Code: ThoughtCode, Text: "gr"},
+		{Code: ThoughtCode, Text: "eet"},
+		{Code: AnswerCode, Text: `"Hello`},
+		{Code: AnswerCode, Text: ` world"`},
+	}, chunks)
+}
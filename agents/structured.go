@@ -0,0 +1,90 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/natexcvi/go-llm/engines"
+	log "github.com/sirupsen/logrus"
+)
+
+// Structured makes any JSON-encodable value Representable.
+// It is encoded as the JSON of the value, and its schemas are
+// derived from the struct tags of V, as described by
+// engines.SchemaOf. The schemas of types that SchemaOf
+// rejects allow any value.
+type Structured[V any] struct {
+	Value V
+}
+
+func NewStructured[V any](value V) Structured[V] {
+	return Structured[V]{Value: value}
+}
+
+func (s Structured[V]) Encode() string {
+	return EncodeJSON(s.Value)
+}
+
+func (s Structured[V]) Schema() string {
+	return PromptSchemaOf(s.Value)
+}
+
+// JSONSchema returns the JSON schema of the value, e.g.
+// for ChainAgent.WithStructuredAnswer.
+func (s Structured[V]) JSONSchema() *engines.ParameterSpecs {
+	schema, err := engines.SchemaOf(s.Value)
+	if err != nil {
+		log.Warnf("failed to derive the schema of %T, allowing any value: %v", s.Value, err)
+		return &engines.ParameterSpecs{}
+	}
+	return schema
+}
+
+func (s Structured[V]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Value)
+}
+
+func (s *Structured[V]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &s.Value)
+}
+
+// EncodeJSON encodes v as JSON, for the Encode method
+// of Representable types. Unlike json.Marshal, it does
+// not escape HTML characters, which models read as is.
+// Values that cannot be encoded as JSON are formatted
+// with fmt instead.
+func EncodeJSON(v any) string {
+	var encoded strings.Builder
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		log.Warnf("failed to encode %T as JSON: %v", v, err)
+		return fmt.Sprintf("%+v", v)
+	}
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
+
+// ParseJSON is an AnswerParser for answers
+// that are the JSON encoding of S.
+func ParseJSON[S any](text string) (S, error) {
+	var answer S
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &answer); err != nil {
+		return answer, fmt.Errorf("invalid answer: %w", err)
+	}
+	return answer, nil
+}
+
+// PromptSchemaOf returns the fuzzy schema of v's type
+// used in prompts, which shows the JSON encoding of v
+// with descriptions in place of the values, e.g.
+// {"stocks": ["stock tickers"]}. Types that SchemaOf
+// rejects are described as "any value".
+func PromptSchemaOf(v any) string {
+	schema, err := engines.SchemaOf(v)
+	if err != nil {
+		log.Warnf("failed to derive the schema of %T: %v", v, err)
+		return "any value"
+	}
+	return string(engines.FuzzySchema(schema))
+}
@@ -0,0 +1,55 @@
+package agents
+
+import (
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type structuredTestForecast struct {
+	City   string            `json:"city" description:"the city"`
+	Days   []string          `json:"days" description:"forecast for each day" enum:"sunny,rainy"`
+	Alerts map[string]string `json:"alerts,omitempty" description:"alert <message>, by region"`
+	Source *string           `json:"source,omitempty"`
+}
+
+func TestStructured(t *testing.T) {
+	forecast := NewStructured(structuredTestForecast{
+		City:   "Paris",
+		Days:   []string{"sunny"},
+		Alerts: map[string]string{"north": "wind > 50km/h"},
+	})
+
+	assert.Equal(t, `{"city":"Paris","days":["sunny"],"alerts":{"north":"wind > 50km/h"}}`, forecast.Encode())
+	assert.Equal(t,
+		`{"alerts":{"<key>":"alert <message>, by region"},"city":"the city","days":["forecast for each day (sunny/rainy)"],"source":"string"}`,
+		forecast.Schema(),
+	)
+	schema := forecast.JSONSchema()
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"city", "days"}, schema.Required)
+
+	parsed, err := ParseJSON[Structured[structuredTestForecast]](" \n" + forecast.Encode() + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, forecast, parsed)
+	_, err = ParseJSON[Structured[structuredTestForecast]]("The forecast is sunny")
+	assert.ErrorContains(t, err, "invalid answer")
+}
+
+func TestStructuredUnsupportedTypes(t *testing.T) {
+	// SchemaOf rejects maps with struct keys,
+	// which JSON cannot encode either
+	type key struct{ X, Y int }
+	value := NewStructured(map[key]string{{X: 1, Y: 2}: "point"})
+	assert.NotPanics(t, func() {
+		assert.Equal(t, "any value", value.Schema())
+		assert.Equal(t, "map[{X:1 Y:2}:point]", value.Encode())
+		assert.Equal(t, &engines.ParameterSpecs{}, value.JSONSchema())
+	})
+	task := &Task[Structured[map[key]string], Structured[map[key]string]]{Description: "Name the points"}
+	prompt, err := task.compile(value, nil)
+	require.NoError(t, err)
+	assert.Contains(t, prompt.History[0].Text, "any value")
+}
@@ -1,12 +1,11 @@
 package agents
 
 import (
-	"fmt"
-	"strings"
+	"text/template"
 
 	"github.com/natexcvi/go-llm/engines"
 	"github.com/natexcvi/go-llm/tools"
-	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
 )
 
 type Representable interface {
@@ -24,81 +23,90 @@ type Task[T Representable, S Representable] struct {
 	Description  string
 	Examples     []Example[T, S]
 	AnswerParser func(string) (S, error)
+	// The templates of the prompt, if not those of the
+	// default preset. See ParsePromptTemplates.
+	Templates *ParsedPromptTemplates
 }
 
+// Compile generates the prompt of the task for the input.
+// If the task's templates fail on the input, it logs a
+// warning and uses the built-in default templates instead.
 func (task *Task[T, S]) Compile(input T, tools map[string]tools.Tool) *engines.ChatPrompt {
-	answerSchema := lo.IfF(
-		task.Examples != nil && len(task.Examples) > 0,
-		func() string { return task.Examples[0].Answer.Schema() },
-	).Else("")
-
-	prompt := &engines.ChatPrompt{
-		History: []*engines.ChatMessage{
-			{
-				Role: engines.ConvRoleSystem,
-				Text: fmt.Sprintf("You are a smart, autonomous agent given the task below. "+
-					"You will be given input from the user in the following format:\n\n"+
-					"%s\n\n Complete the task step-by-step, "+
-					"reasoning about your solution steps by sending thought messages in format "+
-					"`%s: (your reflection)%s`. When you are ready to return your response, "+
-					"send an answer message in format `%s: %s%s`. Remember: you are on your own - "+
-					"do not ask for any clarifications, except by using appropriate tools "+
-					"that enable interaction with the user. You should determine when you are "+
-					"done with the task, and return your answer.",
-					input.Schema(), ThoughtCode, EndMarker, AnswerCode, answerSchema, EndMarker),
-			},
-		},
+	prompt, err := task.compile(input, tools)
+	if err != nil {
+		log.Warnf("falling back to the default prompt templates: %v", err)
+		prompt, _ = task.compileWith(builtinPromptTemplates, input, tools)
 	}
-	task.enrichPromptWithTools(tools, prompt)
-	prompt.History = append(prompt.History, &engines.ChatMessage{
-		Role: engines.ConvRoleUser,
-		Text: task.Description,
-	})
-	task.enrichPromptWithExamples(prompt)
-	prompt.History = append(prompt.History, &engines.ChatMessage{
-		Role: engines.ConvRoleUser,
-		Text: input.Encode(),
-	})
 	return prompt
 }
 
-func (task *Task[T, S]) enrichPromptWithExamples(prompt *engines.ChatPrompt) {
-	if len(task.Examples) == 0 {
-		return
+func (task *Task[T, S]) compile(input T, tools map[string]tools.Tool) (*engines.ChatPrompt, error) {
+	templates := task.Templates
+	if templates == nil {
+		var err error
+		if templates, err = PromptPreset(PromptPresetDefault); err != nil {
+			return nil, err
+		}
 	}
-	for _, example := range task.Examples {
-		prompt.History = append(prompt.History, &engines.ChatMessage{
-			Role: engines.ConvRoleUser,
-			Text: example.Input.Encode(),
-		})
-		for _, step := range example.IntermediarySteps {
-			prompt.History = append(prompt.History, step)
+	return task.compileWith(templates, input, tools)
+}
+
+func (task *Task[T, S]) compileWith(templates *ParsedPromptTemplates, input T, tools map[string]tools.Tool) (*engines.ChatPrompt, error) {
+	data := task.promptData(input, tools)
+	prompt := &engines.ChatPrompt{}
+	add := func(role engines.ConvRole, tmpl *template.Template, data PromptData) error {
+		message, err := executeTemplate(tmpl, data)
+		if err != nil {
+			return err
+		}
+		prompt.History = append(prompt.History, &engines.ChatMessage{Role: role, Text: message})
+		return nil
+	}
+	if err := add(engines.ConvRoleSystem, templates.system, data); err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		if err := add(engines.ConvRoleSystem, templates.tools, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(engines.ConvRoleUser, templates.task, data); err != nil {
+		return nil, err
+	}
+	for _, example := range data.Examples {
+		exampleData := data
+		exampleData.Input, exampleData.Answer = example.Input, example.Answer
+		if err := add(engines.ConvRoleUser, templates.input, exampleData); err != nil {
+			return nil, err
+		}
+		prompt.History = append(prompt.History, example.Steps...)
+		if err := add(engines.ConvRoleAssistant, templates.exampleAnswer, exampleData); err != nil {
+			return nil, err
 		}
-		answerRepresentation := example.Answer.Encode()
-		prompt.History = append(prompt.History, &engines.ChatMessage{
-			Role: engines.ConvRoleAssistant,
-			Text: fmt.Sprintf(MessageFormat, AnswerCode, answerRepresentation),
-		})
 	}
+	data.Input = input.Encode()
+	if err := add(engines.ConvRoleUser, templates.input, data); err != nil {
+		return nil, err
+	}
+	return prompt, nil
 }
 
-func (*Task[T, S]) enrichPromptWithTools(tools map[string]tools.Tool, prompt *engines.ChatPrompt) {
-	if len(tools) == 0 {
-		return
+func (task *Task[T, S]) promptData(input T, tools map[string]tools.Tool) PromptData {
+	data := PromptData{
+		Description: task.Description,
+		InputSchema: input.Schema(),
+		Tools:       promptTools(tools),
+		Markers:     defaultMarkers(),
+	}
+	if len(task.Examples) > 0 {
+		data.AnswerSchema = task.Examples[0].Answer.Schema()
 	}
-	toolsList := make([]string, 0, len(tools))
-	for name, tool := range tools {
-		toolsList = append(toolsList, fmt.Sprintf("%s(%s) # %s", name, tool.ArgsSchema(), tool.Description()))
+	for _, example := range task.Examples {
+		data.Examples = append(data.Examples, PromptExample{
+			Input:  example.Input.Encode(),
+			Answer: example.Answer.Encode(),
+			Steps:  example.IntermediarySteps,
+		})
 	}
-	prompt.History = append(prompt.History, &engines.ChatMessage{
-		Role: engines.ConvRoleSystem,
-		Text: fmt.Sprintf("Here are some tools you can use. To use a tool, "+
-			"send a message in the form of `%s: tool_name(args)%s`, "+
-			"where `args` is a valid one-line JSON representation of the arguments"+
-			" to the tool, as specified for it. You will get "+
-			"the output in "+
-			"a message beginning with `%s: `, or an error message beginning "+
-			"with `%s: `.\n\nTools:\n%s",
-			ActionCode, EndMarker, ObservationCode, ErrorCode, strings.Join(toolsList, "\n")),
-	})
+	return data
 }
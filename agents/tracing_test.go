@@ -0,0 +1,73 @@
+package agents
+
+import (
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/memory"
+	"github.com/natexcvi/go-llm/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestChainAgentTracing(t *testing.T) {
+	exporter := newTestTracerProvider(t)
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{Role: engines.ConvRoleAssistant, Text: `Action: smart_agent({"task": "say hi", "input": "bob"})<END>`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: hi bob`},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: done`},
+		},
+	}
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Delegate",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, memory.NewBufferedMemory(10)).WithTools(NewGenericAgentTool(engine, []tools.Tool{}))
+
+	_, err := agent.Run(newStr("hi"))
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	require.Len(t, byName["ChainAgent.Run"], 2)
+	require.Len(t, byName["execute_tool smart_agent"], 1)
+	assert.Len(t, byName["JSONAutoFixer.Process"], 1)
+	assert.NotEmpty(t, byName["Memory.Add"])
+	assert.NotEmpty(t, byName["Memory.AddPrompt"])
+	assert.NotEmpty(t, byName["Memory.Prompt"])
+
+	// the sub-agent's run is nested under the tool
+	// execution, which is nested under the parent run
+	var parentRun, subRun tracetest.SpanStub
+	for _, run := range byName["ChainAgent.Run"] {
+		if run.Parent.IsValid() {
+			subRun = run
+		} else {
+			parentRun = run
+		}
+	}
+	toolSpan := byName["execute_tool smart_agent"][0]
+	assert.Equal(t, parentRun.SpanContext.SpanID(), toolSpan.Parent.SpanID())
+	assert.Equal(t, toolSpan.SpanContext.SpanID(), subRun.Parent.SpanID())
+	for _, span := range spans {
+		assert.Equal(t, parentRun.SpanContext.TraceID(), span.SpanContext.TraceID())
+	}
+}
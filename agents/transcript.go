@@ -0,0 +1,216 @@
+package agents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/natexcvi/go-llm/engines"
+)
+
+type TranscriptEventType string
+
+const (
+	TranscriptPrompt      TranscriptEventType = "prompt"
+	TranscriptResponse    TranscriptEventType = "response"
+	TranscriptThought     TranscriptEventType = "thought"
+	TranscriptAction      TranscriptEventType = "action"
+	TranscriptObservation TranscriptEventType = "observation"
+	TranscriptError       TranscriptEventType = "error"
+	TranscriptAnswer      TranscriptEventType = "answer"
+	TranscriptRestart     TranscriptEventType = "restart"
+)
+
+// A single step of an agent run.
+type TranscriptEvent struct {
+	Type TranscriptEventType `json:"type"`
+	Time time.Time           `json:"time"`
+	// The nesting depth of the agent that produced
+	// the event, see AgentDepth.
+	Depth int `json:"depth,omitempty"`
+	// The prompt sent to the engine, or
+	// the response it returned.
+	Messages []*engines.ChatMessage `json:"messages,omitempty"`
+	// The token usage of a response.
+	Usage      *engines.Usage  `json:"usage,omitempty"`
+	Tool       string          `json:"tool,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+	// The text of a thought, observation, error or
+	// answer, or the error that caused a restart.
+	Content string `json:"content,omitempty"`
+	// Why the engine stopped generating a response.
+	FinishReason string `json:"finish_reason,omitempty"`
+	// How long the tool took to execute,
+	// or the engine took to respond.
+	Latency time.Duration `json:"latency,omitempty"`
+	// The number of the attempt a restart starts.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// A Transcript records the full trajectory of agent runs,
+// including those of agents started by GenericAgentTool.
+// Register it with ChainAgent.WithObservers. It is safe
+// for concurrent use.
+type Transcript struct {
+	mu     sync.Mutex
+	events []*TranscriptEvent
+}
+
+func NewTranscript() *Transcript {
+	return &Transcript{}
+}
+
+// Events returns the events recorded so far,
+// in the order they happened.
+func (t *Transcript) Events() []*TranscriptEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*TranscriptEvent{}, t.events...)
+}
+
+// Usage returns the total token usage of
+// the responses in the transcript.
+func (t *Transcript) Usage() engines.Usage {
+	var total engines.Usage
+	for _, event := range t.Events() {
+		if event.Usage != nil {
+			total.PromptTokens += event.Usage.PromptTokens
+			total.CompletionTokens += event.Usage.CompletionTokens
+		}
+	}
+	return total
+}
+
+func (t *Transcript) record(ctx context.Context, event *TranscriptEvent) {
+	event.Time = time.Now().UTC()
+	event.Depth = AgentDepth(ctx)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+// withoutMetadata copies the messages without their
+// metadata, which is not serialized. The usage of
+// a response is recorded in its event instead.
+func withoutMetadata(messages ...*engines.ChatMessage) []*engines.ChatMessage {
+	copies := make([]*engines.ChatMessage, len(messages))
+	for i, msg := range messages {
+		msgCopy := *msg
+		msgCopy.Metadata = nil
+		copies[i] = &msgCopy
+	}
+	return copies
+}
+
+func (t *Transcript) OnPrompt(ctx context.Context, prompt *engines.ChatPrompt) {
+	t.record(ctx, &TranscriptEvent{
+		Type:     TranscriptPrompt,
+		Messages: withoutMetadata(prompt.History...),
+	})
+}
+
+func (t *Transcript) OnResponse(ctx context.Context, response *engines.ChatMessage) {
+	event := &TranscriptEvent{
+		Type:     TranscriptResponse,
+		Messages: withoutMetadata(response),
+	}
+	if response.Metadata != nil {
+		usage := response.Metadata.Usage
+		event.Usage = &usage
+		event.FinishReason = response.Metadata.FinishReason
+		event.Latency = response.Metadata.Latency
+	}
+	t.record(ctx, event)
+}
+
+func (t *Transcript) OnThought(ctx context.Context, thought *ChainAgentThought) {
+	t.record(ctx, &TranscriptEvent{
+		Type:    TranscriptThought,
+		Content: thought.Content,
+	})
+}
+
+func (t *Transcript) OnAction(ctx context.Context, action *ChainAgentAction) {
+	t.record(ctx, &TranscriptEvent{
+		Type:       TranscriptAction,
+		Tool:       action.Tool.Name(),
+		ToolCallID: action.ID,
+		Args:       action.Args,
+	})
+}
+
+func (t *Transcript) OnObservation(ctx context.Context, action *ChainAgentAction, observation *ChainAgentObservation) {
+	t.record(ctx, &TranscriptEvent{
+		Type:       TranscriptObservation,
+		Tool:       observation.ToolName,
+		ToolCallID: observation.ToolCallID,
+		Content:    observation.Content,
+		Latency:    observation.Latency,
+	})
+}
+
+func (t *Transcript) OnError(ctx context.Context, action *ChainAgentAction, err *ChainAgentError) {
+	t.record(ctx, &TranscriptEvent{
+		Type:       TranscriptError,
+		Tool:       err.ToolName,
+		ToolCallID: err.ToolCallID,
+		Content:    err.Content,
+		Latency:    err.Latency,
+	})
+}
+
+func (t *Transcript) OnAnswer(ctx context.Context, answer Representable) {
+	t.record(ctx, &TranscriptEvent{
+		Type:    TranscriptAnswer,
+		Content: answer.Encode(),
+	})
+}
+
+func (t *Transcript) OnRestart(ctx context.Context, attempt int, err error) {
+	t.record(ctx, &TranscriptEvent{
+		Type:    TranscriptRestart,
+		Attempt: attempt,
+		Content: err.Error(),
+	})
+}
+
+func (t *Transcript) OnMemoryUpdate(context.Context, []*engines.ChatMessage) {}
+
+// WriteJSONL writes the events to w,
+// one JSON object per line.
+func (t *Transcript) WriteJSONL(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range t.Events() {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadTranscriptJSONL reads a transcript
+// written by WriteJSONL.
+func ReadTranscriptJSONL(r io.Reader) (*Transcript, error) {
+	transcript := NewTranscript()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event TranscriptEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid transcript event on line %d: %w", line, err)
+		}
+		transcript.events = append(transcript.events, &event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return transcript, nil
+}
@@ -0,0 +1,77 @@
+package agents
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscript(t *testing.T) {
+	usage := &engines.ResponseMetadata{Usage: engines.Usage{PromptTokens: 10, CompletionTokens: 2}}
+	engine := &MockEngine{
+		Responses: []*engines.ChatMessage{
+			{Role: engines.ConvRoleAssistant, Text: `Thought: let me sleep<END>Action: sleep("zzz")<END>`, Metadata: usage},
+			{Role: engines.ConvRoleAssistant, Text: `Action: fail("x")<END>`, Metadata: usage},
+			{Role: engines.ConvRoleAssistant, Text: `Answer: rested`, Metadata: usage},
+		},
+	}
+	transcript := NewTranscript()
+	agent := NewChainAgent[*Str, *Str](engine, &Task[*Str, *Str]{
+		Description: "Rest",
+		AnswerParser: func(text string) (*Str, error) {
+			return newStr(text), nil
+		},
+	}, newMockMemory(t)).WithTools(
+		newMockTool(t, "sleep", "sleeps", json.RawMessage(`"a string"`),
+			func(args json.RawMessage) (json.RawMessage, error) {
+				time.Sleep(5 * time.Millisecond)
+				return args, nil
+			},
+		),
+		newMockTool(t, "fail", "always fails", json.RawMessage(`"a string"`),
+			func(args json.RawMessage) (json.RawMessage, error) { return nil, errors.New("boom") },
+		),
+	).WithObservers(transcript)
+	agent.ActionArgPreprocessors = nil
+
+	_, err := agent.Run(newStr("tired"))
+	require.NoError(t, err)
+
+	events := transcript.Events()
+	var types []TranscriptEventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []TranscriptEventType{
+		TranscriptPrompt, TranscriptResponse, TranscriptThought, TranscriptAction, TranscriptObservation,
+		TranscriptPrompt, TranscriptResponse, TranscriptAction, TranscriptError,
+		TranscriptPrompt, TranscriptResponse, TranscriptAnswer,
+	}, types)
+	assert.Equal(t, engines.Usage{PromptTokens: 30, CompletionTokens: 6}, transcript.Usage())
+	assert.Equal(t, "sleep", events[3].Tool)
+	assert.Equal(t, json.RawMessage(`"zzz"`), events[3].Args)
+	assert.GreaterOrEqual(t, events[4].Latency, 5*time.Millisecond)
+	assert.Equal(t, "boom", events[8].Content)
+	assert.Equal(t, "rested", events[11].Content)
+	for i := 1; i < len(events); i++ {
+		assert.False(t, events[i].Time.Before(events[i-1].Time))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, transcript.WriteJSONL(&buf))
+	assert.Equal(t, len(events), bytes.Count(buf.Bytes(), []byte("\n")))
+	restored, err := ReadTranscriptJSONL(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, events, restored.Events())
+}
+
+func TestReadTranscriptJSONLInvalidLine(t *testing.T) {
+	_, err := ReadTranscriptJSONL(bytes.NewBufferString("{\"type\": \"thought\"}\nnot json\n"))
+	require.ErrorContains(t, err, "invalid transcript event on line 2")
+}
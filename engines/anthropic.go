@@ -0,0 +1,364 @@
+package engines
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	AnthropicBaseURL = "https://api.anthropic.com"
+	AnthropicVersion = "2023-06-01"
+)
+
+// An engine for Anthropic's Messages API.
+type Claude struct {
+	APIKey               string
+	Model                string
+	MaxTokens            int
+	Temperature          float64
+	BaseURL              string
+	HTTPClient           *http.Client
+	PromptTokensUsed     atomic.Int64
+	CompletionTokensUsed atomic.Int64
+	// Options applied to every request, which those
+	// of the request's context override. MaxTokens
+	// overrides the engine's MaxTokens.
+	Generation GenerationOptions
+	// Whether agents offer tools to the model natively,
+	// rather than through their text protocol. Defaults
+	// to true.
+	ToolCalling *bool
+}
+
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema *ParameterSpecs `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	System        string               `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Temperature   float64              `json:"temperature"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	TopP          float64              `json:"top_p,omitempty"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// encodeToolChoice converts the tool choice to Anthropic's,
+// whose "any" is OpenAI's "required".
+func encodeToolChoice(choice *ToolChoice) *anthropicToolChoice {
+	switch {
+	case choice == nil:
+		return nil
+	case choice.Function != "":
+		return &anthropicToolChoice{Type: "tool", Name: choice.Function}
+	case choice.Mode == "required":
+		return &anthropicToolChoice{Type: "any"}
+	default:
+		return &anthropicToolChoice{Type: choice.Mode}
+	}
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// encodeMessages converts the chat history to Anthropic
+// messages. System messages preceding the conversation
+// are hoisted into the system prompt, while later ones
+// are sent as user messages, since the Messages API has
+// no system role. Consecutive messages with the same
+// role are merged.
+func (claude *Claude) encodeMessages(history []*ChatMessage) (system string, messages []anthropicMessage) {
+	history = normalizeToolCalls(history)
+	var systemParts []string
+	i := 0
+	for ; i < len(history) && history[i].Role == ConvRoleSystem; i++ {
+		systemParts = append(systemParts, history[i].Text)
+	}
+	for ; i < len(history); i++ {
+		msg := history[i]
+		role := "user"
+		var blocks []anthropicContentBlock
+		switch {
+		case msg.Role == ConvRoleAssistant:
+			role = "assistant"
+			if msg.Text != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Text})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Args)
+				if !json.Valid(input) {
+					input = json.RawMessage(`{}`)
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+		case msg.Role == ConvRoleTool:
+			blocks = append(blocks, anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Text,
+			})
+		case msg.Text != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Text})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+			continue
+		}
+		messages = append(messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	return strings.Join(systemParts, "\n\n"), messages
+}
+
+func (claude *Claude) decodeResponse(response *anthropicResponse) *ChatMessage {
+	message := &ChatMessage{Role: ConvRoleAssistant}
+	var text []string
+	var calls []*ToolCall
+	for _, block := range response.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			calls = append(calls, &ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: FunctionCall{
+					Name: block.Name,
+					Args: string(block.Input),
+				},
+			})
+		}
+	}
+	message.Text = strings.Join(text, "")
+	message.setToolCalls(calls)
+	return message
+}
+
+func (claude *Claude) chat(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return instrumentChat(ctx, "anthropic", claude.Model, prompt, functions, func(ctx context.Context) (*ChatMessage, ResponseMetadata, error) {
+		return claude.sendChat(ctx, prompt, functions)
+	})
+}
+
+func (claude *Claude) sendChat(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, ResponseMetadata, error) {
+	system, messages := claude.encodeMessages(prompt.History)
+	options := claude.Generation.merge(GenerationOptionsFromContext(ctx))
+	request := anthropicRequest{
+		Model:         claude.Model,
+		MaxTokens:     claude.MaxTokens,
+		System:        system,
+		Messages:      messages,
+		Temperature:   claude.Temperature,
+		StopSequences: options.Stop,
+		TopP:          options.TopP,
+	}
+	if options.MaxTokens != 0 {
+		request.MaxTokens = options.MaxTokens
+	}
+	for _, function := range functions {
+		inputSchema := function.Parameters
+		if inputSchema == nil {
+			inputSchema = &ParameterSpecs{Type: "object"}
+		}
+		request.Tools = append(request.Tools, anthropicTool{
+			Name:        function.Name,
+			Description: function.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	if len(request.Tools) > 0 {
+		request.ToolChoice = encodeToolChoice(options.ToolChoice)
+	}
+	bodyJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", claude.baseURL()+"/v1/messages", bytes.NewBuffer(bodyJSON))
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	req.Header.Set("x-api-key", claude.APIKey)
+	req.Header.Set("anthropic-version", AnthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+	client := claude.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		apiErr := newAPIError(res)
+		if strings.Contains(apiErr.Message, "prompt is too long") {
+			apiErr.Code = "context_length_exceeded"
+		}
+		return nil, ResponseMetadata{}, apiErr
+	}
+	var response anthropicResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	metadata := ResponseMetadata{
+		Usage: Usage{
+			PromptTokens:     response.Usage.InputTokens,
+			CompletionTokens: response.Usage.OutputTokens,
+		},
+		FinishReason: anthropicFinishReason(response.StopReason),
+		Model:        response.Model,
+		RequestID:    res.Header.Get("request-id"),
+	}
+	if metadata.RequestID == "" {
+		metadata.RequestID = response.ID
+	}
+	claude.PromptTokensUsed.Add(int64(metadata.Usage.PromptTokens))
+	claude.CompletionTokensUsed.Add(int64(metadata.Usage.CompletionTokens))
+	message := claude.decodeResponse(&response)
+	if message.FunctionCall == nil && message.Text == "" {
+		return nil, metadata, fmt.Errorf("no content in response (stop reason: %s)", response.StopReason)
+	}
+	return message, metadata, nil
+}
+
+// anthropicFinishReason converts a stop reason
+// to the matching FinishReason constant.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return FinishReasonStop
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolCalls
+	}
+	return stopReason
+}
+
+func (claude *Claude) baseURL() string {
+	if claude.BaseURL != "" {
+		return strings.TrimSuffix(claude.BaseURL, "/")
+	}
+	return AnthropicBaseURL
+}
+
+func (claude *Claude) Settings() ModelSettings {
+	settings := ModelSettings{
+		Provider:    "anthropic",
+		BaseURL:     claude.baseURL(),
+		Model:       claude.Model,
+		Temperature: claude.Temperature,
+		Options:     map[string]any{"max_tokens": claude.MaxTokens},
+	}
+	claude.Generation.addTo(settings.Options)
+	return settings
+}
+
+func (claude *Claude) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
+	return claude.chat(context.Background(), prompt, nil)
+}
+
+func (claude *Claude) ChatContext(ctx context.Context, prompt *ChatPrompt) (*ChatMessage, error) {
+	return claude.chat(ctx, prompt, nil)
+}
+
+func (claude *Claude) ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return claude.chat(context.Background(), prompt, functions)
+}
+
+func (claude *Claude) ChatWithFunctionsContext(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return claude.chat(ctx, prompt, functions)
+}
+
+func NewClaudeEngine(apiKey string, model string) *Claude {
+	return &Claude{
+		APIKey:      apiKey,
+		Model:       model,
+		MaxTokens:   4096,
+		Temperature: 1,
+	}
+}
+
+func (claude *Claude) WithMaxTokens(maxTokens int) *Claude {
+	claude.MaxTokens = maxTokens
+	return claude
+}
+
+func (claude *Claude) WithTemperature(temperature float64) *Claude {
+	claude.Temperature = temperature
+	return claude
+}
+
+func (claude *Claude) WithGenerationOptions(options GenerationOptions) *Claude {
+	claude.Generation = options
+	return claude
+}
+
+// Sets whether agents offer tools to the model natively.
+func (claude *Claude) WithToolCalling(enabled bool) *Claude {
+	claude.ToolCalling = &enabled
+	return claude
+}
+
+func (claude *Claude) SupportsFunctionCalls() bool {
+	return claude.ToolCalling == nil || *claude.ToolCalling
+}
+
+func (claude *Claude) SupportsStreaming() bool {
+	return false
+}
+
+func (claude *Claude) WithBaseURL(baseURL string) *Claude {
+	claude.BaseURL = baseURL
+	return claude
+}
+
+func (claude *Claude) WithHTTPClient(client *http.Client) *Claude {
+	claude.HTTPClient = client
+	return claude
+}
@@ -0,0 +1,174 @@
+package engines
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockAnthropicServer(t *testing.T, status int, reply string, onRequest func(r *http.Request, body map[string]any)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if onRequest != nil {
+			onRequest(r, body)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClaudeChatWithFunctions(t *testing.T) {
+	var request *http.Request
+	var body map[string]any
+	server := newMockAnthropicServer(t, http.StatusOK,
+		`{"id": "msg_01", "model": "claude-3-5-sonnet-20241022", "content": [{"type": "text", "text": "Let me check."}, {"type": "tool_use", "id": "toolu_01", "name": "weather", "input": {"city": "Rome"}}], "stop_reason": "tool_use", "usage": {"input_tokens": 20, "output_tokens": 7}}`,
+		func(r *http.Request, b map[string]any) { request, body = r, b },
+	)
+	claude := NewClaudeEngine("key", "claude-3-5-sonnet-latest").WithBaseURL(server.URL)
+	response, err := claude.ChatWithFunctions(&ChatPrompt{
+		History: []*ChatMessage{
+			{Role: ConvRoleSystem, Text: "You are helpful."},
+			{Role: ConvRoleSystem, Text: "Be brief."},
+			{Role: ConvRoleUser, Text: "What's the weather?"},
+			{Role: ConvRoleAssistant, FunctionCall: &FunctionCall{Name: "weather", Args: `{"city": "Paris"}`}},
+			{Role: ConvRoleFunction, Name: "weather", Text: `"sunny"`},
+			{Role: ConvRoleSystem, Text: "Observation: done"},
+		},
+	}, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+
+	assert.Positive(t, response.Metadata.Latency)
+	response.Metadata.Latency = 0
+	assert.Equal(t, &ChatMessage{
+		Role:         ConvRoleAssistant,
+		Text:         "Let me check.",
+		FunctionCall: &FunctionCall{Name: "weather", Args: `{"city": "Rome"}`},
+		ToolCalls: []*ToolCall{
+			{ID: "toolu_01", Type: "function", Function: FunctionCall{Name: "weather", Args: `{"city": "Rome"}`}},
+		},
+		Metadata: &ResponseMetadata{
+			Usage:        Usage{PromptTokens: 20, CompletionTokens: 7},
+			FinishReason: FinishReasonToolCalls,
+			Model:        "claude-3-5-sonnet-20241022",
+			RequestID:    "msg_01",
+		},
+	}, response)
+	assert.EqualValues(t, 20, claude.PromptTokensUsed.Load())
+	assert.EqualValues(t, 7, claude.CompletionTokensUsed.Load())
+
+	assert.Equal(t, "key", request.Header.Get("x-api-key"))
+	assert.Equal(t, AnthropicVersion, request.Header.Get("anthropic-version"))
+	assert.Equal(t, "You are helpful.\n\nBe brief.", body["system"])
+	assert.Equal(t, float64(4096), body["max_tokens"])
+	tools := body["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "weather", tools[0].(map[string]any)["name"])
+	assert.Equal(t, "object", tools[0].(map[string]any)["input_schema"].(map[string]any)["type"])
+
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "user", messages[0].(map[string]any)["role"])
+	toolUse := messages[1].(map[string]any)["content"].([]any)[0].(map[string]any)
+	assert.Equal(t, "tool_use", toolUse["type"])
+	assert.Equal(t, map[string]any{"city": "Paris"}, toolUse["input"])
+	results := messages[2].(map[string]any)["content"].([]any)
+	require.Len(t, results, 2)
+	assert.Equal(t, "tool_result", results[0].(map[string]any)["type"])
+	assert.Equal(t, toolUse["id"], results[0].(map[string]any)["tool_use_id"])
+	assert.Equal(t, `"sunny"`, results[0].(map[string]any)["content"])
+	assert.Equal(t, "Observation: done", results[1].(map[string]any)["text"])
+}
+
+func TestClaudeErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		status      int
+		reply       string
+		expectedErr error
+	}{
+		{
+			name:        "rate limited",
+			status:      http.StatusTooManyRequests,
+			reply:       `{"type": "error", "error": {"type": "rate_limit_error", "message": "Number of requests has exceeded your rate limit"}}`,
+			expectedErr: ErrRateLimited,
+		},
+		{
+			name:        "overloaded",
+			status:      529,
+			reply:       `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			expectedErr: ErrServerError,
+		},
+		{
+			name:        "prompt too long",
+			status:      http.StatusBadRequest,
+			reply:       `{"type": "error", "error": {"type": "invalid_request_error", "message": "prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			expectedErr: ErrContextLengthExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newMockAnthropicServer(t, tc.status, tc.reply, nil)
+			_, err := NewClaudeEngine("key", "model").WithBaseURL(server.URL).Chat(&ChatPrompt{
+				History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}},
+			})
+			require.ErrorIs(t, err, tc.expectedErr)
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.NotEmpty(t, apiErr.Type)
+		})
+	}
+}
+
+func TestClaudeGenerationOptions(t *testing.T) {
+	var body map[string]any
+	server := newMockAnthropicServer(t, http.StatusOK,
+		`{"content": [{"type": "text", "text": "Thought: hi"}], "stop_reason": "stop_sequence", "usage": {"input_tokens": 5, "output_tokens": 3}}`,
+		func(r *http.Request, b map[string]any) { body = b },
+	)
+	seed := 7
+	claude := NewClaudeEngine("key", "claude-3-5-sonnet-latest").
+		WithBaseURL(server.URL).
+		WithGenerationOptions(GenerationOptions{Stop: []string{"\n\n"}, TopP: 0.9, Seed: &seed})
+	ctx := ContextWithGenerationOptions(context.Background(), GenerationOptions{Stop: []string{"<END>"}, MaxTokens: 256})
+
+	response, err := claude.ChatContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+	require.NoError(t, err)
+	assert.Equal(t, FinishReasonStop, response.Metadata.FinishReason)
+	assert.Equal(t, []any{"\n\n", "<END>"}, body["stop_sequences"])
+	assert.Equal(t, 0.9, body["top_p"])
+	assert.Equal(t, float64(256), body["max_tokens"])
+	// Claude does not support seeds
+	assert.NotContains(t, body, "seed")
+}
+
+func TestClaudeToolChoice(t *testing.T) {
+	var body map[string]any
+	server := newMockAnthropicServer(t, http.StatusOK,
+		`{"content": [{"type": "text", "text": "{}"}], "stop_reason": "end_turn", "usage": {"input_tokens": 5, "output_tokens": 3}}`,
+		func(r *http.Request, b map[string]any) { body = b },
+	)
+	claude := NewClaudeEngine("key", "claude-3-5-sonnet-latest").WithBaseURL(server.URL)
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	for choice, expected := range map[ToolChoice]map[string]any{
+		{Mode: "none"}:        {"type": "none"},
+		{Mode: "required"}:    {"type": "any"},
+		{Function: "weather"}: {"type": "tool", "name": "weather"},
+	} {
+		choice := choice
+		ctx := ContextWithGenerationOptions(context.Background(), GenerationOptions{ToolChoice: &choice})
+		_, err := claude.ChatWithFunctionsContext(ctx, prompt, []FunctionSpecs{localWeatherFunction})
+		require.NoError(t, err)
+		assert.Equal(t, expected, body["tool_choice"])
+	}
+}
@@ -0,0 +1,272 @@
+package engines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// The price of a model, in dollars
+// per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// The prices of known models by model name prefix, as
+// published by their providers. Prices change, so set
+// the prices you pay with Budget.WithPrice.
+var DefaultPrices = map[string]Price{
+	"gpt-3.5-turbo":      {Prompt: 0.5, Completion: 1.5},
+	"gpt-3.5-turbo-0613": {Prompt: 1.5, Completion: 2},
+	"gpt-3.5-turbo-16k":  {Prompt: 3, Completion: 4},
+	"gpt-4":              {Prompt: 30, Completion: 60},
+	"gpt-4-32k":          {Prompt: 60, Completion: 120},
+	"gpt-4-turbo":        {Prompt: 10, Completion: 30},
+	"gpt-4o":             {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":        {Prompt: 0.15, Completion: 0.6},
+	"gpt-4.1":            {Prompt: 2, Completion: 8},
+	"gpt-4.1-mini":       {Prompt: 0.4, Completion: 1.6},
+	"gpt-4.1-nano":       {Prompt: 0.1, Completion: 0.4},
+	"o1":                 {Prompt: 15, Completion: 60},
+	"o1-mini":            {Prompt: 1.1, Completion: 4.4},
+	"o3":                 {Prompt: 2, Completion: 8},
+	"o3-mini":            {Prompt: 1.1, Completion: 4.4},
+	"o4-mini":            {Prompt: 1.1, Completion: 4.4},
+	"claude-3-haiku":     {Prompt: 0.25, Completion: 1.25},
+	"claude-3-5-haiku":   {Prompt: 0.8, Completion: 4},
+	"claude-3-5-sonnet":  {Prompt: 3, Completion: 15},
+	"claude-3-7-sonnet":  {Prompt: 3, Completion: 15},
+	"claude-sonnet-4":    {Prompt: 3, Completion: 15},
+	"claude-3-opus":      {Prompt: 15, Completion: 75},
+	"claude-opus-4":      {Prompt: 15, Completion: 75},
+}
+
+// The tokens used and money spent by requests.
+type Spend struct {
+	Requests int     `json:"requests"`
+	Usage    Usage   `json:"usage"`
+	Cost     float64 `json:"cost"`
+}
+
+func (s *Spend) add(other Spend) {
+	s.Requests += other.Requests
+	s.Usage.PromptTokens += other.Usage.PromptTokens
+	s.Usage.CompletionTokens += other.Usage.CompletionTokens
+	s.Cost += other.Cost
+}
+
+// A Budget caps the tokens and money that requests to
+// engines may spend, and reports the spend of each
+// component (see ComponentFromContext). Requests are
+// charged to the budget of their context, so a budget
+// can be shared by several engines, and by everything
+// an agent run does: its own requests, those of its
+// memory, JSONAutoFixer and GenericAgentTool sub-agents.
+// Requests are refused once the budget cannot afford
+// their prompt. Since the length of a response is not
+// known in advance, concurrent requests may together
+// overrun the caps by their responses. A Budget is
+// safe for concurrent use, and its zero value is
+// a budget without caps.
+type Budget struct {
+	// The maximum number of tokens, or 0 for no limit.
+	MaxTokens int
+	// The maximum cost in dollars, or 0 for no limit.
+	MaxCost float64
+	// Prices by model name prefix, which take
+	// precedence over DefaultPrices. Models
+	// without a price are free.
+	Prices map[string]Price
+	mu     sync.Mutex
+	spend  map[string]*Spend
+}
+
+func NewBudget() *Budget {
+	return &Budget{
+		Prices: make(map[string]Price),
+		spend:  make(map[string]*Spend),
+	}
+}
+
+func (b *Budget) WithMaxTokens(maxTokens int) *Budget {
+	b.MaxTokens = maxTokens
+	return b
+}
+
+func (b *Budget) WithMaxCost(dollars float64) *Budget {
+	b.MaxCost = dollars
+	return b
+}
+
+// Sets the price of the models whose
+// names start with modelPrefix.
+func (b *Budget) WithPrice(modelPrefix string, price Price) *Budget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Prices == nil {
+		b.Prices = make(map[string]Price)
+	}
+	b.Prices[modelPrefix] = price
+	return b
+}
+
+// PriceOf returns the price of the model, and
+// whether it is known. The price with the longest
+// matching model name prefix applies.
+func (b *Budget) PriceOf(model string) (Price, bool) {
+	b.mu.Lock()
+	price, ok := priceOf(b.Prices, model)
+	b.mu.Unlock()
+	if ok {
+		return price, true
+	}
+	return priceOf(DefaultPrices, model)
+}
+
+func priceOf(prices map[string]Price, model string) (Price, bool) {
+	var price Price
+	longest := -1
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			price, longest = p, len(prefix)
+		}
+	}
+	return price, longest >= 0
+}
+
+// Cost returns the cost in dollars
+// of the usage of the model.
+func (b *Budget) Cost(model string, usage Usage) float64 {
+	price, _ := b.PriceOf(model)
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// Spent returns the total spend.
+func (b *Budget) Spent() Spend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var total Spend
+	for _, spend := range b.spend {
+		total.add(*spend)
+	}
+	return total
+}
+
+// Report returns the spend of each component.
+// Requests made outside of any component
+// are reported as "other".
+func (b *Budget) Report() map[string]Spend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report := make(map[string]Spend, len(b.spend))
+	for component, spend := range b.spend {
+		report[component] = *spend
+	}
+	return report
+}
+
+// WriteReport writes the spend of each
+// component, and the total, as a table.
+func (b *Budget) WriteReport(w io.Writer) error {
+	report := b.Report()
+	components := make([]string, 0, len(report))
+	for component := range report {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "COMPONENT\tREQUESTS\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST")
+	var total Spend
+	for _, component := range components {
+		spend := report[component]
+		total.add(spend)
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t$%.4f\n", component, spend.Requests, spend.Usage.PromptTokens, spend.Usage.CompletionTokens, spend.Cost)
+	}
+	fmt.Fprintf(table, "total\t%d\t%d\t%d\t$%.4f\n", total.Requests, total.Usage.PromptTokens, total.Usage.CompletionTokens, total.Cost)
+	return table.Flush()
+}
+
+// check refuses a request whose prompt
+// the budget cannot afford.
+func (b *Budget) check(model string, prompt *ChatPrompt, functions []FunctionSpecs) error {
+	if b.MaxTokens <= 0 && b.MaxCost <= 0 {
+		return nil
+	}
+	spent := b.Spent()
+	tokens := spent.Usage.PromptTokens + spent.Usage.CompletionTokens
+	if b.MaxTokens > 0 && tokens >= b.MaxTokens || b.MaxCost > 0 && spent.Cost >= b.MaxCost {
+		return fmt.Errorf("%w: spent %d tokens and $%.4f", ErrBudgetExceeded, tokens, spent.Cost)
+	}
+	promptTokens := CountPromptTokens(model, prompt.History, functions)
+	if b.MaxTokens > 0 && tokens+promptTokens > b.MaxTokens {
+		return fmt.Errorf("%w: the prompt has %d tokens, but only %d tokens are left",
+			ErrBudgetExceeded, promptTokens, b.MaxTokens-tokens)
+	}
+	if cost := b.Cost(model, Usage{PromptTokens: promptTokens}); b.MaxCost > 0 && spent.Cost+cost > b.MaxCost {
+		return fmt.Errorf("%w: the prompt costs $%.4f, but only $%.4f is left",
+			ErrBudgetExceeded, cost, b.MaxCost-spent.Cost)
+	}
+	return nil
+}
+
+func (b *Budget) record(component, model string, usage Usage) {
+	if component == "" {
+		component = "other"
+	}
+	cost := b.Cost(model, usage)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.spend == nil {
+		b.spend = make(map[string]*Spend)
+	}
+	spend, ok := b.spend[component]
+	if !ok {
+		spend = &Spend{}
+		b.spend[component] = spend
+	}
+	spend.add(Spend{Requests: 1, Usage: usage, Cost: cost})
+}
+
+type budgetKey struct{}
+
+// ContextWithBudget charges the requests made
+// with ctx to the budget.
+func ContextWithBudget(ctx context.Context, budget *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, budget)
+}
+
+// BudgetFromContext returns the budget that requests made
+// with ctx are charged to, or nil if there is none.
+func BudgetFromContext(ctx context.Context) *Budget {
+	budget, _ := ctx.Value(budgetKey{}).(*Budget)
+	return budget
+}
+
+// An engine wrapper that charges the
+// requests it sends to a budget.
+type BudgetedEngine struct {
+	middleware
+	Budget *Budget
+}
+
+func (b *BudgetedEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	return send(ContextWithBudget(ctx, b.Budget), b.next, req)
+}
+
+// Charges the requests sent to the engine to the
+// budget, rather than to the budget of their context.
+// Only the requests that reach one of the built-in
+// engines are charged.
+func NewBudgetedEngine(engine LLM, budget *Budget) *BudgetedEngine {
+	b := &BudgetedEngine{Budget: budget}
+	b.middleware = middleware{next: engine, handle: b.chat}
+	return b
+}
@@ -0,0 +1,126 @@
+package engines
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	server := newMockOpenAIServer(t, "hi", nil)
+	newEngine := func(model string) *GPT {
+		return NewGPTEngine("token", model).
+			WithBaseURL(server.URL + "/").
+			WithHTTPClient(server.Client())
+	}
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	// the mock server reports 3 prompt and 1 completion tokens,
+	// while the prompt is estimated at 8 tokens before sending
+	testCases := []struct {
+		name          string
+		budget        *Budget
+		requests      int
+		expectedSpend Spend
+		expectedErr   error
+	}{
+		{
+			name:          "no caps",
+			budget:        NewBudget(),
+			requests:      3,
+			expectedSpend: Spend{Requests: 3, Usage: Usage{PromptTokens: 9, CompletionTokens: 3}, Cost: 3 * (3*2 + 1*8) / 1e6},
+		},
+		{
+			name:          "zero value",
+			budget:        &Budget{},
+			requests:      3,
+			expectedSpend: Spend{Requests: 3, Usage: Usage{PromptTokens: 9, CompletionTokens: 3}, Cost: 3 * (3*2 + 1*8) / 1e6},
+		},
+		{
+			name:          "struct literal",
+			budget:        (&Budget{MaxTokens: 14}).WithPrice("gpt-4.1", Price{Prompt: 2, Completion: 8}),
+			requests:      3,
+			expectedSpend: Spend{Requests: 2, Usage: Usage{PromptTokens: 6, CompletionTokens: 2}, Cost: 2 * (3*2 + 1*8) / 1e6},
+			expectedErr:   ErrBudgetExceeded,
+		},
+		{
+			name:          "token cap",
+			budget:        NewBudget().WithMaxTokens(14),
+			requests:      3,
+			expectedSpend: Spend{Requests: 2, Usage: Usage{PromptTokens: 6, CompletionTokens: 2}, Cost: 2 * (3*2 + 1*8) / 1e6},
+			expectedErr:   ErrBudgetExceeded,
+		},
+		{
+			name:          "cost cap",
+			budget:        NewBudget().WithMaxCost(1.5).WithPrice("gpt-4.1", Price{Prompt: 1e5, Completion: 2e5}),
+			requests:      3,
+			expectedSpend: Spend{Requests: 2, Usage: Usage{PromptTokens: 6, CompletionTokens: 2}, Cost: 2 * (3*1e5 + 1*2e5) / 1e6},
+			expectedErr:   ErrBudgetExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// engines share the budget
+			engines := []LLM{
+				NewBudgetedEngine(newEngine("gpt-4.1"), tc.budget),
+				NewBudgetedEngine(newEngine("gpt-4.1"), tc.budget),
+			}
+			var err error
+			for i := 0; i < tc.requests && err == nil; i++ {
+				_, err = engines[i%len(engines)].Chat(prompt)
+			}
+			assert.ErrorIs(t, err, tc.expectedErr)
+			spent := tc.budget.Spent()
+			assert.InDelta(t, tc.expectedSpend.Cost, spent.Cost, 1e-9)
+			spent.Cost = tc.expectedSpend.Cost
+			assert.Equal(t, tc.expectedSpend, spent)
+		})
+	}
+}
+
+func TestBudgetReport(t *testing.T) {
+	server := newMockOpenAIServer(t, "hi", nil)
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL + "/").
+		WithHTTPClient(server.Client())
+	budget := NewBudget().WithPrice("local-model", Price{Prompt: 1e6, Completion: 1e6})
+	ctx := ContextWithBudget(context.Background(), budget)
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			budget.record(ComponentSummarisedMemory, "local-model", Usage{PromptTokens: 3, CompletionTokens: 1})
+		}()
+	}
+	wg.Wait()
+	_, err := gpt.ChatContext(ContextWithComponent(ctx, ComponentAgent), prompt)
+	require.NoError(t, err)
+	_, err = gpt.ChatContext(ContextWithComponent(ctx, ComponentJSONAutoFixer), prompt)
+	require.NoError(t, err)
+	_, err = gpt.ChatContext(ctx, prompt)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Spend{
+		ComponentSummarisedMemory: {Requests: 4, Usage: Usage{PromptTokens: 12, CompletionTokens: 4}, Cost: 16},
+		ComponentAgent:            {Requests: 1, Usage: Usage{PromptTokens: 3, CompletionTokens: 1}, Cost: 4},
+		ComponentJSONAutoFixer:    {Requests: 1, Usage: Usage{PromptTokens: 3, CompletionTokens: 1}, Cost: 4},
+		"other":                   {Requests: 1, Usage: Usage{PromptTokens: 3, CompletionTokens: 1}, Cost: 4},
+	}, budget.Report())
+
+	var report bytes.Buffer
+	require.NoError(t, budget.WriteReport(&report))
+	assert.Equal(t, ""+
+		"COMPONENT          REQUESTS  PROMPT TOKENS  COMPLETION TOKENS  COST\n"+
+		"agent              1         3              1                  $4.0000\n"+
+		"json_autofixer     1         3              1                  $4.0000\n"+
+		"other              1         3              1                  $4.0000\n"+
+		"summarised_memory  4         12             4                  $16.0000\n"+
+		"total              7         21             7                  $28.0000\n",
+		report.String())
+}
@@ -0,0 +1,287 @@
+package engines
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A cached response.
+type CacheEntry struct {
+	Response *ChatMessage `json:"response"`
+	// When the entry expires. Entries with
+	// a zero expiry never expire.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// The finish reason and model
+	// reported with the response.
+	FinishReason string `json:"finish_reason,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+// A Cache stores responses by the
+// key of the request they answer.
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry) error
+}
+
+// An in-memory Cache that evicts the least recently
+// used entry once it reaches its capacity. It is safe
+// for concurrent use.
+type LRUCache struct {
+	capacity int
+	mu       sync.Mutex
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// Creates a cache holding up to capacity entries.
+// A capacity of 0 or less means no limit.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.elements[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+func (c *LRUCache) Set(key string, entry *CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.elements[key]; ok {
+		element.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.elements[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.elements, oldest.Value.(*lruItem).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// A Cache that stores each entry as a JSON
+// file in a directory, so that it persists
+// across runs.
+type DiskCache struct {
+	Dir string
+}
+
+// Creates a cache in dir, creating
+// the directory if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (*CacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Debugf("Ignoring invalid cache entry %s: %v", key, err)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (c *DiskCache) Set(key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// written to a temporary file first, so that
+	// readers never see a partially written entry
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// An engine wrapper that serves repeated requests from
+// a cache. Requests are keyed on their messages, their
+// functions and the settings of the wrapped engine.
+// Requests to engines with a non-zero temperature are
+// not cached, since their responses are not expected
+// to be reproducible, unless CacheAnyTemperature is set.
+type CachingEngine struct {
+	middleware
+	Cache Cache
+	// How long entries are served for.
+	// Zero means forever.
+	TTL                 time.Duration
+	CacheAnyTemperature bool
+	hits                atomic.Int64
+	misses              atomic.Int64
+}
+
+func (c *CachingEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	settings := EngineSettings(c.next)
+	if settings.Temperature != 0 && !c.CacheAnyTemperature {
+		return send(ctx, c.next, req)
+	}
+	// the options of the request change the response
+	// as much as those of the engine do
+	if options := GenerationOptionsFromContext(ctx); !options.isZero() {
+		settingsOptions := map[string]any{"request": options}
+		for name, value := range settings.Options {
+			settingsOptions[name] = value
+		}
+		settings.Options = settingsOptions
+	}
+	key, err := CacheKey(settings, req.prompt, req.functions)
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := c.Cache.Get(key); ok && (entry.ExpiresAt.IsZero() || time.Now().Before(entry.ExpiresAt)) {
+		c.hits.Add(1)
+		response := *entry.Response
+		response.Metadata = &ResponseMetadata{
+			FinishReason: entry.FinishReason,
+			Model:        entry.Model,
+			Cached:       true,
+		}
+		if req.stream && req.onDelta != nil {
+			delta := *entry.Response
+			req.onDelta(&delta)
+		}
+		return &response, nil
+	}
+	c.misses.Add(1)
+	response, err := send(ctx, c.next, req)
+	if err != nil {
+		return nil, err
+	}
+	cached := *response
+	cached.Metadata = nil
+	entry := &CacheEntry{Response: &cached}
+	if response.Metadata != nil {
+		entry.FinishReason = response.Metadata.FinishReason
+		entry.Model = response.Metadata.Model
+	}
+	if c.TTL > 0 {
+		entry.ExpiresAt = time.Now().Add(c.TTL)
+	}
+	if err := c.Cache.Set(key, entry); err != nil {
+		log.Warnf("Failed to cache response: %v", err)
+	}
+	return response, nil
+}
+
+// Hits returns the number of requests
+// served from the cache.
+func (c *CachingEngine) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of cacheable
+// requests sent to the wrapped engine.
+func (c *CachingEngine) Misses() int64 {
+	return c.misses.Load()
+}
+
+// Wraps the engine so that repeated
+// requests are served from cache.
+func NewCachingEngine(engine LLM, cache Cache) *CachingEngine {
+	c := &CachingEngine{Cache: cache}
+	c.middleware = middleware{next: engine, handle: c.chat}
+	return c
+}
+
+func (c *CachingEngine) WithTTL(ttl time.Duration) *CachingEngine {
+	c.TTL = ttl
+	return c
+}
+
+// Caches responses even when the wrapped
+// engine has a non-zero temperature.
+func (c *CachingEngine) WithCacheAnyTemperature() *CachingEngine {
+	c.CacheAnyTemperature = true
+	return c
+}
+
+type cacheKey struct {
+	Settings  ModelSettings   `json:"settings"`
+	Messages  []*ChatMessage  `json:"messages"`
+	Functions []FunctionSpecs `json:"functions,omitempty"`
+}
+
+// CacheKey returns a hash identifying the request. Prompts
+// that differ only in surrounding whitespace, line endings,
+// the order of functions or the form of function calls
+// (legacy or tool calls) have the same key.
+func CacheKey(settings ModelSettings, prompt *ChatPrompt, functions []FunctionSpecs) (string, error) {
+	key := cacheKey{
+		Settings:  settings,
+		Messages:  normalizeToolCalls(prompt.History),
+		Functions: append([]FunctionSpecs{}, functions...),
+	}
+	for _, msg := range key.Messages {
+		msg.Text = strings.TrimSpace(strings.ReplaceAll(msg.Text, "\r\n", "\n"))
+	}
+	sort.SliceStable(key.Functions, func(i, j int) bool {
+		return key.Functions[i].Name < key.Functions[j].Name
+	})
+	// maps are encoded with sorted keys,
+	// so the encoding is canonical
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:]), nil
+}
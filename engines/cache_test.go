@@ -0,0 +1,174 @@
+package engines
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingEngine(t *testing.T) {
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	functions := []FunctionSpecs{{
+		Name:        "echo",
+		Description: "Echoes the input",
+		Parameters:  &ParameterSpecs{Type: "object"},
+	}}
+	newDiskCache := func(t *testing.T) Cache {
+		cache, err := NewDiskCache(t.TempDir())
+		require.NoError(t, err)
+		return cache
+	}
+	testCases := []struct {
+		name          string
+		newCache      func(t *testing.T) Cache
+		temperature   float64
+		anyTemp       bool
+		ttl           time.Duration
+		wait          time.Duration
+		expectedCalls int
+	}{
+		{
+			name:          "lru cache",
+			newCache:      func(*testing.T) Cache { return NewLRUCache(10) },
+			expectedCalls: 2,
+		},
+		{
+			name:          "disk cache",
+			newCache:      newDiskCache,
+			expectedCalls: 2,
+		},
+		{
+			name:          "non-zero temperature bypasses cache",
+			newCache:      func(*testing.T) Cache { return NewLRUCache(10) },
+			temperature:   0.7,
+			expectedCalls: 6,
+		},
+		{
+			name:          "non-zero temperature cached when enabled",
+			newCache:      func(*testing.T) Cache { return NewLRUCache(10) },
+			temperature:   0.7,
+			anyTemp:       true,
+			expectedCalls: 2,
+		},
+		{
+			name:          "expired entries are refreshed",
+			newCache:      newDiskCache,
+			ttl:           time.Millisecond,
+			wait:          5 * time.Millisecond,
+			expectedCalls: 6,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			server := newMockOpenAIServer(t, "hi", func(*http.Request, *ChatCompletionRequest) {
+				calls++
+			})
+			gpt := NewGPTEngine("token", "local-model").
+				WithBaseURL(server.URL + "/").
+				WithHTTPClient(server.Client()).
+				WithTemperature(tc.temperature)
+			engine := NewCachingEngine(gpt, tc.newCache(t)).WithTTL(tc.ttl)
+			if tc.anyTemp {
+				engine.WithCacheAnyTemperature()
+			}
+			for i := 0; i < 3; i++ {
+				response, err := engine.Chat(prompt)
+				require.NoError(t, err)
+				assert.Equal(t, "hi", response.Text)
+				// requests with functions are cached separately
+				_, err = engine.ChatWithFunctions(prompt, functions)
+				require.NoError(t, err)
+				time.Sleep(tc.wait)
+			}
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestCachingEngineResponse(t *testing.T) {
+	server := newMockOpenAIServer(t, "hi", nil)
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL + "/").
+		WithHTTPClient(server.Client()).
+		WithTemperature(0)
+	engine := NewCachingEngine(gpt, NewLRUCache(10))
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+
+	first, err := engine.Chat(prompt)
+	require.NoError(t, err)
+	assert.False(t, first.Metadata.Cached)
+	assert.Equal(t, 3, first.Metadata.Usage.PromptTokens)
+	second, err := engine.Chat(prompt)
+	require.NoError(t, err)
+	assert.Equal(t, &ResponseMetadata{Model: "local-model", Cached: true}, second.Metadata)
+	assert.Equal(t, first.Text, second.Text)
+	assert.Equal(t, int64(1), engine.Hits())
+	assert.Equal(t, int64(1), engine.Misses())
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache(2)
+	entry := &CacheEntry{Response: &ChatMessage{Text: "hi"}}
+	require.NoError(t, cache.Set("a", entry))
+	require.NoError(t, cache.Set("b", entry))
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+	require.NoError(t, cache.Set("c", entry))
+	assert.Equal(t, 2, cache.Len())
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+}
+
+func TestCacheKey(t *testing.T) {
+	settings := ModelSettings{Model: "model"}
+	functions := []FunctionSpecs{{Name: "a"}, {Name: "b"}}
+	key := func(settings ModelSettings, history []*ChatMessage, functions []FunctionSpecs) string {
+		k, err := CacheKey(settings, &ChatPrompt{History: history}, functions)
+		require.NoError(t, err)
+		return k
+	}
+	base := key(settings, []*ChatMessage{{Role: ConvRoleUser, Text: "hello\r\nworld"}}, functions)
+
+	assert.Equal(t, base, key(settings, []*ChatMessage{{Role: ConvRoleUser, Text: " hello\nworld\n"}}, functions))
+	assert.Equal(t, base, key(settings, []*ChatMessage{{Role: ConvRoleUser, Text: "hello\nworld"}}, []FunctionSpecs{{Name: "b"}, {Name: "a"}}))
+	assert.NotEqual(t, base, key(settings, []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}, functions))
+	assert.NotEqual(t, base, key(settings, []*ChatMessage{{Role: ConvRoleUser, Text: "hello\nworld"}}, nil))
+	assert.NotEqual(t, base, key(ModelSettings{Model: "other"}, []*ChatMessage{{Role: ConvRoleUser, Text: "hello\nworld"}}, functions))
+
+	legacy := key(settings, []*ChatMessage{
+		{Role: ConvRoleAssistant, FunctionCall: &FunctionCall{Name: "a", Args: "{}"}},
+		{Role: ConvRoleFunction, Name: "a", Text: "done"},
+	}, functions)
+	assert.Equal(t, legacy, key(settings, []*ChatMessage{
+		{Role: ConvRoleAssistant, ToolCalls: []*ToolCall{{ID: "call_0_0", Type: "function", Function: FunctionCall{Name: "a", Args: "{}"}}}},
+		{Role: ConvRoleTool, Name: "a", ToolCallID: "call_0_0", Text: "done"},
+	}, functions))
+}
+
+func TestCachingEngineGenerationOptions(t *testing.T) {
+	server := newMockOpenAIServer(t, "hi", nil)
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL + "/").
+		WithHTTPClient(server.Client()).
+		WithTemperature(0)
+	engine := NewCachingEngine(gpt, NewLRUCache(10))
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	stopped := ContextWithGenerationOptions(context.Background(), GenerationOptions{Stop: []string{"<END>"}})
+
+	_, err := engine.ChatContext(context.Background(), prompt)
+	require.NoError(t, err)
+	// the options of a request are part of its key
+	_, err = engine.ChatContext(stopped, prompt)
+	require.NoError(t, err)
+	_, err = engine.ChatContext(stopped, prompt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), engine.Hits())
+	assert.Equal(t, int64(2), engine.Misses())
+}
@@ -0,0 +1,142 @@
+package engines
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrFunctionCallsUnsupported = errors.New("engine does not support native function calls")
+	ErrStreamingUnsupported     = errors.New("engine does not support streaming")
+)
+
+// Implemented by engines that wrap other engines,
+// and therefore support native function calls or
+// streaming only if the engines they wrap do.
+type CapabilityReporter interface {
+	SupportsFunctionCalls() bool
+	SupportsStreaming() bool
+}
+
+// Implemented by engines that constrain their responses
+// to the ResponseFormat generation option.
+type ResponseFormatReporter interface {
+	SupportsResponseFormat() bool
+}
+
+// SupportsResponseFormat reports whether the engine constrains
+// its responses to the ResponseFormat generation option, rather
+// than ignoring it.
+func SupportsResponseFormat(engine LLM) bool {
+	reporter, ok := engine.(ResponseFormatReporter)
+	return ok && reporter.SupportsResponseFormat()
+}
+
+// SupportsFunctionCalls reports whether native function
+// calls can be used with the engine.
+func SupportsFunctionCalls(engine LLM) bool {
+	if _, ok := engine.(LLMWithFunctionCalls); !ok {
+		return false
+	}
+	if reporter, ok := engine.(CapabilityReporter); ok {
+		return reporter.SupportsFunctionCalls()
+	}
+	return true
+}
+
+// SupportsStreaming reports whether responses can be
+// streamed from the engine.
+func SupportsStreaming(engine LLM) bool {
+	if _, ok := engine.(LLMWithStreaming); !ok {
+		return false
+	}
+	if reporter, ok := engine.(CapabilityReporter); ok {
+		return reporter.SupportsStreaming()
+	}
+	return true
+}
+
+// chatRequest describes a single call to an engine,
+// through any of the engine interfaces.
+type chatRequest struct {
+	prompt        *ChatPrompt
+	functions     []FunctionSpecs
+	withFunctions bool
+	stream        bool
+	onDelta       func(delta *ChatMessage)
+}
+
+// send sends the request to the engine through
+// the interface the request was made with.
+func send(ctx context.Context, engine LLM, req *chatRequest) (*ChatMessage, error) {
+	switch {
+	case req.stream:
+		streamer, ok := engine.(LLMWithStreaming)
+		if !ok || !SupportsStreaming(engine) {
+			return nil, ErrStreamingUnsupported
+		}
+		return streamer.ChatStream(ctx, req.prompt, req.functions, req.onDelta)
+	case req.withFunctions:
+		functionEngine, ok := engine.(LLMWithFunctionCalls)
+		if !ok || !SupportsFunctionCalls(engine) {
+			return nil, ErrFunctionCallsUnsupported
+		}
+		return ChatWithFunctionsContext(ctx, functionEngine, req.prompt, req.functions)
+	default:
+		return ChatContext(ctx, engine, req.prompt)
+	}
+}
+
+// middleware implements all engine interfaces on top of
+// a single handler, so that engine wrappers only need to
+// implement the handler. Its capabilities are those of
+// the wrapped engine.
+type middleware struct {
+	next   LLM
+	handle func(ctx context.Context, req *chatRequest) (*ChatMessage, error)
+}
+
+func (m *middleware) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
+	return m.handle(context.Background(), &chatRequest{prompt: prompt})
+}
+
+func (m *middleware) ChatContext(ctx context.Context, prompt *ChatPrompt) (*ChatMessage, error) {
+	return m.handle(ctx, &chatRequest{prompt: prompt})
+}
+
+func (m *middleware) ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return m.ChatWithFunctionsContext(context.Background(), prompt, functions)
+}
+
+func (m *middleware) ChatWithFunctionsContext(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return m.handle(ctx, &chatRequest{
+		prompt:        prompt,
+		functions:     functions,
+		withFunctions: true,
+	})
+}
+
+func (m *middleware) ChatStream(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs, onDelta func(delta *ChatMessage)) (*ChatMessage, error) {
+	return m.handle(ctx, &chatRequest{
+		prompt:    prompt,
+		functions: functions,
+		stream:    true,
+		onDelta:   onDelta,
+	})
+}
+
+func (m *middleware) SupportsFunctionCalls() bool {
+	return SupportsFunctionCalls(m.next)
+}
+
+func (m *middleware) SupportsStreaming() bool {
+	return SupportsStreaming(m.next)
+}
+
+func (m *middleware) SupportsResponseFormat() bool {
+	return SupportsResponseFormat(m.next)
+}
+
+func (m *middleware) Settings() ModelSettings {
+	return EngineSettings(m.next)
+}
@@ -0,0 +1,243 @@
+package engines
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrCassetteMismatch is returned by a ReplayEngine when
+// no recorded interaction matches a request.
+var ErrCassetteMismatch = errors.New("no recorded interaction matches the request")
+
+// A request to an engine and the response it returned,
+// as recorded in a cassette.
+type Interaction struct {
+	Messages  []*ChatMessage  `json:"messages"`
+	Functions []FunctionSpecs `json:"functions,omitempty"`
+	Response  *ChatMessage    `json:"response"`
+	Usage     *Usage          `json:"usage,omitempty"`
+	// The finish reason and model
+	// reported with the response.
+	FinishReason string `json:"finish_reason,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+// A Cassette is a file of recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// LoadCassette reads the cassette at path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// An engine wrapper that records every successful
+// request and response to a cassette file, to be
+// served back later by a ReplayEngine.
+type RecordingEngine struct {
+	middleware
+	Path     string
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func (r *RecordingEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	response, err := send(ctx, r.next, req)
+	if err != nil {
+		return nil, err
+	}
+	// copied, so that later changes made by the
+	// caller to the messages are not recorded
+	messages := make([]*ChatMessage, len(req.prompt.History))
+	for i, msg := range req.prompt.History {
+		msgCopy := *msg
+		messages[i] = &msgCopy
+	}
+	responseCopy := *response
+	interaction := &Interaction{
+		Messages:  messages,
+		Functions: req.functions,
+		Response:  &responseCopy,
+	}
+	if response.Metadata != nil {
+		usage := response.Metadata.Usage
+		interaction.Usage = &usage
+		interaction.FinishReason = response.Metadata.FinishReason
+		interaction.Model = response.Metadata.Model
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	// saved after every request, so that a
+	// failing run still leaves a cassette
+	if err := r.cassette.Save(r.Path); err != nil {
+		return nil, fmt.Errorf("failed to save cassette: %w", err)
+	}
+	return response, nil
+}
+
+// Records the requests made to engine in a new
+// cassette at path, replacing any existing file.
+func NewRecordingEngine(engine LLM, path string) *RecordingEngine {
+	recorder := &RecordingEngine{Path: path}
+	recorder.middleware = middleware{next: engine, handle: recorder.chat}
+	return recorder
+}
+
+// An engine that serves the responses recorded in
+// a cassette. Each request is answered with the first
+// interaction not yet replayed whose messages and
+// functions equal those of the request.
+type ReplayEngine struct {
+	middleware
+	mu           sync.Mutex
+	interactions []*Interaction
+	replayed     []bool
+}
+
+func (r *ReplayEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := encodeForMatching(req.prompt.History)
+	functions := encodeForMatching(req.functions)
+	var closest *Interaction
+	for i, interaction := range r.interactions {
+		if r.replayed[i] {
+			continue
+		}
+		if closest == nil {
+			closest = interaction
+		}
+		if encodeForMatching(interaction.Messages) != messages || encodeForMatching(interaction.Functions) != functions {
+			continue
+		}
+		r.replayed[i] = true
+		response := *interaction.Response
+		if interaction.Usage != nil {
+			response.Metadata = &ResponseMetadata{
+				Usage:        *interaction.Usage,
+				FinishReason: interaction.FinishReason,
+				Model:        interaction.Model,
+			}
+		}
+		if req.stream && req.onDelta != nil {
+			delta := response
+			delta.Metadata = nil
+			req.onDelta(&delta)
+		}
+		return &response, nil
+	}
+	if closest == nil {
+		return nil, fmt.Errorf("%w: all %d interactions were replayed", ErrCassetteMismatch, len(r.interactions))
+	}
+	return nil, fmt.Errorf("%w: %s", ErrCassetteMismatch, describeMismatch(closest, req))
+}
+
+// Remaining returns the number of recorded
+// interactions that were not replayed.
+func (r *ReplayEngine) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for _, replayed := range r.replayed {
+		if !replayed {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Responses are replayed whether or not the recorded
+// engine supported function calls, streaming or
+// response formats.
+func (r *ReplayEngine) SupportsFunctionCalls() bool {
+	return true
+}
+
+func (r *ReplayEngine) SupportsStreaming() bool {
+	return true
+}
+
+func (r *ReplayEngine) SupportsResponseFormat() bool {
+	return true
+}
+
+// Replays the interactions in the cassette.
+func NewReplayEngine(cassette *Cassette) *ReplayEngine {
+	replayer := &ReplayEngine{
+		interactions: cassette.Interactions,
+		replayed:     make([]bool, len(cassette.Interactions)),
+	}
+	replayer.middleware = middleware{handle: replayer.chat}
+	return replayer
+}
+
+// Replays the interactions in the cassette at path.
+func NewReplayEngineFromFile(path string) (*ReplayEngine, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayEngine(cassette), nil
+}
+
+func encodeForMatching(value any) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// describeMismatch explains how the request differs from
+// the interaction expected to match it.
+func describeMismatch(expected *Interaction, req *chatRequest) string {
+	got := req.prompt.History
+	for i := 0; i < len(expected.Messages) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return fmt.Sprintf("the request has %d messages, expected %d; first missing message: %s",
+				len(got), len(expected.Messages), describeMessage(expected.Messages[i]))
+		case i >= len(expected.Messages):
+			return fmt.Sprintf("the request has %d messages, expected %d; first extra message: %s",
+				len(got), len(expected.Messages), describeMessage(got[i]))
+		case encodeForMatching(expected.Messages[i]) != encodeForMatching(got[i]):
+			return fmt.Sprintf("message %d differs:\n  expected: %s\n  got:      %s",
+				i, describeMessage(expected.Messages[i]), describeMessage(got[i]))
+		}
+	}
+	return fmt.Sprintf("the functions differ:\n  expected: %s\n  got:      %s",
+		encodeForMatching(expected.Functions), encodeForMatching(req.functions))
+}
+
+func describeMessage(msg *ChatMessage) string {
+	const maxLength = 200
+	description := encodeForMatching(msg)
+	if len(description) > maxLength {
+		description = description[:maxLength] + "..."
+	}
+	return strings.ReplaceAll(description, "\n", `\n`)
+}
@@ -0,0 +1,118 @@
+package engines
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	server := newMockOpenAIServer(t, "hi", nil)
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL + "/").
+		WithHTTPClient(server.Client())
+	functions := []FunctionSpecs{{
+		Name:        "echo",
+		Description: "Echoes the input",
+		Parameters:  &ParameterSpecs{Type: "object"},
+	}}
+	prompts := []*ChatPrompt{
+		{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}},
+		{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello again"}}},
+	}
+
+	recorder := NewRecordingEngine(gpt, path)
+	recorded, err := recorder.Chat(prompts[0])
+	require.NoError(t, err)
+	_, err = recorder.ChatWithFunctions(prompts[1], functions)
+	require.NoError(t, err)
+	server.Close()
+
+	replayer, err := NewReplayEngineFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayer.Remaining())
+	// interactions are matched by their
+	// prompt, not by their order
+	_, err = replayer.ChatWithFunctions(prompts[1], functions)
+	require.NoError(t, err)
+	replayed, err := replayer.Chat(prompts[0])
+	require.NoError(t, err)
+	// latencies are not recorded
+	recorded.Metadata.Latency = 0
+	assert.Equal(t, recorded, replayed)
+	assert.Equal(t, 0, replayer.Remaining())
+
+	_, err = replayer.Chat(prompts[0])
+	assert.ErrorIs(t, err, ErrCassetteMismatch)
+}
+
+func TestReplayMismatch(t *testing.T) {
+	cassette := &Cassette{Interactions: []*Interaction{{
+		Messages: []*ChatMessage{
+			{Role: ConvRoleSystem, Text: "be helpful"},
+			{Role: ConvRoleUser, Text: "hello"},
+		},
+		Response: &ChatMessage{Role: ConvRoleAssistant, Text: "hi"},
+	}}}
+	testCases := []struct {
+		name        string
+		prompt      *ChatPrompt
+		functions   []FunctionSpecs
+		expectedErr string
+	}{
+		{
+			name: "different message",
+			prompt: &ChatPrompt{History: []*ChatMessage{
+				{Role: ConvRoleSystem, Text: "be helpful"},
+				{Role: ConvRoleUser, Text: "goodbye"},
+			}},
+			expectedErr: "message 1 differs",
+		},
+		{
+			name: "missing message",
+			prompt: &ChatPrompt{History: []*ChatMessage{
+				{Role: ConvRoleSystem, Text: "be helpful"},
+			}},
+			expectedErr: "the request has 1 messages, expected 2",
+		},
+		{
+			name: "different functions",
+			prompt: &ChatPrompt{History: []*ChatMessage{
+				{Role: ConvRoleSystem, Text: "be helpful"},
+				{Role: ConvRoleUser, Text: "hello"},
+			}},
+			functions:   []FunctionSpecs{{Name: "echo"}},
+			expectedErr: "the functions differ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			replayer := NewReplayEngine(cassette)
+			_, err := replayer.ChatWithFunctions(tc.prompt, tc.functions)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrCassetteMismatch))
+			assert.Contains(t, err.Error(), tc.expectedErr)
+		})
+	}
+}
+
+func TestReplayStream(t *testing.T) {
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	replayer := NewReplayEngine(&Cassette{Interactions: []*Interaction{{
+		Messages: prompt.History,
+		Response: &ChatMessage{Role: ConvRoleAssistant, Text: "hi"},
+		Usage:    &Usage{PromptTokens: 3, CompletionTokens: 1},
+	}}})
+	var deltas []string
+	response, err := replayer.ChatStream(context.Background(), prompt, nil, func(delta *ChatMessage) {
+		deltas = append(deltas, delta.Text)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hi"}, deltas)
+	assert.Equal(t, &ResponseMetadata{Usage: Usage{PromptTokens: 3, CompletionTokens: 1}}, response.Metadata)
+}
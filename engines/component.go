@@ -0,0 +1,28 @@
+package engines
+
+import "context"
+
+// The components of go-llm that send requests
+// to engines, as reported by ComponentFromContext.
+const (
+	ComponentAgent            = "agent"
+	ComponentJSONAutoFixer    = "json_autofixer"
+	ComponentSummarisedMemory = "summarised_memory"
+	ComponentWebpageSummary   = "webpage_summary"
+)
+
+type componentKey struct{}
+
+// ContextWithComponent marks the requests made with ctx
+// as made by the named component, e.g. so that they can
+// be routed to a particular engine.
+func ContextWithComponent(ctx context.Context, component string) context.Context {
+	return context.WithValue(ctx, componentKey{}, component)
+}
+
+// ComponentFromContext returns the component that made
+// a request, or "" if the request was not marked.
+func ComponentFromContext(ctx context.Context) string {
+	component, _ := ctx.Value(componentKey{}).(string)
+	return component
+}
@@ -0,0 +1,29 @@
+package engines
+
+import "context"
+
+// ChatContext sends the prompt to the engine, passing ctx
+// along if the engine supports it. Engines that are not
+// context aware are only checked for cancellation before
+// the request is sent.
+func ChatContext(ctx context.Context, engine LLM, prompt *ChatPrompt) (*ChatMessage, error) {
+	if engine, ok := engine.(LLMWithContext); ok {
+		return engine.ChatContext(ctx, prompt)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return engine.Chat(prompt)
+}
+
+// ChatWithFunctionsContext is the native function call
+// counterpart of ChatContext.
+func ChatWithFunctionsContext(ctx context.Context, engine LLMWithFunctionCalls, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	if engine, ok := engine.(LLMWithFunctionCallsContext); ok {
+		return engine.ChatWithFunctionsContext(ctx, prompt, functions)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return engine.ChatWithFunctions(prompt, functions)
+}
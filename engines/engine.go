@@ -1,5 +1,7 @@
 package engines
 
+import "context"
+
 //go:generate mockgen -source=engine.go -destination=mocks/engine.go -package=mocks
 type LLM interface {
 	Chat(prompt *ChatPrompt) (*ChatMessage, error)
@@ -10,13 +12,56 @@ type LLMWithFunctionCalls interface {
 	ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error)
 }
 
+// An LLM whose requests can be cancelled
+// through a context.
+type LLMWithContext interface {
+	LLM
+	ChatContext(ctx context.Context, prompt *ChatPrompt) (*ChatMessage, error)
+}
+
+// An LLM with native function calls whose
+// requests can be cancelled through a context.
+type LLMWithFunctionCallsContext interface {
+	LLMWithFunctionCalls
+	ChatWithFunctionsContext(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error)
+}
+
+// An LLM that can stream its responses
+// as they are generated.
+type LLMWithStreaming interface {
+	LLM
+	// Sends the prompt, calling onDelta with each
+	// partial message as it arrives, and returns
+	// the complete message. Native functions are
+	// offered to the model only if functions is
+	// not empty.
+	ChatStream(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs, onDelta func(delta *ChatMessage)) (*ChatMessage, error)
+}
+
+// The JSON schema of a value. A schema
+// without a type allows any value.
 type ParameterSpecs struct {
-	Type        string                     `json:"type"`
+	Type        string                     `json:"type,omitempty"`
 	Description string                     `json:"description,omitempty"`
 	Properties  map[string]*ParameterSpecs `json:"properties,omitempty"`
 	Required    []string                   `json:"required,omitempty"`
 	Items       *ParameterSpecs            `json:"items,omitempty"`
 	Enum        []any                      `json:"enum,omitempty"`
+	// The schema of the values of the
+	// properties an object may have, for maps.
+	AdditionalProperties *ParameterSpecs `json:"additionalProperties,omitempty"`
+	// Whether an object may have no properties other
+	// than Properties, i.e. additionalProperties is false.
+	NoAdditionalProperties bool `json:"-"`
+	// Whether the value may also be null, in which case
+	// the type is encoded as [Type, "null"].
+	Nullable bool `json:"-"`
+	// The schemas of which the value must match any.
+	AnyOf   []*ParameterSpecs `json:"anyOf,omitempty"`
+	Format  string            `json:"format,omitempty"`
+	Minimum *float64          `json:"minimum,omitempty"`
+	Maximum *float64          `json:"maximum,omitempty"`
+	Default any               `json:"default,omitempty"`
 }
 
 type FunctionSpecs struct {
@@ -0,0 +1,112 @@
+package engines
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrAuthentication        = errors.New("authentication failed")
+	ErrServerError           = errors.New("server error")
+)
+
+// An error response from an LLM API. It wraps
+// one of ErrRateLimited, ErrContextLengthExceeded,
+// ErrAuthentication and ErrServerError where
+// applicable, so callers can use errors.Is.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	// How long the server asked to wait
+	// before retrying, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API error (status %d)", e.StatusCode)
+	}
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.Code == "context_length_exceeded":
+		return ErrContextLengthExceeded
+	case e.StatusCode == http.StatusTooManyRequests && e.Code != "insufficient_quota":
+		return ErrRateLimited
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrAuthentication
+	case e.StatusCode >= 500:
+		return ErrServerError
+	default:
+		return nil
+	}
+}
+
+// newAPIError builds an APIError from an unsuccessful
+// response, in the error format used by OpenAI.
+func newAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header),
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return apiErr
+	}
+	var errorResponse struct {
+		Error json.RawMessage `json:"error"`
+	}
+	var errorDetails struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err != nil || len(errorResponse.Error) == 0 {
+		apiErr.Message = string(body)
+		return apiErr
+	}
+	// some servers, e.g. Ollama, respond with a plain error message
+	if err := json.Unmarshal(errorResponse.Error, &apiErr.Message); err == nil {
+		return apiErr
+	}
+	if err := json.Unmarshal(errorResponse.Error, &errorDetails); err != nil || errorDetails.Message == "" {
+		apiErr.Message = string(body)
+		return apiErr
+	}
+	apiErr.Message = errorDetails.Message
+	apiErr.Type = errorDetails.Type
+	if errorDetails.Code != nil {
+		apiErr.Code = fmt.Sprint(errorDetails.Code)
+	}
+	return apiErr
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
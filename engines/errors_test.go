@@ -0,0 +1,69 @@
+package engines
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPTAPIErrors(t *testing.T) {
+	testCases := []struct {
+		name               string
+		status             int
+		headers            map[string]string
+		body               string
+		expectedErr        error
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name:               "rate limited",
+			status:             http.StatusTooManyRequests,
+			headers:            map[string]string{"Retry-After": "2"},
+			body:               `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			expectedErr:        ErrRateLimited,
+			expectedRetryAfter: 2 * time.Second,
+		},
+		{
+			name:        "context length exceeded",
+			status:      http.StatusBadRequest,
+			body:        `{"error": {"message": "This model's maximum context length is 4097 tokens", "type": "invalid_request_error", "code": "context_length_exceeded"}}`,
+			expectedErr: ErrContextLengthExceeded,
+		},
+		{
+			name:        "authentication failure",
+			status:      http.StatusUnauthorized,
+			body:        `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`,
+			expectedErr: ErrAuthentication,
+		},
+		{
+			name:        "server error",
+			status:      http.StatusBadGateway,
+			body:        `<html>Bad gateway</html>`,
+			expectedErr: ErrServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range tc.headers {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+			gpt := NewGPTEngine("", "model").WithBaseURL(server.URL)
+			_, err := gpt.Chat(&ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			require.ErrorIs(t, err, tc.expectedErr)
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tc.status, apiErr.StatusCode)
+			assert.Equal(t, tc.expectedRetryAfter, apiErr.RetryAfter)
+		})
+	}
+}
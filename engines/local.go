@@ -0,0 +1,442 @@
+package engines
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type LocalProtocol string
+
+const (
+	// The native Ollama chat API (/api/chat).
+	ProtocolOllama LocalProtocol = "ollama"
+	// The llama.cpp server chat API
+	// (/v1/chat/completions).
+	ProtocolLlamaCpp LocalProtocol = "llama.cpp"
+)
+
+// An engine for models served locally by
+// Ollama or a llama.cpp server.
+type LocalLLM struct {
+	BaseURL              string
+	Model                string
+	Protocol             LocalProtocol
+	Temperature          float64
+	HTTPClient           *http.Client
+	PromptTokensUsed     atomic.Int64
+	CompletionTokensUsed atomic.Int64
+	// Options applied to every request, which those
+	// of the request's context override.
+	Generation GenerationOptions
+	// Whether the model calls tools natively, rather
+	// than through the text protocol of agents. If nil,
+	// the server is asked whether the model supports
+	// tool calling the first time it matters.
+	ToolCalling *bool
+	detectTools sync.Once
+	detected    bool
+}
+
+type localMessage struct {
+	Role       string          `json:"role"`
+	Content    string          `json:"content"`
+	ToolCalls  []localToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+}
+
+type localToolCall struct {
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function localFunctionCall `json:"function"`
+}
+
+type localFunctionCall struct {
+	Name string `json:"name"`
+	// A JSON object for Ollama, and a string
+	// containing a JSON object for llama.cpp.
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type localTool struct {
+	Type     string        `json:"type"`
+	Function FunctionSpecs `json:"function"`
+}
+
+type localChatRequest struct {
+	Model       string         `json:"model"`
+	Messages    []localMessage `json:"messages"`
+	Tools       []localTool    `json:"tools,omitempty"`
+	Stream      bool           `json:"stream"`
+	Temperature *float64       `json:"temperature,omitempty"`
+	Options     map[string]any `json:"options,omitempty"`
+	// Ollama's "json" or JSON schema
+	Format any `json:"format,omitempty"`
+	// llama.cpp takes the options at the top level
+	*GenerationOptions
+}
+
+type localChatResponse struct {
+	// Ollama
+	Message         *localMessage `json:"message"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	// llama.cpp
+	ID      string `json:"id"`
+	Choices []struct {
+		Message      *localMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokensUsed     int `json:"prompt_tokens"`
+		CompletionTokensUsed int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (llm *LocalLLM) encodeMessages(history []*ChatMessage) []localMessage {
+	messages := make([]localMessage, 0, len(history))
+	for _, msg := range normalizeToolCalls(history) {
+		encoded := localMessage{
+			Role:       string(msg.Role),
+			Content:    msg.Text,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			encoded.ToolCalls = append(encoded.ToolCalls, localToolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: llm.encodeFunctionCall(&call.Function),
+			})
+		}
+		if msg.Role == ConvRoleFunction || msg.Role == ConvRoleTool {
+			encoded.Role = "tool"
+			encoded.ToolName = msg.Name
+		}
+		messages = append(messages, encoded)
+	}
+	return messages
+}
+
+func (llm *LocalLLM) encodeFunctionCall(call *FunctionCall) localFunctionCall {
+	args := json.RawMessage(call.Args)
+	if !json.Valid(args) {
+		args = json.RawMessage(`{}`)
+	}
+	if llm.Protocol == ProtocolLlamaCpp {
+		args, _ = json.Marshal(string(args))
+	}
+	return localFunctionCall{
+		Name:      call.Name,
+		Arguments: args,
+	}
+}
+
+func (llm *LocalLLM) decodeMessage(msg *localMessage) *ChatMessage {
+	decoded := &ChatMessage{
+		Role: ConvRole(msg.Role),
+		Text: msg.Content,
+	}
+	if decoded.Role == "" {
+		decoded.Role = ConvRoleAssistant
+	}
+	var calls []*ToolCall
+	for i, call := range msg.ToolCalls {
+		args := call.Function.Arguments
+		var argsString string
+		if err := json.Unmarshal(args, &argsString); err == nil {
+			args = json.RawMessage(argsString)
+		}
+		// Ollama does not assign IDs to tool calls
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		calls = append(calls, &ToolCall{
+			ID:   id,
+			Type: "function",
+			Function: FunctionCall{
+				Name: call.Function.Name,
+				Args: string(args),
+			},
+		})
+	}
+	decoded.setToolCalls(calls)
+	return decoded
+}
+
+func (llm *LocalLLM) endpoint() string {
+	baseURL := strings.TrimSuffix(llm.BaseURL, "/")
+	if llm.Protocol == ProtocolLlamaCpp {
+		return baseURL + "/v1/chat/completions"
+	}
+	return baseURL + "/api/chat"
+}
+
+func (llm *LocalLLM) chat(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return instrumentChat(ctx, string(llm.Protocol), llm.Model, prompt, functions, func(ctx context.Context) (*ChatMessage, ResponseMetadata, error) {
+		return llm.sendChat(ctx, prompt, functions)
+	})
+}
+
+func (llm *LocalLLM) sendChat(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, ResponseMetadata, error) {
+	chatRequest := localChatRequest{
+		Model:    llm.Model,
+		Messages: llm.encodeMessages(prompt.History),
+	}
+	for _, function := range functions {
+		chatRequest.Tools = append(chatRequest.Tools, localTool{
+			Type:     "function",
+			Function: function,
+		})
+	}
+	options := llm.Generation.merge(GenerationOptionsFromContext(ctx))
+	if llm.Protocol == ProtocolLlamaCpp {
+		chatRequest.Temperature = &llm.Temperature
+		chatRequest.GenerationOptions = &options
+	} else {
+		chatRequest.Options = map[string]any{"temperature": llm.Temperature}
+		options.addTo(chatRequest.Options)
+		// Ollama's name for max_tokens
+		if maxTokens, ok := chatRequest.Options["max_tokens"]; ok {
+			delete(chatRequest.Options, "max_tokens")
+			chatRequest.Options["num_predict"] = maxTokens
+		}
+		delete(chatRequest.Options, "response_format")
+		chatRequest.Format = ollamaFormat(options.ResponseFormat)
+		delete(chatRequest.Options, "tool_choice")
+		if options.ToolChoice != nil && options.ToolChoice.Mode == "none" {
+			chatRequest.Tools = nil
+		}
+	}
+	bodyJSON, err := json.Marshal(chatRequest)
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", llm.endpoint(), bytes.NewBuffer(bodyJSON))
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := llm.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return nil, ResponseMetadata{}, newAPIError(res)
+	}
+	var response localChatResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, ResponseMetadata{}, err
+	}
+	metadata := ResponseMetadata{
+		Usage: Usage{
+			PromptTokens:     response.PromptEvalCount + response.Usage.PromptTokensUsed,
+			CompletionTokens: response.EvalCount + response.Usage.CompletionTokensUsed,
+		},
+		FinishReason: response.DoneReason,
+		Model:        response.Model,
+		RequestID:    response.ID,
+	}
+	message := response.Message
+	if len(response.Choices) > 0 {
+		message = response.Choices[0].Message
+		metadata.FinishReason = response.Choices[0].FinishReason
+	}
+	llm.PromptTokensUsed.Add(int64(metadata.Usage.PromptTokens))
+	llm.CompletionTokensUsed.Add(int64(metadata.Usage.CompletionTokens))
+	if message == nil {
+		return nil, metadata, fmt.Errorf("no message in response")
+	}
+	decoded := llm.decodeMessage(message)
+	if decoded.FunctionCall == nil && decoded.Text == "" {
+		return nil, metadata, fmt.Errorf("no content in response")
+	}
+	return decoded, metadata, nil
+}
+
+func (llm *LocalLLM) Settings() ModelSettings {
+	settings := ModelSettings{
+		Provider:    string(llm.Protocol),
+		BaseURL:     strings.TrimSuffix(llm.BaseURL, "/"),
+		Model:       llm.Model,
+		Temperature: llm.Temperature,
+	}
+	if !llm.Generation.isZero() {
+		settings.Options = map[string]any{}
+		llm.Generation.addTo(settings.Options)
+	}
+	return settings
+}
+
+func (llm *LocalLLM) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
+	return llm.chat(context.Background(), prompt, nil)
+}
+
+func (llm *LocalLLM) ChatContext(ctx context.Context, prompt *ChatPrompt) (*ChatMessage, error) {
+	return llm.chat(ctx, prompt, nil)
+}
+
+// Offers the functions to the model as tools. The server
+// responds with an error if the model does not support
+// tool calling.
+func (llm *LocalLLM) ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return llm.chat(context.Background(), prompt, functions)
+}
+
+func (llm *LocalLLM) ChatWithFunctionsContext(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return llm.chat(ctx, prompt, functions)
+}
+
+// SupportsFunctionCalls reports whether the model calls
+// tools natively, as set with WithToolCalling or else
+// as reported by the server.
+func (llm *LocalLLM) SupportsFunctionCalls() bool {
+	if llm.ToolCalling != nil {
+		return *llm.ToolCalling
+	}
+	llm.detectTools.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		supported, err := llm.detectToolCalling(ctx)
+		if err != nil {
+			log.Debugf("Failed to detect whether %s supports tool calling, assuming it does not: %v", llm.Model, err)
+		}
+		llm.detected = supported
+	})
+	return llm.detected
+}
+
+func (llm *LocalLLM) SupportsStreaming() bool {
+	return false
+}
+
+func (llm *LocalLLM) SupportsResponseFormat() bool {
+	return true
+}
+
+// detectToolCalling asks the server whether the model
+// supports tool calling: Ollama lists the capabilities
+// of models, and llama.cpp those of its chat template.
+func (llm *LocalLLM) detectToolCalling(ctx context.Context) (bool, error) {
+	baseURL := strings.TrimSuffix(llm.BaseURL, "/")
+	var req *http.Request
+	var err error
+	if llm.Protocol == ProtocolLlamaCpp {
+		req, err = http.NewRequestWithContext(ctx, "GET", baseURL+"/props", nil)
+	} else {
+		body, _ := json.Marshal(map[string]string{"model": llm.Model})
+		req, err = http.NewRequestWithContext(ctx, "POST", baseURL+"/api/show", bytes.NewBuffer(body))
+	}
+	if err != nil {
+		return false, err
+	}
+	client := llm.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return false, newAPIError(res)
+	}
+	var info struct {
+		// Ollama
+		Capabilities []string `json:"capabilities"`
+		// llama.cpp
+		ChatTemplateCaps struct {
+			SupportsTools bool `json:"supports_tools"`
+		} `json:"chat_template_caps"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return false, err
+	}
+	if llm.Protocol == ProtocolLlamaCpp {
+		return info.ChatTemplateCaps.SupportsTools, nil
+	}
+	for _, capability := range info.Capabilities {
+		if capability == "tools" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Creates an engine for a model served by Ollama
+// on its default address.
+func NewOllamaEngine(model string) *LocalLLM {
+	return &LocalLLM{
+		BaseURL:     "http://localhost:11434",
+		Model:       model,
+		Protocol:    ProtocolOllama,
+		Temperature: 1,
+	}
+}
+
+// Creates an engine for the model served by the
+// llama.cpp server at baseURL.
+func NewLlamaCppEngine(baseURL string) *LocalLLM {
+	return &LocalLLM{
+		BaseURL:     baseURL,
+		Protocol:    ProtocolLlamaCpp,
+		Temperature: 1,
+	}
+}
+
+func (llm *LocalLLM) WithBaseURL(baseURL string) *LocalLLM {
+	llm.BaseURL = baseURL
+	return llm
+}
+
+func (llm *LocalLLM) WithTemperature(temperature float64) *LocalLLM {
+	llm.Temperature = temperature
+	return llm
+}
+
+func (llm *LocalLLM) WithHTTPClient(client *http.Client) *LocalLLM {
+	llm.HTTPClient = client
+	return llm
+}
+
+func (llm *LocalLLM) WithGenerationOptions(options GenerationOptions) *LocalLLM {
+	llm.Generation = options
+	return llm
+}
+
+// Sets whether agents offer tools to the model natively,
+// instead of asking the server whether it supports them.
+func (llm *LocalLLM) WithToolCalling(enabled bool) *LocalLLM {
+	llm.ToolCalling = &enabled
+	return llm
+}
+
+// ollamaFormat returns Ollama's format for
+// the response format, if there is one.
+func ollamaFormat(format *ResponseFormat) any {
+	switch {
+	case format == nil || format.Type == ResponseFormatText:
+		return nil
+	case format.Type == ResponseFormatJSONSchema && format.JSONSchema != nil && format.JSONSchema.Schema != nil:
+		return format.JSONSchema.Schema
+	default:
+		return "json"
+	}
+}
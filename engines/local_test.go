@@ -0,0 +1,303 @@
+package engines
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var localFunctionCallPrompt = &ChatPrompt{
+	History: []*ChatMessage{
+		{Role: ConvRoleSystem, Text: "You are helpful."},
+		{Role: ConvRoleUser, Text: "What's the weather?"},
+		{Role: ConvRoleAssistant, FunctionCall: &FunctionCall{Name: "weather", Args: `{"city": "Paris"}`}},
+		{Role: ConvRoleFunction, Name: "weather", Text: `"sunny"`},
+	},
+}
+
+var localWeatherFunction = FunctionSpecs{
+	Name:        "weather",
+	Description: "Gets the weather",
+	Parameters: &ParameterSpecs{
+		Type: "object",
+		Properties: map[string]*ParameterSpecs{
+			"city": {Type: "string"},
+		},
+	},
+}
+
+func newMockLocalServer(t *testing.T, path, reply string, onRequest func(body map[string]any)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, path, r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		onRequest(body)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOllamaEngine(t *testing.T) {
+	var request map[string]any
+	server := newMockLocalServer(t, "/api/chat",
+		`{"message": {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "Rome"}}}]}, "done": true, "done_reason": "stop", "prompt_eval_count": 10, "eval_count": 4}`,
+		func(body map[string]any) { request = body },
+	)
+	engine := NewOllamaEngine("llama3.1").WithBaseURL(server.URL).WithTemperature(0)
+	response, err := engine.ChatWithFunctions(localFunctionCallPrompt, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+
+	assert.Positive(t, response.Metadata.Latency)
+	response.Metadata.Latency = 0
+	assert.Equal(t, &ChatMessage{
+		Role:         ConvRoleAssistant,
+		FunctionCall: &FunctionCall{Name: "weather", Args: `{"city": "Rome"}`},
+		ToolCalls: []*ToolCall{
+			{ID: "call_0", Type: "function", Function: FunctionCall{Name: "weather", Args: `{"city": "Rome"}`}},
+		},
+		Metadata: &ResponseMetadata{
+			Usage:        Usage{PromptTokens: 10, CompletionTokens: 4},
+			FinishReason: FinishReasonStop,
+			Model:        "llama3.1",
+		},
+	}, response)
+	assert.EqualValues(t, 10, engine.PromptTokensUsed.Load())
+	assert.EqualValues(t, 4, engine.CompletionTokensUsed.Load())
+
+	messages := request["messages"].([]any)
+	require.Len(t, messages, 4)
+	call := messages[2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)["function"].(map[string]any)
+	assert.Equal(t, map[string]any{"city": "Paris"}, call["arguments"])
+	reply := messages[3].(map[string]any)
+	assert.Equal(t, "tool", reply["role"])
+	assert.Equal(t, "weather", reply["tool_name"])
+	assert.Equal(t, false, request["stream"])
+	assert.Equal(t, map[string]any{"temperature": float64(0)}, request["options"])
+	assert.Len(t, request["tools"], 1)
+}
+
+func TestLlamaCppEngine(t *testing.T) {
+	var request map[string]any
+	server := newMockLocalServer(t, "/v1/chat/completions",
+		`{"id": "chatcmpl-1", "model": "qwen2.5", "choices": [{"message": {"role": "assistant", "content": "It is sunny in Paris."}, "finish_reason": "length"}], "usage": {"prompt_tokens": 12, "completion_tokens": 6}}`,
+		func(body map[string]any) { request = body },
+	)
+	engine := NewLlamaCppEngine(server.URL)
+	response, err := engine.ChatWithFunctions(localFunctionCallPrompt, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+
+	assert.Positive(t, response.Metadata.Latency)
+	response.Metadata.Latency = 0
+	assert.Equal(t, &ChatMessage{
+		Role: ConvRoleAssistant,
+		Text: "It is sunny in Paris.",
+		Metadata: &ResponseMetadata{
+			Usage:        Usage{PromptTokens: 12, CompletionTokens: 6},
+			FinishReason: FinishReasonLength,
+			Model:        "qwen2.5",
+			RequestID:    "chatcmpl-1",
+		},
+	}, response)
+	assert.EqualValues(t, 12, engine.PromptTokensUsed.Load())
+	assert.EqualValues(t, 6, engine.CompletionTokensUsed.Load())
+
+	messages := request["messages"].([]any)
+	call := messages[2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	assert.Equal(t, `{"city": "Paris"}`, call["function"].(map[string]any)["arguments"])
+	reply := messages[3].(map[string]any)
+	assert.Equal(t, "tool", reply["role"])
+	assert.Equal(t, call["id"], reply["tool_call_id"])
+}
+
+func TestOllamaEngineError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "registry.ollama.ai/library/gemma:2b does not support tools"}`))
+	}))
+	defer server.Close()
+	_, err := NewOllamaEngine("gemma:2b").WithBaseURL(server.URL).ChatWithFunctions(localFunctionCallPrompt, []FunctionSpecs{localWeatherFunction})
+	require.EqualError(t, err, "API error (status 400): registry.ollama.ai/library/gemma:2b does not support tools")
+}
+
+func TestLocalGenerationOptions(t *testing.T) {
+	options := GenerationOptions{Stop: []string{"<END>"}, MaxTokens: 64, TopP: 0.9}
+	testCases := []struct {
+		name            string
+		path            string
+		reply           string
+		newEngine       func(url string) *LocalLLM
+		expectedRequest func(body map[string]any)
+	}{
+		{
+			name:  "ollama",
+			path:  "/api/chat",
+			reply: `{"message": {"role": "assistant", "content": "hi"}, "done": true}`,
+			newEngine: func(url string) *LocalLLM {
+				return NewOllamaEngine("llama3.1").WithBaseURL(url).WithTemperature(0)
+			},
+			expectedRequest: func(body map[string]any) {
+				assert.Equal(t, map[string]any{
+					"temperature": float64(0),
+					"stop":        []any{"<END>"},
+					"num_predict": float64(64),
+					"top_p":       0.9,
+				}, body["options"])
+			},
+		},
+		{
+			name:  "llama.cpp",
+			path:  "/v1/chat/completions",
+			reply: `{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`,
+			newEngine: func(url string) *LocalLLM {
+				return NewLlamaCppEngine(url)
+			},
+			expectedRequest: func(body map[string]any) {
+				assert.Equal(t, []any{"<END>"}, body["stop"])
+				assert.Equal(t, float64(64), body["max_tokens"])
+				assert.Equal(t, 0.9, body["top_p"])
+				assert.NotContains(t, body, "options")
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var request map[string]any
+			server := newMockLocalServer(t, tc.path, tc.reply, func(body map[string]any) { request = body })
+			engine := tc.newEngine(server.URL).WithGenerationOptions(options)
+			_, err := engine.Chat(&ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			require.NoError(t, err)
+			tc.expectedRequest(request)
+		})
+	}
+}
+
+func TestOllamaResponseFormat(t *testing.T) {
+	schema := &ParameterSpecs{Type: "object", Properties: map[string]*ParameterSpecs{"city": {Type: "string"}}}
+	testCases := []struct {
+		name           string
+		format         *ResponseFormat
+		expectedFormat any
+	}{
+		{
+			name:           "text",
+			format:         &ResponseFormat{Type: ResponseFormatText},
+			expectedFormat: nil,
+		},
+		{
+			name:           "json object",
+			format:         JSONObjectFormat(),
+			expectedFormat: "json",
+		},
+		{
+			name:   "json schema",
+			format: JSONSchemaFormat("answer", schema, true),
+			expectedFormat: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var request map[string]any
+			server := newMockLocalServer(t, "/api/chat",
+				`{"message": {"role": "assistant", "content": "{}"}, "done": true}`,
+				func(body map[string]any) { request = body },
+			)
+			engine := NewOllamaEngine("llama3.1").WithBaseURL(server.URL).WithTemperature(0)
+			ctx := ContextWithGenerationOptions(context.Background(), GenerationOptions{ResponseFormat: tc.format})
+			_, err := engine.ChatContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFormat, request["format"])
+			assert.Equal(t, map[string]any{"temperature": float64(0)}, request["options"])
+		})
+	}
+}
+
+func TestOllamaToolChoiceNone(t *testing.T) {
+	var request map[string]any
+	server := newMockLocalServer(t, "/api/chat",
+		`{"message": {"role": "assistant", "content": "{}"}, "done": true}`,
+		func(body map[string]any) { request = body },
+	)
+	engine := NewOllamaEngine("llama3.1").WithBaseURL(server.URL)
+	ctx := ContextWithGenerationOptions(context.Background(), GenerationOptions{ToolChoice: &ToolChoice{Mode: "none"}})
+	_, err := engine.ChatWithFunctionsContext(ctx, localFunctionCallPrompt, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+	assert.NotContains(t, request, "tools")
+	assert.NotContains(t, request["options"], "tool_choice")
+}
+
+func TestLocalToolCallingSupport(t *testing.T) {
+	testCases := []struct {
+		name     string
+		engine   func(baseURL string) *LocalLLM
+		path     string
+		reply    string
+		status   int
+		expected bool
+	}{
+		{
+			name:     "ollama model with tools",
+			engine:   func(baseURL string) *LocalLLM { return NewOllamaEngine("llama3.1").WithBaseURL(baseURL) },
+			path:     "/api/show",
+			reply:    `{"capabilities": ["completion", "tools"]}`,
+			expected: true,
+		},
+		{
+			name:     "ollama model without tools",
+			engine:   func(baseURL string) *LocalLLM { return NewOllamaEngine("gemma:2b").WithBaseURL(baseURL) },
+			path:     "/api/show",
+			reply:    `{"capabilities": ["completion"]}`,
+			expected: false,
+		},
+		{
+			name:     "llama.cpp template with tools",
+			engine:   NewLlamaCppEngine,
+			path:     "/props",
+			reply:    `{"chat_template_caps": {"supports_tools": true}}`,
+			expected: true,
+		},
+		{
+			name:     "detection failure",
+			engine:   func(baseURL string) *LocalLLM { return NewOllamaEngine("llama3.1").WithBaseURL(baseURL) },
+			path:     "/api/show",
+			status:   http.StatusNotFound,
+			expected: false,
+		},
+		{
+			name: "explicitly enabled",
+			engine: func(baseURL string) *LocalLLM {
+				return NewOllamaEngine("gemma:2b").WithBaseURL(baseURL).WithToolCalling(true)
+			},
+			path:     "/api/show",
+			reply:    `{"capabilities": ["completion"]}`,
+			expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				assert.Equal(t, tc.path, r.URL.Path)
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				w.Write([]byte(tc.reply))
+			}))
+			defer server.Close()
+			engine := tc.engine(server.URL)
+			assert.Equal(t, tc.expected, SupportsFunctionCalls(engine))
+			assert.Equal(t, tc.expected, SupportsFunctionCalls(engine))
+			assert.LessOrEqual(t, requests, 1)
+		})
+	}
+}
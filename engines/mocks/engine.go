@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -101,3 +102,177 @@ func (mr *MockLLMWithFunctionCallsMockRecorder) ChatWithFunctions(prompt, functi
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChatWithFunctions", reflect.TypeOf((*MockLLMWithFunctionCalls)(nil).ChatWithFunctions), prompt, functions)
 }
+
+// MockLLMWithContext is a mock of LLMWithContext interface.
+type MockLLMWithContext struct {
+	ctrl     *gomock.Controller
+	recorder *MockLLMWithContextMockRecorder
+}
+
+// MockLLMWithContextMockRecorder is the mock recorder for MockLLMWithContext.
+type MockLLMWithContextMockRecorder struct {
+	mock *MockLLMWithContext
+}
+
+// NewMockLLMWithContext creates a new mock instance.
+func NewMockLLMWithContext(ctrl *gomock.Controller) *MockLLMWithContext {
+	mock := &MockLLMWithContext{ctrl: ctrl}
+	mock.recorder = &MockLLMWithContextMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLLMWithContext) EXPECT() *MockLLMWithContextMockRecorder {
+	return m.recorder
+}
+
+// Chat mocks base method.
+func (m *MockLLMWithContext) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chat", prompt)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chat indicates an expected call of Chat.
+func (mr *MockLLMWithContextMockRecorder) Chat(prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chat", reflect.TypeOf((*MockLLMWithContext)(nil).Chat), prompt)
+}
+
+// ChatContext mocks base method.
+func (m *MockLLMWithContext) ChatContext(ctx context.Context, prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChatContext", ctx, prompt)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChatContext indicates an expected call of ChatContext.
+func (mr *MockLLMWithContextMockRecorder) ChatContext(ctx, prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChatContext", reflect.TypeOf((*MockLLMWithContext)(nil).ChatContext), ctx, prompt)
+}
+
+// MockLLMWithFunctionCallsContext is a mock of LLMWithFunctionCallsContext interface.
+type MockLLMWithFunctionCallsContext struct {
+	ctrl     *gomock.Controller
+	recorder *MockLLMWithFunctionCallsContextMockRecorder
+}
+
+// MockLLMWithFunctionCallsContextMockRecorder is the mock recorder for MockLLMWithFunctionCallsContext.
+type MockLLMWithFunctionCallsContextMockRecorder struct {
+	mock *MockLLMWithFunctionCallsContext
+}
+
+// NewMockLLMWithFunctionCallsContext creates a new mock instance.
+func NewMockLLMWithFunctionCallsContext(ctrl *gomock.Controller) *MockLLMWithFunctionCallsContext {
+	mock := &MockLLMWithFunctionCallsContext{ctrl: ctrl}
+	mock.recorder = &MockLLMWithFunctionCallsContextMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLLMWithFunctionCallsContext) EXPECT() *MockLLMWithFunctionCallsContextMockRecorder {
+	return m.recorder
+}
+
+// Chat mocks base method.
+func (m *MockLLMWithFunctionCallsContext) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chat", prompt)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chat indicates an expected call of Chat.
+func (mr *MockLLMWithFunctionCallsContextMockRecorder) Chat(prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chat", reflect.TypeOf((*MockLLMWithFunctionCallsContext)(nil).Chat), prompt)
+}
+
+// ChatWithFunctions mocks base method.
+func (m *MockLLMWithFunctionCallsContext) ChatWithFunctions(prompt *engines.ChatPrompt, functions []engines.FunctionSpecs) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChatWithFunctions", prompt, functions)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChatWithFunctions indicates an expected call of ChatWithFunctions.
+func (mr *MockLLMWithFunctionCallsContextMockRecorder) ChatWithFunctions(prompt, functions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChatWithFunctions", reflect.TypeOf((*MockLLMWithFunctionCallsContext)(nil).ChatWithFunctions), prompt, functions)
+}
+
+// ChatWithFunctionsContext mocks base method.
+func (m *MockLLMWithFunctionCallsContext) ChatWithFunctionsContext(ctx context.Context, prompt *engines.ChatPrompt, functions []engines.FunctionSpecs) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChatWithFunctionsContext", ctx, prompt, functions)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChatWithFunctionsContext indicates an expected call of ChatWithFunctionsContext.
+func (mr *MockLLMWithFunctionCallsContextMockRecorder) ChatWithFunctionsContext(ctx, prompt, functions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChatWithFunctionsContext", reflect.TypeOf((*MockLLMWithFunctionCallsContext)(nil).ChatWithFunctionsContext), ctx, prompt, functions)
+}
+
+// MockLLMWithStreaming is a mock of LLMWithStreaming interface.
+type MockLLMWithStreaming struct {
+	ctrl     *gomock.Controller
+	recorder *MockLLMWithStreamingMockRecorder
+}
+
+// MockLLMWithStreamingMockRecorder is the mock recorder for MockLLMWithStreaming.
+type MockLLMWithStreamingMockRecorder struct {
+	mock *MockLLMWithStreaming
+}
+
+// NewMockLLMWithStreaming creates a new mock instance.
+func NewMockLLMWithStreaming(ctrl *gomock.Controller) *MockLLMWithStreaming {
+	mock := &MockLLMWithStreaming{ctrl: ctrl}
+	mock.recorder = &MockLLMWithStreamingMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLLMWithStreaming) EXPECT() *MockLLMWithStreamingMockRecorder {
+	return m.recorder
+}
+
+// Chat mocks base method.
+func (m *MockLLMWithStreaming) Chat(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chat", prompt)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chat indicates an expected call of Chat.
+func (mr *MockLLMWithStreamingMockRecorder) Chat(prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chat", reflect.TypeOf((*MockLLMWithStreaming)(nil).Chat), prompt)
+}
+
+// ChatStream mocks base method.
+func (m *MockLLMWithStreaming) ChatStream(ctx context.Context, prompt *engines.ChatPrompt, functions []engines.FunctionSpecs, onDelta func(*engines.ChatMessage)) (*engines.ChatMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChatStream", ctx, prompt, functions, onDelta)
+	ret0, _ := ret[0].(*engines.ChatMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChatStream indicates an expected call of ChatStream.
+func (mr *MockLLMWithStreamingMockRecorder) ChatStream(ctx, prompt, functions, onDelta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChatStream", reflect.TypeOf((*MockLLMWithStreaming)(nil).ChatStream), ctx, prompt, functions, onDelta)
+}
@@ -2,36 +2,128 @@ package engines
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 )
 
 var ErrTokenLimitExceeded = fmt.Errorf("token limit exceeded")
+
+// The base URL used by GPT engines
+// that do not set their own.
 var OpenAIBaseURL = "https://api.openai.com"
 
+// An engine for OpenAI's Chat Completions API. A GPT engine
+// is safe for concurrent use once it is configured; the usage
+// of each call is reported in the Metadata of its response.
 type GPT struct {
-	APIToken             string
-	Model                string
-	PromptTokensUsed     int
-	CompletionTokensUsed int
+	APIToken string
+	Model    string
+	// The tokens used by all calls so far.
+	PromptTokensUsed     atomic.Int64
+	CompletionTokensUsed atomic.Int64
 	PromptTokenLimit     int
 	CompletionTokenLimit int
 	TotalTokenLimit      int
-	Temperature          float64
+	// The context window of the model, in tokens.
+	// Defaults to ContextWindow(Model).
+	ContextWindow int
+	Temperature   float64
+	// The base URL of the OpenAI-compatible API.
+	// Defaults to OpenAIBaseURL.
+	BaseURL string
+	// The client used for sending requests.
+	// Defaults to http.DefaultClient.
+	HTTPClient   *http.Client
+	Headers      http.Header
+	Organization string
+	Project      string
+	// Controls which tool the model calls, if any,
+	// when functions are offered. Defaults to auto.
+	ToolChoice *ToolChoice
+	// Whether the model may call several tools in
+	// one turn. Defaults to the API's default.
+	ParallelToolCalls *bool
+	// Whether agents offer tools to the model natively,
+	// rather than through their text protocol. Defaults
+	// to true.
+	ToolCalling *bool
+	// Options applied to every request, which those
+	// of the request's context override.
+	Generation GenerationOptions
 }
 
 type ChatCompletionRequest struct {
-	Model       string          `json:"model"`
-	Temperature float64         `json:"temperature,omitempty"`
-	Messages    []*ChatMessage  `json:"messages"`
-	Functions   []FunctionSpecs `json:"functions,omitempty"`
+	Model             string         `json:"model"`
+	Temperature       float64        `json:"temperature,omitempty"`
+	Messages          []*ChatMessage `json:"messages"`
+	Tools             []ToolSpecs    `json:"tools,omitempty"`
+	ToolChoice        *ToolChoice    `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool          `json:"parallel_tool_calls,omitempty"`
+	Stream            bool           `json:"stream,omitempty"`
+	StreamOptions     *StreamOptions `json:"stream_options,omitempty"`
+	Stop              []string       `json:"stop,omitempty"`
+	MaxTokens         int            `json:"max_tokens,omitempty"`
+	// Replaces MaxTokens for reasoning models.
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	TopP                float64         `json:"top_p,omitempty"`
+	Seed                *int            `json:"seed,omitempty"`
+	FrequencyPenalty    float64         `json:"frequency_penalty,omitempty"`
+	PresencePenalty     float64         `json:"presence_penalty,omitempty"`
+	ResponseFormat      *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ToolSpecs struct {
+	Type     string        `json:"type"`
+	Function FunctionSpecs `json:"function"`
+}
+
+// ToolChoice controls whether the model calls a tool. Mode
+// is one of "auto", "none" and "required", unless Function
+// names a specific function the model must call.
+type ToolChoice struct {
+	Mode     string
+	Function string
+}
+
+func (choice ToolChoice) MarshalJSON() ([]byte, error) {
+	if choice.Function != "" {
+		return json.Marshal(map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": choice.Function},
+		})
+	}
+	return json.Marshal(choice.Mode)
+}
+
+func (choice *ToolChoice) UnmarshalJSON(data []byte) error {
+	var function struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(data, &function); err == nil {
+		*choice = ToolChoice{Function: function.Function.Name}
+		return nil
+	}
+	*choice = ToolChoice{}
+	return json.Unmarshal(data, &choice.Mode)
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatCompletionResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
 	Choices []struct {
-		Message *ChatMessage `json:"message"`
+		Message      *ChatMessage `json:"message"`
+		FinishReason string       `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
 		PromptTokensUsed     int `json:"prompt_tokens"`
@@ -39,71 +131,246 @@ type ChatCompletionResponse struct {
 	} `json:"usage"`
 }
 
-func (gpt *GPT) chat(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+func (gpt *GPT) chat(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return instrumentChat(ctx, "openai", gpt.Model, prompt, functions, func(ctx context.Context) (*ChatMessage, ResponseMetadata, error) {
+		res, err := gpt.sendRequest(ctx, prompt, functions, false)
+		if err != nil {
+			return nil, ResponseMetadata{}, err
+		}
+		defer res.Body.Close()
+		message, metadata, err := gpt.parseResponseBody(res.Body)
+		if requestID := res.Header.Get("x-request-id"); requestID != "" {
+			metadata.RequestID = requestID
+		}
+		return message, metadata, err
+	})
+}
+
+func (gpt *GPT) sendRequest(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs, stream bool) (*http.Response, error) {
 	if gpt.isLimitExceeded() {
 		return nil, ErrTokenLimitExceeded
 	}
+	if err := gpt.checkPromptSize(prompt, functions); err != nil {
+		return nil, err
+	}
+	options := gpt.Generation.merge(GenerationOptionsFromContext(ctx))
 	completionRequest := ChatCompletionRequest{
-		Model:       gpt.Model,
-		Messages:    prompt.History,
-		Temperature: gpt.Temperature,
+		Model:            gpt.Model,
+		Messages:         normalizeToolCalls(prompt.History),
+		Temperature:      gpt.Temperature,
+		Stop:             options.Stop,
+		TopP:             options.TopP,
+		Seed:             options.Seed,
+		FrequencyPenalty: options.FrequencyPenalty,
+		PresencePenalty:  options.PresencePenalty,
+		ResponseFormat:   options.ResponseFormat,
+	}
+	if isReasoningModel(gpt.Model) {
+		completionRequest.MaxCompletionTokens = options.MaxTokens
+	} else {
+		completionRequest.MaxTokens = options.MaxTokens
+	}
+	for _, msg := range completionRequest.Messages {
+		if msg.Role == ConvRoleTool {
+			msg.Name = ""
+		}
 	}
 	if len(functions) > 0 {
-		completionRequest.Functions = functions
+		for _, function := range functions {
+			completionRequest.Tools = append(completionRequest.Tools, ToolSpecs{
+				Type:     "function",
+				Function: function,
+			})
+		}
+		completionRequest.ToolChoice = gpt.ToolChoice
+		if options.ToolChoice != nil {
+			completionRequest.ToolChoice = options.ToolChoice
+		}
+		completionRequest.ParallelToolCalls = gpt.ParallelToolCalls
+	}
+	if stream {
+		completionRequest.Stream = true
+		completionRequest.StreamOptions = &StreamOptions{IncludeUsage: true}
 	}
 	bodyJSON, err := json.Marshal(completionRequest)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
-		fmt.Sprintf("%s/v1/chat/completions", OpenAIBaseURL),
+		fmt.Sprintf("%s/v1/chat/completions", gpt.baseURL()),
 		bytes.NewBuffer([]byte(bodyJSON)),
 	)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Bearer "+gpt.APIToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
+	req.Header.Set("Authorization", "Bearer "+gpt.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	if gpt.Organization != "" {
+		req.Header.Set("OpenAI-Organization", gpt.Organization)
+	}
+	if gpt.Project != "" {
+		req.Header.Set("OpenAI-Project", gpt.Project)
+	}
+	for key, values := range gpt.Headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	res, err := gpt.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	return gpt.parseResponseBody(res.Body)
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		return nil, newAPIError(res)
+	}
+	return res, nil
+}
+
+// isReasoningModel reports whether the model is one of
+// OpenAI's reasoning models, which take the maximum number
+// of tokens as max_completion_tokens.
+func isReasoningModel(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gpt *GPT) baseURL() string {
+	if gpt.BaseURL != "" {
+		return strings.TrimSuffix(gpt.BaseURL, "/")
+	}
+	return OpenAIBaseURL
+}
+
+func (gpt *GPT) httpClient() *http.Client {
+	if gpt.HTTPClient != nil {
+		return gpt.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (gpt *GPT) Settings() ModelSettings {
+	settings := ModelSettings{
+		Provider:    "openai",
+		BaseURL:     gpt.baseURL(),
+		Model:       gpt.Model,
+		Temperature: gpt.Temperature,
+		Options:     map[string]any{},
+	}
+	if gpt.ToolChoice != nil {
+		settings.Options["tool_choice"] = gpt.ToolChoice
+	}
+	if gpt.ParallelToolCalls != nil {
+		settings.Options["parallel_tool_calls"] = *gpt.ParallelToolCalls
+	}
+	gpt.Generation.addTo(settings.Options)
+	return settings
 }
 
 func (gpt *GPT) ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
-	return gpt.chat(prompt, functions)
+	return gpt.chat(context.Background(), prompt, functions)
+}
+
+func (gpt *GPT) ChatWithFunctionsContext(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return gpt.chat(ctx, prompt, functions)
 }
 
 func (gpt *GPT) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
-	return gpt.chat(prompt, nil)
+	return gpt.chat(context.Background(), prompt, nil)
+}
+
+func (gpt *GPT) ChatContext(ctx context.Context, prompt *ChatPrompt) (*ChatMessage, error) {
+	return gpt.chat(ctx, prompt, nil)
 }
 
 func (gpt *GPT) isLimitExceeded() bool {
-	return gpt.PromptTokenLimit > 0 && gpt.PromptTokensUsed > gpt.PromptTokenLimit ||
-		gpt.CompletionTokenLimit > 0 && gpt.CompletionTokensUsed > gpt.CompletionTokenLimit ||
-		gpt.TotalTokenLimit > 0 && gpt.PromptTokensUsed+gpt.CompletionTokensUsed > gpt.TotalTokenLimit
+	promptTokens, completionTokens := gpt.tokensUsed()
+	return gpt.PromptTokenLimit > 0 && promptTokens > gpt.PromptTokenLimit ||
+		gpt.CompletionTokenLimit > 0 && completionTokens > gpt.CompletionTokenLimit ||
+		gpt.TotalTokenLimit > 0 && promptTokens+completionTokens > gpt.TotalTokenLimit
 }
 
-func (gpt *GPT) parseResponseBody(body io.Reader) (*ChatMessage, error) {
+func (gpt *GPT) tokensUsed() (promptTokens, completionTokens int) {
+	return int(gpt.PromptTokensUsed.Load()), int(gpt.CompletionTokensUsed.Load())
+}
+
+func (gpt *GPT) addUsage(used Usage) {
+	gpt.PromptTokensUsed.Add(int64(used.PromptTokens))
+	gpt.CompletionTokensUsed.Add(int64(used.CompletionTokens))
+}
+
+// checkPromptSize refuses prompts that would exceed the token
+// limits or the context window, before they are sent.
+func (gpt *GPT) checkPromptSize(prompt *ChatPrompt, functions []FunctionSpecs) error {
+	window := gpt.ContextWindow
+	if window == 0 {
+		window = ContextWindow(gpt.Model)
+	}
+	if window <= 0 && gpt.PromptTokenLimit <= 0 && gpt.TotalTokenLimit <= 0 {
+		return nil
+	}
+	tokens := CountPromptTokens(gpt.Model, prompt.History, functions)
+	promptTokens, completionTokens := gpt.tokensUsed()
+	switch {
+	case gpt.PromptTokenLimit > 0 && promptTokens+tokens > gpt.PromptTokenLimit:
+		return fmt.Errorf("%w: the prompt has %d tokens, but only %d of the %d prompt tokens are left",
+			ErrTokenLimitExceeded, tokens, gpt.PromptTokenLimit-promptTokens, gpt.PromptTokenLimit)
+	case gpt.TotalTokenLimit > 0 && promptTokens+completionTokens+tokens > gpt.TotalTokenLimit:
+		return fmt.Errorf("%w: the prompt has %d tokens, but only %d of the %d tokens are left",
+			ErrTokenLimitExceeded, tokens, gpt.TotalTokenLimit-promptTokens-completionTokens, gpt.TotalTokenLimit)
+	case window > 0 && tokens > window:
+		return fmt.Errorf("%w: the prompt has %d tokens, but the context window of %s is %d tokens",
+			ErrContextLengthExceeded, tokens, gpt.Model, window)
+	}
+	return nil
+}
+
+func (gpt *GPT) parseResponseBody(body io.Reader) (*ChatMessage, ResponseMetadata, error) {
 	var buf bytes.Buffer
 	tee := io.TeeReader(body, &buf)
 	var response ChatCompletionResponse
 	err := json.NewDecoder(tee).Decode(&response)
 	if err != nil {
-		return nil, err
+		return nil, ResponseMetadata{}, err
 	}
-	gpt.PromptTokensUsed += response.Usage.PromptTokensUsed
-	gpt.CompletionTokensUsed += response.Usage.CompletionTokensUsed
+	metadata := ResponseMetadata{
+		Usage: Usage{
+			PromptTokens:     response.Usage.PromptTokensUsed,
+			CompletionTokens: response.Usage.CompletionTokensUsed,
+		},
+		Model:     response.Model,
+		RequestID: response.ID,
+	}
+	gpt.addUsage(metadata.Usage)
 	if len(response.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in response: %s", buf.String())
+		return nil, metadata, fmt.Errorf("no choices in response: %s", buf.String())
+	}
+	metadata.FinishReason = openAIFinishReason(response.Choices[0].FinishReason)
+	message := response.Choices[0].Message
+	if message == nil {
+		return nil, metadata, fmt.Errorf("no content in response: %s", buf.String())
+	}
+	message.setToolCalls(message.ToolCalls)
+	if message.FunctionCall == nil && message.Text == "" {
+		return nil, metadata, fmt.Errorf("no content in response: %s", buf.String())
 	}
-	if response.Choices[0].Message.FunctionCall == nil && response.Choices[0].Message.Text == "" {
-		return nil, fmt.Errorf("no content in response: %s", buf.String())
+	return message, metadata, nil
+}
+
+// openAIFinishReason reports the legacy
+// function_call reason as tool_calls.
+func openAIFinishReason(reason string) string {
+	if reason == "function_call" {
+		return FinishReasonToolCalls
 	}
-	return response.Choices[0].Message, nil
+	return reason
 }
 
 func NewGPTEngine(apiToken string, model string) *GPT {
@@ -129,7 +396,79 @@ func (gpt *GPT) WithTotalTokenLimit(limit int) *GPT {
 	return gpt
 }
 
+// Sets the context window of the model, for
+// models that ContextWindows does not list.
+func (gpt *GPT) WithContextWindow(tokens int) *GPT {
+	gpt.ContextWindow = tokens
+	return gpt
+}
+
 func (gpt *GPT) WithTemperature(temperature float64) *GPT {
 	gpt.Temperature = temperature
 	return gpt
 }
+
+// Sends requests to the OpenAI-compatible API at baseURL,
+// e.g. a vLLM or LocalAI server, instead of OpenAIBaseURL.
+func (gpt *GPT) WithBaseURL(baseURL string) *GPT {
+	gpt.BaseURL = baseURL
+	return gpt
+}
+
+func (gpt *GPT) WithHTTPClient(client *http.Client) *GPT {
+	gpt.HTTPClient = client
+	return gpt
+}
+
+// Adds a header to every request sent by the engine,
+// replacing the engine's own header of the same name.
+func (gpt *GPT) WithHeader(key, value string) *GPT {
+	if gpt.Headers == nil {
+		gpt.Headers = http.Header{}
+	}
+	gpt.Headers.Add(key, value)
+	return gpt
+}
+
+func (gpt *GPT) WithToolChoice(choice *ToolChoice) *GPT {
+	gpt.ToolChoice = choice
+	return gpt
+}
+
+func (gpt *GPT) WithParallelToolCalls(enabled bool) *GPT {
+	gpt.ParallelToolCalls = &enabled
+	return gpt
+}
+
+// Sets whether agents offer tools to the model natively.
+func (gpt *GPT) WithToolCalling(enabled bool) *GPT {
+	gpt.ToolCalling = &enabled
+	return gpt
+}
+
+func (gpt *GPT) SupportsFunctionCalls() bool {
+	return gpt.ToolCalling == nil || *gpt.ToolCalling
+}
+
+func (gpt *GPT) SupportsStreaming() bool {
+	return true
+}
+
+func (gpt *GPT) SupportsResponseFormat() bool {
+	return true
+}
+
+func (gpt *GPT) WithGenerationOptions(options GenerationOptions) *GPT {
+	gpt.Generation = options
+	return gpt
+}
+
+func (gpt *GPT) WithOrganization(organization string) *GPT {
+	gpt.Organization = organization
+	return gpt
+}
+
+func (gpt *GPT) WithProject(project string) *GPT {
+	gpt.Project = project
+	return gpt
+}
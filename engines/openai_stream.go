@@ -0,0 +1,158 @@
+package engines
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type ChatCompletionChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta        *ChatMessage `json:"delta"`
+		FinishReason string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokensUsed     int `json:"prompt_tokens"`
+		CompletionTokensUsed int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (gpt *GPT) ChatStream(ctx context.Context, prompt *ChatPrompt, functions []FunctionSpecs, onDelta func(delta *ChatMessage)) (*ChatMessage, error) {
+	return instrumentChat(ctx, "openai", gpt.Model, prompt, functions, func(ctx context.Context) (*ChatMessage, ResponseMetadata, error) {
+		res, err := gpt.sendRequest(ctx, prompt, functions, true)
+		if err != nil {
+			return nil, ResponseMetadata{}, err
+		}
+		defer res.Body.Close()
+		message, metadata, err := gpt.parseStream(res.Body, onDelta)
+		if requestID := res.Header.Get("x-request-id"); requestID != "" {
+			metadata.RequestID = requestID
+		}
+		return message, metadata, err
+	})
+}
+
+// parseStream reads a server-sent events stream of chat
+// completion chunks, passing each delta to onDelta and
+// assembling them into the complete message.
+func (gpt *GPT) parseStream(body io.Reader, onDelta func(delta *ChatMessage)) (*ChatMessage, ResponseMetadata, error) {
+	message := &ChatMessage{Role: ConvRoleAssistant}
+	var metadata ResponseMetadata
+	var text strings.Builder
+	var data bytes.Buffer
+	received := false
+	done := false
+	processEvent := func() error {
+		defer data.Reset()
+		if data.Len() == 0 {
+			return nil
+		}
+		if bytes.Equal(data.Bytes(), []byte("[DONE]")) {
+			done = true
+			return nil
+		}
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal(data.Bytes(), &chunk); err != nil {
+			return fmt.Errorf("invalid stream chunk %q: %w", data.String(), err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("stream error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			chunkUsage := Usage{
+				PromptTokens:     chunk.Usage.PromptTokensUsed,
+				CompletionTokens: chunk.Usage.CompletionTokensUsed,
+			}
+			metadata.Usage.PromptTokens += chunkUsage.PromptTokens
+			metadata.Usage.CompletionTokens += chunkUsage.CompletionTokens
+			gpt.addUsage(chunkUsage)
+		}
+		if chunk.ID != "" {
+			metadata.RequestID = chunk.ID
+		}
+		if chunk.Model != "" {
+			metadata.Model = chunk.Model
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			metadata.FinishReason = openAIFinishReason(chunk.Choices[0].FinishReason)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta == nil {
+			return nil
+		}
+		received = true
+		delta := chunk.Choices[0].Delta
+		if delta.Role != "" {
+			message.Role = delta.Role
+		}
+		text.WriteString(delta.Text)
+		if delta.FunctionCall != nil {
+			if message.FunctionCall == nil {
+				message.FunctionCall = &FunctionCall{}
+			}
+			message.FunctionCall.Name += delta.FunctionCall.Name
+			message.FunctionCall.Args += delta.FunctionCall.Args
+		}
+		for _, callDelta := range delta.ToolCalls {
+			index := len(message.ToolCalls) - 1
+			if callDelta.Index != nil {
+				index = *callDelta.Index
+			}
+			for index >= len(message.ToolCalls) {
+				message.ToolCalls = append(message.ToolCalls, &ToolCall{Type: "function"})
+			}
+			call := message.ToolCalls[index]
+			if callDelta.ID != "" {
+				call.ID = callDelta.ID
+			}
+			call.Function.Name += callDelta.Function.Name
+			call.Function.Args += callDelta.Function.Args
+		}
+		if onDelta != nil && (delta.Text != "" || delta.FunctionCall != nil || len(delta.ToolCalls) > 0) {
+			onDelta(delta)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for !done && scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := processEvent(); err != nil {
+				return nil, metadata, err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, metadata, fmt.Errorf("failed to read stream: %w", err)
+	}
+	if err := processEvent(); err != nil {
+		return nil, metadata, err
+	}
+	if !received {
+		return nil, metadata, errors.New("no choices in stream")
+	}
+	message.Text = text.String()
+	message.setToolCalls(message.ToolCalls)
+	if message.FunctionCall == nil && message.Text == "" {
+		return nil, metadata, errors.New("no content in stream")
+	}
+	return message, metadata, nil
+}
@@ -0,0 +1,85 @@
+package engines
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPTParseStream(t *testing.T) {
+	testCases := []struct {
+		name           string
+		stream         string
+		expected       *ChatMessage
+		expectedDeltas int
+		expectedErr    string
+	}{
+		{
+			name: "text",
+			stream: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\" world\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n" +
+				"data: [DONE]\n\n",
+			expected: &ChatMessage{
+				Role: ConvRoleAssistant,
+				Text: "Hello world",
+			},
+			expectedDeltas: 2,
+		},
+		{
+			name: "function call",
+			stream: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":null,\"function_call\":{\"name\":\"echo\",\"arguments\":\"\"}}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"function_call\":{\"arguments\":\"{\\\"msg\\\": \"}}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"function_call\":{\"arguments\":\"\\\"hi\\\"}\"}}}]}\n\n" +
+				"data: [DONE]\n\n",
+			expected: &ChatMessage{
+				Role: ConvRoleAssistant,
+				FunctionCall: &FunctionCall{
+					Name: "echo",
+					Args: `{"msg": "hi"}`,
+				},
+			},
+			expectedDeltas: 3,
+		},
+		{
+			name: "parallel tool calls",
+			stream: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"tool_calls\":[{\"index\":0,\"id\":\"call_a\",\"type\":\"function\",\"function\":{\"name\":\"echo\",\"arguments\":\"\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"msg\\\": \\\"a\\\"}\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_b\",\"type\":\"function\",\"function\":{\"name\":\"echo\",\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			expected: &ChatMessage{
+				Role:         ConvRoleAssistant,
+				FunctionCall: &FunctionCall{Name: "echo", Args: `{"msg": "a"}`},
+				ToolCalls: []*ToolCall{
+					{ID: "call_a", Type: "function", Function: FunctionCall{Name: "echo", Args: `{"msg": "a"}`}},
+					{ID: "call_b", Type: "function", Function: FunctionCall{Name: "echo", Args: `{}`}},
+				},
+			},
+			expectedDeltas: 3,
+		},
+		{
+			name:        "error event",
+			stream:      "data: {\"error\":{\"message\":\"overloaded\"}}\n\n",
+			expectedErr: "stream error: overloaded",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gpt := NewGPTEngine("", "gpt-3.5-turbo")
+			deltas := 0
+			message, _, err := gpt.parseStream(strings.NewReader(tc.stream), func(delta *ChatMessage) {
+				deltas++
+			})
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, message)
+			assert.Equal(t, tc.expectedDeltas, deltas)
+		})
+	}
+}
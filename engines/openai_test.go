@@ -0,0 +1,482 @@
+package engines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockOpenAIServer(t *testing.T, reply string, handler func(r *http.Request, body *ChatCompletionRequest)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if handler != nil {
+			handler(r, &body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{
+				{"message": map[string]any{"role": "assistant", "content": reply}},
+			},
+			"usage": map[string]any{"prompt_tokens": 3, "completion_tokens": 1},
+		}))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGPTRequestOptions(t *testing.T) {
+	var request *http.Request
+	var body *ChatCompletionRequest
+	server := newMockOpenAIServer(t, "hi", func(r *http.Request, b *ChatCompletionRequest) {
+		request, body = r, b
+	})
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL+"/").
+		WithHTTPClient(server.Client()).
+		WithOrganization("org").
+		WithProject("proj").
+		WithHeader("X-Gateway-Key", "secret")
+
+	response, err := gpt.Chat(&ChatPrompt{
+		History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", response.Text)
+	assert.Equal(t, "/v1/chat/completions", request.URL.Path)
+	assert.Equal(t, "Bearer token", request.Header.Get("Authorization"))
+	assert.Equal(t, "org", request.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj", request.Header.Get("OpenAI-Project"))
+	assert.Equal(t, "secret", request.Header.Get("X-Gateway-Key"))
+	assert.Equal(t, "local-model", body.Model)
+	assert.EqualValues(t, 3, gpt.PromptTokensUsed.Load())
+	assert.EqualValues(t, 1, gpt.CompletionTokensUsed.Load())
+}
+
+func TestGPTEnginesWithSeparateServers(t *testing.T) {
+	first := NewGPTEngine("", "a").WithBaseURL(newMockOpenAIServer(t, "first", nil).URL)
+	second := NewGPTEngine("", "b").WithBaseURL(newMockOpenAIServer(t, "second", nil).URL)
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+
+	response, err := first.Chat(prompt)
+	require.NoError(t, err)
+	assert.Equal(t, "first", response.Text)
+	response, err = second.Chat(prompt)
+	require.NoError(t, err)
+	assert.Equal(t, "second", response.Text)
+}
+
+func TestGPTHeaderOverridesAuthorization(t *testing.T) {
+	var request *http.Request
+	server := newMockOpenAIServer(t, "hi", func(r *http.Request, _ *ChatCompletionRequest) {
+		request = r
+	})
+	gpt := NewGPTEngine("", "model").WithBaseURL(server.URL).WithHeader("Authorization", "Basic abc")
+	_, err := gpt.Chat(&ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Basic abc"}, request.Header.Values("Authorization"))
+}
+
+func TestGPTToolCalls(t *testing.T) {
+	var body *ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = &ChatCompletionRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(body))
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [` +
+			`{"id": "call_a", "type": "function", "function": {"name": "weather", "arguments": "{\"city\": \"Rome\"}"}},` +
+			`{"id": "call_b", "type": "function", "function": {"name": "weather", "arguments": "{\"city\": \"Oslo\"}"}}` +
+			`]}}], "usage": {"prompt_tokens": 3, "completion_tokens": 1}}`))
+	}))
+	defer server.Close()
+	gpt := NewGPTEngine("", "model").
+		WithBaseURL(server.URL).
+		WithToolChoice(&ToolChoice{Mode: "required"}).
+		WithParallelToolCalls(true)
+
+	response, err := gpt.ChatWithFunctions(&ChatPrompt{
+		History: []*ChatMessage{
+			{Role: ConvRoleUser, Text: "What's the weather?"},
+			{Role: ConvRoleAssistant, FunctionCall: &FunctionCall{Name: "weather", Args: `{"city": "Paris"}`}},
+			{Role: ConvRoleFunction, Name: "weather", Text: `"sunny"`},
+			{Role: ConvRoleAssistant, ToolCalls: []*ToolCall{
+				{ID: "call_x", Type: "function", Function: FunctionCall{Name: "weather", Args: `{"city": "Lima"}`}},
+				{ID: "call_y", Type: "function", Function: FunctionCall{Name: "weather", Args: `{"city": "Baku"}`}},
+			}},
+			{Role: ConvRoleTool, ToolCallID: "call_y", Name: "weather", Text: `"windy"`},
+			{Role: ConvRoleTool, ToolCallID: "call_x", Name: "weather", Text: `"rainy"`},
+		},
+	}, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+
+	require.Len(t, response.ToolCalls, 2)
+	assert.Equal(t, "call_b", response.ToolCalls[1].ID)
+	assert.Equal(t, `{"city": "Oslo"}`, response.ToolCalls[1].Function.Args)
+	assert.Equal(t, &FunctionCall{Name: "weather", Args: `{"city": "Rome"}`}, response.FunctionCall)
+
+	assert.Equal(t, &ToolChoice{Mode: "required"}, body.ToolChoice)
+	require.Len(t, body.Tools, 1)
+	assert.Equal(t, "function", body.Tools[0].Type)
+	assert.Equal(t, "weather", body.Tools[0].Function.Name)
+	require.NotNil(t, body.ParallelToolCalls)
+	assert.True(t, *body.ParallelToolCalls)
+
+	legacyCall, legacyReply := body.Messages[1], body.Messages[2]
+	assert.Nil(t, legacyCall.FunctionCall)
+	require.Len(t, legacyCall.ToolCalls, 1)
+	assert.Equal(t, ConvRoleTool, legacyReply.Role)
+	assert.Equal(t, legacyCall.ToolCalls[0].ID, legacyReply.ToolCallID)
+	assert.Empty(t, legacyReply.Name)
+	assert.Equal(t, "call_y", body.Messages[4].ToolCallID)
+	assert.Equal(t, "call_x", body.Messages[5].ToolCallID)
+
+	// the tool choice of a request overrides the engine's
+	ctx := ContextWithGenerationOptions(context.Background(), GenerationOptions{ToolChoice: &ToolChoice{Mode: "none"}})
+	_, err = gpt.ChatWithFunctionsContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hi"}}}, []FunctionSpecs{localWeatherFunction})
+	require.NoError(t, err)
+	assert.Equal(t, &ToolChoice{Mode: "none"}, body.ToolChoice)
+}
+
+func TestToolChoiceMarshalJSON(t *testing.T) {
+	encoded, err := json.Marshal(&ToolChoice{Mode: "none"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `"none"`, string(encoded))
+	encoded, err = json.Marshal(&ToolChoice{Function: "weather"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type": "function", "function": {"name": "weather"}}`, string(encoded))
+}
+
+func TestCountPromptTokens(t *testing.T) {
+	// the example from the OpenAI cookbook, which
+	// the API reports as 129 prompt tokens
+	messages := []*ChatMessage{
+		{Role: ConvRoleSystem, Text: "You are a helpful, pattern-following assistant that translates corporate jargon into plain English."},
+		{Role: ConvRoleSystem, Name: "example_user", Text: "New synergies will help drive top-line growth."},
+		{Role: ConvRoleSystem, Name: "example_assistant", Text: "Things working well together will increase revenue."},
+		{Role: ConvRoleSystem, Name: "example_user", Text: "Let's circle back when we have more time to touch base on opportunities for increased leverage."},
+		{Role: ConvRoleSystem, Name: "example_assistant", Text: "Let's talk later when we're less busy about how to do better."},
+		{Role: ConvRoleUser, Text: "This late pivot means we don't have time to boil the ocean for the client deliverable."},
+	}
+	assert.Equal(t, 129, CountPromptTokens("gpt-4-0613", messages, nil))
+	functions := []FunctionSpecs{{
+		Name:        "echo",
+		Description: "Echoes the input",
+		Parameters:  &ParameterSpecs{Type: "object"},
+	}}
+	assert.Greater(t, CountPromptTokens("gpt-4-0613", messages, functions), 129)
+}
+
+func TestContextWindow(t *testing.T) {
+	testCases := []struct {
+		model    string
+		expected int
+	}{
+		{model: "gpt-4", expected: 8192},
+		{model: "gpt-4-0613", expected: 8192},
+		{model: "gpt-4-32k-0613", expected: 32768},
+		{model: "gpt-4o-mini", expected: 128000},
+		{model: "gpt-4.1-nano", expected: 1047576},
+		{model: "gpt-4.5-preview", expected: 128000},
+		{model: "gpt-5", expected: 400000},
+		{model: "gpt-5-mini", expected: 400000},
+		{model: "gpt-40", expected: 0},
+		{model: "llama3.1", expected: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.model, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ContextWindow(tc.model))
+		})
+	}
+}
+
+func TestGPTRefusesOversizedPrompts(t *testing.T) {
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello, how are you doing today?"}}}
+	testCases := []struct {
+		name        string
+		configure   func(gpt *GPT)
+		expectedErr error
+	}{
+		{
+			name:      "within limits",
+			configure: func(gpt *GPT) { gpt.WithPromptTokenLimit(100).WithContextWindow(100) },
+		},
+		{
+			name:        "prompt token limit",
+			configure:   func(gpt *GPT) { gpt.WithPromptTokenLimit(10) },
+			expectedErr: ErrTokenLimitExceeded,
+		},
+		{
+			name: "total token limit",
+			configure: func(gpt *GPT) {
+				gpt.WithTotalTokenLimit(100)
+				gpt.CompletionTokensUsed.Store(95)
+			},
+			expectedErr: ErrTokenLimitExceeded,
+		},
+		{
+			name:        "context window",
+			configure:   func(gpt *GPT) { gpt.WithContextWindow(10) },
+			expectedErr: ErrContextLengthExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			server := newMockOpenAIServer(t, "hi", func(*http.Request, *ChatCompletionRequest) {
+				calls++
+			})
+			gpt := NewGPTEngine("token", "local-model").
+				WithBaseURL(server.URL + "/").
+				WithHTTPClient(server.Client())
+			tc.configure(gpt)
+			_, err := gpt.Chat(prompt)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Equal(t, 0, calls, "oversized prompts should not be sent")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestGPTConcurrentCalls(t *testing.T) {
+	// the server reports as many prompt tokens as the prompt
+	// has characters, so that each call has its own usage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		promptTokens := len(body.Messages[0].Text)
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", body.Messages[0].Text)
+			fmt.Fprintf(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":%d,\"completion_tokens\":1}}\n\n", promptTokens)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{
+				{"message": map[string]any{"role": "assistant", "content": body.Messages[0].Text}},
+			},
+			"usage": map[string]any{"prompt_tokens": promptTokens, "completion_tokens": 1},
+		}))
+	}))
+	t.Cleanup(server.Close)
+	gpt := NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL).
+		WithHTTPClient(server.Client()).
+		WithTotalTokenLimit(1000000)
+
+	const callers = 16
+	var wg sync.WaitGroup
+	for i := 1; i <= callers; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := strings.Repeat("a", i)
+			prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: text}}}
+			var response *ChatMessage
+			var err error
+			if i%2 == 0 {
+				response, err = gpt.ChatStream(context.Background(), prompt, nil, nil)
+			} else {
+				response, err = gpt.Chat(prompt)
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, text, response.Text)
+			assert.Equal(t, Usage{PromptTokens: i, CompletionTokens: 1}, response.Metadata.Usage)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, callers*(callers+1)/2, gpt.PromptTokensUsed.Load())
+	assert.EqualValues(t, callers, gpt.CompletionTokensUsed.Load())
+}
+
+func TestGPTResponseMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("x-request-id", "req_123")
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024-08-06\",\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"Once upon\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024-08-06\",\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}]}\n\n")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o-2024-08-06\",\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": "chatcmpl-1", "model": "gpt-4o-2024-08-06", "choices": [{"message": {"role": "assistant", "content": "Once upon"}, "finish_reason": "length"}], "usage": {"prompt_tokens": 5, "completion_tokens": 2}}`)
+	}))
+	t.Cleanup(server.Close)
+	gpt := NewGPTEngine("token", "gpt-4o").
+		WithBaseURL(server.URL).
+		WithHTTPClient(server.Client())
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "Tell me a story"}}}
+	expected := &ResponseMetadata{
+		Usage:        Usage{PromptTokens: 5, CompletionTokens: 2},
+		FinishReason: FinishReasonLength,
+		Model:        "gpt-4o-2024-08-06",
+		RequestID:    "req_123",
+	}
+
+	response, err := gpt.Chat(prompt)
+	require.NoError(t, err)
+	assert.Positive(t, response.Metadata.Latency)
+	response.Metadata.Latency = 0
+	assert.Equal(t, expected, response.Metadata)
+
+	response, err = gpt.ChatStream(context.Background(), prompt, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Once upon", response.Text)
+	assert.Positive(t, response.Metadata.Latency)
+	response.Metadata.Latency = 0
+	assert.Equal(t, expected, response.Metadata)
+}
+
+func TestGPTGenerationOptions(t *testing.T) {
+	seed := 7
+	testCases := []struct {
+		name            string
+		model           string
+		engineOptions   GenerationOptions
+		requestOptions  []GenerationOptions
+		expectedRequest map[string]any
+	}{
+		{
+			name:            "no options",
+			model:           "gpt-4o",
+			expectedRequest: map[string]any{},
+		},
+		{
+			name:  "engine options",
+			model: "gpt-4o",
+			engineOptions: GenerationOptions{
+				Stop:             []string{"\n\n"},
+				MaxTokens:        100,
+				TopP:             0.9,
+				Seed:             &seed,
+				FrequencyPenalty: 0.5,
+				PresencePenalty:  -0.5,
+			},
+			expectedRequest: map[string]any{
+				"stop":              []any{"\n\n"},
+				"max_tokens":        float64(100),
+				"top_p":             0.9,
+				"seed":              float64(7),
+				"frequency_penalty": 0.5,
+				"presence_penalty":  -0.5,
+			},
+		},
+		{
+			name:          "request options override the engine's",
+			model:         "gpt-4o",
+			engineOptions: GenerationOptions{Stop: []string{"\n\n"}, MaxTokens: 100, TopP: 0.9},
+			requestOptions: []GenerationOptions{
+				{Stop: []string{"<END>"}, MaxTokens: 50},
+				{Stop: []string{"Observation:", "<END>"}},
+			},
+			expectedRequest: map[string]any{
+				"stop":       []any{"\n\n", "<END>", "Observation:"},
+				"max_tokens": float64(50),
+				"top_p":      0.9,
+			},
+		},
+		{
+			name:            "reasoning model",
+			model:           "o3-mini",
+			engineOptions:   GenerationOptions{MaxTokens: 100},
+			expectedRequest: map[string]any{"max_completion_tokens": float64(100)},
+		},
+		{
+			name:            "json object",
+			model:           "gpt-4o",
+			requestOptions:  []GenerationOptions{{ResponseFormat: JSONObjectFormat()}},
+			expectedRequest: map[string]any{"response_format": map[string]any{"type": "json_object"}},
+		},
+		{
+			name:  "strict json schema",
+			model: "gpt-4o",
+			requestOptions: []GenerationOptions{{ResponseFormat: JSONSchemaFormat("answer", &ParameterSpecs{
+				Type: "object",
+				Properties: map[string]*ParameterSpecs{
+					"city": {Type: "string"},
+					"unit": {Type: "string", Enum: []any{"C", "F"}},
+					"days": {
+						Type:  "array",
+						Items: &ParameterSpecs{Type: "object", Properties: map[string]*ParameterSpecs{"temp": {Type: "number"}}},
+					},
+				},
+				Required: []string{"city", "days"},
+			}, true)}},
+			expectedRequest: map[string]any{"response_format": map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "answer",
+					"strict": true,
+					"schema": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"city": map[string]any{"type": "string"},
+							// optional properties become nullable
+							"unit": map[string]any{"type": []any{"string", "null"}, "enum": []any{"C", "F", nil}},
+							"days": map[string]any{
+								"type": "array",
+								"items": map[string]any{
+									"type":                 "object",
+									"properties":           map[string]any{"temp": map[string]any{"type": []any{"number", "null"}}},
+									"required":             []any{"temp"},
+									"additionalProperties": false,
+								},
+							},
+						},
+						"required":             []any{"city", "days", "unit"},
+						"additionalProperties": false,
+					},
+				},
+			}},
+		},
+	}
+	options := []string{"stop", "max_tokens", "max_completion_tokens", "top_p", "seed", "frequency_penalty", "presence_penalty", "response_format"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`)
+			}))
+			defer server.Close()
+			gpt := NewGPTEngine("token", tc.model).
+				WithBaseURL(server.URL).
+				WithHTTPClient(server.Client()).
+				WithGenerationOptions(tc.engineOptions)
+			ctx := context.Background()
+			for _, options := range tc.requestOptions {
+				ctx = ContextWithGenerationOptions(ctx, options)
+			}
+
+			_, err := gpt.ChatContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			require.NoError(t, err)
+			sent := map[string]any{}
+			for _, option := range options {
+				if value, ok := body[option]; ok {
+					sent[option] = value
+				}
+			}
+			assert.Equal(t, tc.expectedRequest, sent)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package engines
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+)
+
+// Options that control how a model generates a response.
+// Zero values leave the provider's defaults in place.
+// Engines ignore the options their provider does not
+// support, e.g. Claude has no seed or penalties.
+type GenerationOptions struct {
+	// Sequences at which the model stops generating.
+	// The sequence itself is not part of the response.
+	Stop []string `json:"stop,omitempty"`
+	// The maximum number of tokens to generate.
+	MaxTokens int     `json:"max_tokens,omitempty"`
+	TopP      float64 `json:"top_p,omitempty"`
+	// The seed for sampling, for providers that
+	// support reproducible generation.
+	Seed             *int    `json:"seed,omitempty"`
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+	// The format the response must have.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Controls which tool the model calls, if any, when
+	// functions are offered, in place of the engine's own
+	// choice. Ollama supports only the "none" mode, by
+	// not offering the functions.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+// merge returns the options overridden by those set in
+// other. The stop sequences of both apply.
+func (o GenerationOptions) merge(other GenerationOptions) GenerationOptions {
+	merged := o
+	merged.Stop = lo.Uniq(append(append([]string{}, o.Stop...), other.Stop...))
+	if len(merged.Stop) == 0 {
+		merged.Stop = nil
+	}
+	if other.MaxTokens != 0 {
+		merged.MaxTokens = other.MaxTokens
+	}
+	if other.TopP != 0 {
+		merged.TopP = other.TopP
+	}
+	if other.Seed != nil {
+		merged.Seed = other.Seed
+	}
+	if other.FrequencyPenalty != 0 {
+		merged.FrequencyPenalty = other.FrequencyPenalty
+	}
+	if other.PresencePenalty != 0 {
+		merged.PresencePenalty = other.PresencePenalty
+	}
+	if other.ResponseFormat != nil {
+		merged.ResponseFormat = other.ResponseFormat
+	}
+	if other.ToolChoice != nil {
+		merged.ToolChoice = other.ToolChoice
+	}
+	return merged
+}
+
+// isZero reports whether no option is set.
+func (o GenerationOptions) isZero() bool {
+	return len(o.Stop) == 0 && o.MaxTokens == 0 && o.TopP == 0 &&
+		o.Seed == nil && o.FrequencyPenalty == 0 && o.PresencePenalty == 0 &&
+		o.ResponseFormat == nil && o.ToolChoice == nil
+}
+
+// addTo adds the options that are set
+// to the options of ModelSettings.
+func (o GenerationOptions) addTo(options map[string]any) {
+	if len(o.Stop) > 0 {
+		options["stop"] = o.Stop
+	}
+	if o.MaxTokens != 0 {
+		options["max_tokens"] = o.MaxTokens
+	}
+	if o.TopP != 0 {
+		options["top_p"] = o.TopP
+	}
+	if o.Seed != nil {
+		options["seed"] = *o.Seed
+	}
+	if o.FrequencyPenalty != 0 {
+		options["frequency_penalty"] = o.FrequencyPenalty
+	}
+	if o.PresencePenalty != 0 {
+		options["presence_penalty"] = o.PresencePenalty
+	}
+	if o.ResponseFormat != nil {
+		options["response_format"] = o.ResponseFormat
+	}
+	if o.ToolChoice != nil {
+		options["tool_choice"] = o.ToolChoice
+	}
+}
+
+type generationOptionsKey struct{}
+
+// ContextWithGenerationOptions applies the options to the
+// requests made with ctx, on top of the engine's own options
+// and those already in ctx. Stop sequences add up, and the
+// other options override.
+func ContextWithGenerationOptions(ctx context.Context, options GenerationOptions) context.Context {
+	return context.WithValue(ctx, generationOptionsKey{}, GenerationOptionsFromContext(ctx).merge(options))
+}
+
+// GenerationOptionsFromContext returns the options
+// that apply to the requests made with ctx.
+func GenerationOptionsFromContext(ctx context.Context) GenerationOptions {
+	options, _ := ctx.Value(generationOptionsKey{}).(GenerationOptions)
+	return options
+}
@@ -1,5 +1,10 @@
 package engines
 
+import (
+	"fmt"
+	"time"
+)
+
 type ConvRole string
 
 const (
@@ -7,13 +12,58 @@ const (
 	ConvRoleSystem    ConvRole = "system"
 	ConvRoleAssistant ConvRole = "assistant"
 	ConvRoleFunction  ConvRole = "function"
+	ConvRoleTool      ConvRole = "tool"
 )
 
 type ChatMessage struct {
-	Role         ConvRole      `json:"role"`
-	Text         string        `json:"content"`
+	Role ConvRole `json:"role"`
+	Text string   `json:"content"`
+	// The first of ToolCalls, kept for callers
+	// that predate parallel tool calls.
 	FunctionCall *FunctionCall `json:"function_call,omitempty"`
-	Name         string        `json:"name,omitempty"`
+	ToolCalls    []*ToolCall   `json:"tool_calls,omitempty"`
+	// The ID of the tool call a ConvRoleTool
+	// message replies to.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// Information about the request that produced
+	// the message, set on engine responses.
+	Metadata *ResponseMetadata `json:"-"`
+}
+
+// Information about the call that produced a response.
+type ResponseMetadata struct {
+	Usage Usage `json:"usage"`
+	// Why the model stopped generating: one of the
+	// FinishReason constants, or the provider's own
+	// reason if none of them applies.
+	FinishReason string `json:"finish_reason,omitempty"`
+	// The model that served the request, as
+	// reported by the provider.
+	Model string `json:"model,omitempty"`
+	// How long the call took.
+	Latency time.Duration `json:"latency,omitempty"`
+	// The provider's ID of the request, for
+	// correlating it with the provider's logs.
+	RequestID string `json:"request_id,omitempty"`
+	// Whether the response was served from a cache,
+	// in which case no tokens were used.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// The reasons for which a model stops generating,
+// as reported by all engines.
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonContentFilter = "content_filter"
+)
+
+// The number of tokens used by a request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 type FunctionCall struct {
@@ -21,6 +71,86 @@ type FunctionCall struct {
 	Args string `json:"arguments"`
 }
 
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+	// The position of the call in the message,
+	// set on streamed deltas only.
+	Index *int `json:"index,omitempty"`
+}
+
+// Calls returns the tool calls requested by the message,
+// including a legacy FunctionCall.
+func (msg *ChatMessage) Calls() []*ToolCall {
+	if len(msg.ToolCalls) > 0 {
+		return msg.ToolCalls
+	}
+	if msg.FunctionCall != nil {
+		return []*ToolCall{{Type: "function", Function: *msg.FunctionCall}}
+	}
+	return nil
+}
+
 type ChatPrompt struct {
 	History []*ChatMessage
 }
+
+// normalizeToolCalls returns a copy of the history in which
+// legacy function calls are converted to tool calls and
+// function replies to tool replies. Function calls carry no
+// IDs, so IDs are synthesized and each reply is matched with
+// the oldest unanswered call.
+func normalizeToolCalls(history []*ChatMessage) []*ChatMessage {
+	normalized := make([]*ChatMessage, 0, len(history))
+	var pending []string
+	for i, msg := range history {
+		encoded := *msg
+		encoded.FunctionCall = nil
+		encoded.ToolCalls = nil
+		calls := msg.Calls()
+		if len(calls) > 0 {
+			pending = nil
+		}
+		for j, call := range calls {
+			id := call.ID
+			if id == "" {
+				id = fmt.Sprintf("call_%d_%d", i, j)
+			}
+			encoded.ToolCalls = append(encoded.ToolCalls, &ToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: call.Function,
+			})
+			pending = append(pending, id)
+		}
+		switch msg.Role {
+		case ConvRoleFunction:
+			if len(pending) > 0 {
+				encoded.Role = ConvRoleTool
+				encoded.ToolCallID = pending[0]
+				pending = pending[1:]
+			}
+		case ConvRoleTool:
+			for j, id := range pending {
+				if id == msg.ToolCallID {
+					pending = append(pending[:j:j], pending[j+1:]...)
+					break
+				}
+			}
+		}
+		normalized = append(normalized, &encoded)
+	}
+	return normalized
+}
+
+// setToolCalls sets the tool calls of a response,
+// mirroring the first one in FunctionCall.
+func (msg *ChatMessage) setToolCalls(calls []*ToolCall) {
+	if len(calls) == 0 {
+		return
+	}
+	msg.ToolCalls = calls
+	call := calls[0].Function
+	msg.FunctionCall = &call
+}
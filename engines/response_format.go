@@ -0,0 +1,125 @@
+package engines
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// The types of ResponseFormat.
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// The format of a response, following OpenAI's response_format.
+// Engines whose provider cannot constrain responses, such as
+// Claude, ignore it.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// A JSON schema that responses must follow.
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      *ParameterSpecs `json:"schema"`
+	// Whether the response must follow the schema exactly.
+	// Strict schemas are sent in the form OpenAI requires,
+	// in which objects list all their properties as required
+	// and allow no others, and the properties that are not
+	// required may be null.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// JSONObjectFormat constrains responses to
+// be a JSON object, of any schema.
+func JSONObjectFormat() *ResponseFormat {
+	return &ResponseFormat{Type: ResponseFormatJSONObject}
+}
+
+// JSONSchemaFormat constrains responses to be
+// JSON that follows the schema.
+func JSONSchemaFormat(name string, schema *ParameterSpecs, strict bool) *ResponseFormat {
+	return &ResponseFormat{
+		Type: ResponseFormatJSONSchema,
+		JSONSchema: &JSONSchema{
+			Name:   name,
+			Schema: schema,
+			Strict: strict,
+		},
+	}
+}
+
+func (schema JSONSchema) MarshalJSON() ([]byte, error) {
+	type plainJSONSchema JSONSchema
+	if !schema.Strict || schema.Schema == nil {
+		return json.Marshal(plainJSONSchema(schema))
+	}
+	encoded, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	var strict map[string]any
+	if err := json.Unmarshal(encoded, &strict); err != nil {
+		return nil, err
+	}
+	makeStrict(strict)
+	return json.Marshal(struct {
+		plainJSONSchema
+		Schema map[string]any `json:"schema"`
+	}{plainJSONSchema(schema), strict})
+}
+
+// makeStrict converts the schema to the form of strict schemas.
+func makeStrict(schema map[string]any) {
+	if items, ok := schema["items"].(map[string]any); ok {
+		makeStrict(items)
+	}
+	if options, ok := schema["anyOf"].([]any); ok {
+		for _, option := range options {
+			if option, ok := option.(map[string]any); ok {
+				makeStrict(option)
+			}
+		}
+	}
+	if schema["type"] != "object" {
+		return
+	}
+	if _, ok := schema["additionalProperties"]; !ok {
+		schema["additionalProperties"] = false
+	}
+	required := map[string]bool{}
+	if names, ok := schema["required"].([]any); ok {
+		for _, name := range names {
+			required[name.(string)] = true
+		}
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(properties))
+	for name, property := range properties {
+		names = append(names, name)
+		if property, ok := property.(map[string]any); ok {
+			makeStrict(property)
+			if !required[name] {
+				makeNullable(property)
+			}
+		}
+	}
+	sort.Strings(names)
+	schema["required"] = names
+}
+
+// makeNullable allows the value of the schema to be null.
+func makeNullable(schema map[string]any) {
+	if typ, ok := schema["type"].(string); ok {
+		schema["type"] = []any{typ, "null"}
+	}
+	if options, ok := schema["anyOf"].([]any); ok {
+		schema["anyOf"] = append(options, map[string]any{"type": "null"})
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		schema["enum"] = append(enum, nil)
+	}
+}
@@ -0,0 +1,139 @@
+package engines
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// An engine wrapper that retries failed requests
+// with jittered exponential backoff, honouring
+// any Retry-After the server responds with. A
+// request the server asks to retry only after
+// more than MaxBackoff is not retried.
+type RetryingEngine struct {
+	middleware
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Decides whether a failed request should
+	// be retried. Defaults to IsRetryable.
+	ShouldRetry func(err error) bool
+}
+
+// IsRetryable reports whether a request that failed
+// with err may succeed if sent again: rate limits,
+// server errors and transport failures, e.g. timeouts,
+// connection resets and responses cut short, unless
+// the request was cancelled.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) {
+		return true
+	}
+	var (
+		apiErr *APIError
+		urlErr *url.Error
+		netErr net.Error
+	)
+	if errors.As(err, &apiErr) {
+		return false
+	}
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (r *RetryingEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	streamed := false
+	if req.stream && req.onDelta != nil {
+		onDelta := req.onDelta
+		streamedReq := *req
+		streamedReq.onDelta = func(delta *ChatMessage) {
+			streamed = true
+			onDelta(delta)
+		}
+		req = &streamedReq
+	}
+	shouldRetry := r.ShouldRetry
+	if shouldRetry == nil {
+		shouldRetry = IsRetryable
+	}
+	for attempt := 0; ; attempt++ {
+		response, err := send(ctx, r.next, req)
+		// partially streamed responses cannot be taken back
+		if err == nil || attempt >= r.MaxRetries || streamed || ctx.Err() != nil || !shouldRetry(err) {
+			return response, err
+		}
+		wait, ok := r.backoff(attempt, err)
+		if !ok {
+			return response, err
+		}
+		log.Debugf("Request failed, retrying in %s: %v", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying,
+// or false if the server asks to wait too long.
+func (r *RetryingEngine) backoff(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if r.MaxBackoff > 0 && apiErr.RetryAfter > r.MaxBackoff {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+	backoff := r.MaxBackoff
+	if attempt < 32 {
+		if exp := r.InitialBackoff << attempt; exp > 0 && (r.MaxBackoff <= 0 || exp < r.MaxBackoff) {
+			backoff = exp
+		}
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)), true
+}
+
+// Wraps the engine so that rate limited and failed requests
+// are retried, up to 3 times by default.
+func NewRetryingEngine(engine LLM) *RetryingEngine {
+	r := &RetryingEngine{
+		MaxRetries:     3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+	r.middleware = middleware{next: engine, handle: r.chat}
+	return r
+}
+
+func (r *RetryingEngine) WithMaxRetries(maxRetries int) *RetryingEngine {
+	r.MaxRetries = maxRetries
+	return r
+}
+
+func (r *RetryingEngine) WithBackoff(initial, max time.Duration) *RetryingEngine {
+	r.InitialBackoff = initial
+	r.MaxBackoff = max
+	return r
+}
+
+func (r *RetryingEngine) WithShouldRetry(shouldRetry func(err error) bool) *RetryingEngine {
+	r.ShouldRetry = shouldRetry
+	return r
+}
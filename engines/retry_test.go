@@ -0,0 +1,181 @@
+package engines
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFlakyOpenAIServer(t *testing.T, failures int, status int, retryAfter string) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error": {"message": "try again"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRetryingEngine(t *testing.T) {
+	testCases := []struct {
+		name          string
+		failures      int
+		status        int
+		retryAfter    string
+		maxRetries    int
+		expectedCalls int
+		expectedErr   error
+	}{
+		{
+			name:          "recovers from rate limit",
+			failures:      2,
+			status:        http.StatusTooManyRequests,
+			maxRetries:    3,
+			expectedCalls: 3,
+		},
+		{
+			name:          "gives up after max retries",
+			failures:      5,
+			status:        http.StatusInternalServerError,
+			maxRetries:    2,
+			expectedCalls: 3,
+			expectedErr:   ErrServerError,
+		},
+		{
+			name:          "does not retry authentication failures",
+			failures:      1,
+			status:        http.StatusUnauthorized,
+			maxRetries:    3,
+			expectedCalls: 1,
+			expectedErr:   ErrAuthentication,
+		},
+		{
+			name:          "gives up when asked to wait longer than max backoff",
+			failures:      1,
+			status:        http.StatusTooManyRequests,
+			retryAfter:    "3600",
+			maxRetries:    3,
+			expectedCalls: 1,
+			expectedErr:   ErrRateLimited,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retryAfter := tc.retryAfter
+			if retryAfter == "" {
+				retryAfter = "0"
+			}
+			server, calls := newFlakyOpenAIServer(t, tc.failures, tc.status, retryAfter)
+			engine := NewRetryingEngine(NewGPTEngine("", "model").WithBaseURL(server.URL)).
+				WithMaxRetries(tc.maxRetries).
+				WithBackoff(time.Millisecond, 10*time.Millisecond)
+			response, err := engine.Chat(&ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			assert.Equal(t, tc.expectedCalls, *calls)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "done", response.Text)
+		})
+	}
+}
+
+func TestRetryingEngineTransportErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		fail func(t *testing.T, w http.ResponseWriter)
+	}{
+		{
+			name: "connection closed",
+			fail: func(t *testing.T, w http.ResponseWriter) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.Close()
+			},
+		},
+		{
+			name: "response cut short",
+			fail: func(t *testing.T, w http.ResponseWriter) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"choices\": [")
+				buf.Flush()
+				conn.Close()
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= 2 {
+					tc.fail(t, w)
+					return
+				}
+				w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "done"}}]}`))
+			}))
+			defer server.Close()
+			engine := NewRetryingEngine(NewGPTEngine("", "model").WithBaseURL(server.URL)).
+				WithMaxRetries(3).
+				WithBackoff(time.Millisecond, 10*time.Millisecond)
+			response, err := engine.Chat(&ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+			require.NoError(t, err)
+			assert.Equal(t, "done", response.Text)
+			assert.Equal(t, 3, calls)
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(io.ErrUnexpectedEOF))
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", URL: "http://localhost", Err: io.EOF}))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", URL: "http://localhost", Err: context.Canceled}))
+	assert.False(t, IsRetryable(&APIError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, IsRetryable(ErrTokenLimitExceeded))
+}
+
+func TestRetryingEngineStopsOnCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	engine := NewRetryingEngine(NewGPTEngine("", "model").WithBaseURL(server.URL)).
+		WithBackoff(time.Minute, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := engine.ChatContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRetryingEngineCapabilities(t *testing.T) {
+	assert.True(t, SupportsFunctionCalls(NewRetryingEngine(NewGPTEngine("", "model"))))
+	assert.True(t, SupportsStreaming(NewRetryingEngine(NewGPTEngine("", "model"))))
+	assert.False(t, SupportsFunctionCalls(NewRetryingEngine(&textOnlyEngine{})))
+	assert.False(t, SupportsFunctionCalls(NewRetryingEngine(NewGPTEngine("", "model").WithToolCalling(false))))
+	assert.False(t, SupportsFunctionCalls(NewClaudeEngine("", "model").WithToolCalling(false)))
+	assert.True(t, SupportsFunctionCalls(NewClaudeEngine("", "model")))
+	_, err := NewRetryingEngine(&textOnlyEngine{}).ChatWithFunctions(&ChatPrompt{}, nil)
+	assert.ErrorIs(t, err, ErrFunctionCallsUnsupported)
+}
+
+type textOnlyEngine struct{}
+
+func (*textOnlyEngine) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
+	return &ChatMessage{Role: ConvRoleAssistant, Text: "ok"}, nil
+}
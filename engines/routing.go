@@ -0,0 +1,177 @@
+package engines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+// An engine that sends each request to the first of
+// its engines, falling back to the next one when a
+// request fails. It supports native function calls
+// and response formats only if all of its engines do,
+// so that agents degrade to text actions rather than
+// fail when the request falls back to an engine
+// without them. Engines that cannot stream answer
+// streamed requests in a single delta.
+type FallbackEngine struct {
+	middleware
+	Engines []LLM
+	// Decides whether a failed request should be sent
+	// to the next engine. Defaults to falling back on
+	// any error, e.g. a rate limit, a server error or
+	// ErrTokenLimitExceeded, unless the request was
+	// cancelled.
+	ShouldFallback func(err error) bool
+}
+
+func shouldFallback(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (f *FallbackEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	fallback := f.ShouldFallback
+	if fallback == nil {
+		fallback = shouldFallback
+	}
+	var errs *multierror.Error
+	for i, engine := range f.Engines {
+		if req.withFunctions && !SupportsFunctionCalls(engine) {
+			errs = multierror.Append(errs, fmt.Errorf("engine %d: %w", i, ErrFunctionCallsUnsupported))
+			continue
+		}
+		response, streamed, err := f.send(ctx, engine, req)
+		if err == nil {
+			return response, nil
+		}
+		errs = multierror.Append(errs, fmt.Errorf("engine %d: %w", i, err))
+		// partially streamed responses cannot be taken back
+		if ctx.Err() != nil || streamed || !fallback(err) {
+			return nil, err
+		}
+		log.Debugf("Engine %d failed, falling back: %v", i, err)
+	}
+	if errs == nil {
+		return nil, errors.New("no engines to send the request to")
+	}
+	return nil, fmt.Errorf("all engines failed: %w", errs)
+}
+
+func (f *FallbackEngine) send(ctx context.Context, engine LLM, req *chatRequest) (response *ChatMessage, streamed bool, err error) {
+	if !req.stream || req.onDelta == nil {
+		response, err = send(ctx, engine, req)
+		return response, false, err
+	}
+	if !SupportsStreaming(engine) {
+		response, err = send(ctx, engine, &chatRequest{
+			prompt:        req.prompt,
+			functions:     req.functions,
+			withFunctions: len(req.functions) > 0,
+		})
+		if err == nil {
+			delta := *response
+			delta.Metadata = nil
+			req.onDelta(&delta)
+		}
+		return response, false, err
+	}
+	streamedReq := *req
+	streamedReq.onDelta = func(delta *ChatMessage) {
+		streamed = true
+		req.onDelta(delta)
+	}
+	response, err = send(ctx, engine, &streamedReq)
+	return response, streamed, err
+}
+
+// Sends requests to the engines in order,
+// until one of them succeeds.
+func NewFallbackEngine(engines ...LLM) *FallbackEngine {
+	f := &FallbackEngine{Engines: engines}
+	var primary LLM
+	if len(engines) > 0 {
+		primary = engines[0]
+	}
+	f.middleware = middleware{next: primary, handle: f.chat}
+	return f
+}
+
+func (f *FallbackEngine) SupportsFunctionCalls() bool {
+	return len(f.Engines) > 0 && lo.EveryBy(f.Engines, SupportsFunctionCalls)
+}
+
+func (f *FallbackEngine) SupportsResponseFormat() bool {
+	return len(f.Engines) > 0 && lo.EveryBy(f.Engines, SupportsResponseFormat)
+}
+
+func (f *FallbackEngine) WithShouldFallback(shouldFallback func(err error) bool) *FallbackEngine {
+	f.ShouldFallback = shouldFallback
+	return f
+}
+
+// An engine that routes each request to an engine
+// chosen by the component that made it (see
+// ComponentFromContext), e.g. to serve JSONAutoFixer
+// and SummarisedMemory with a cheaper model than the
+// agent. Its capabilities are those of the engine
+// that serves ComponentAgent, so agents use native
+// function calls only if that engine supports them.
+type RoutingEngine struct {
+	middleware
+	Default LLM
+	Routes  map[string]LLM
+}
+
+func (r *RoutingEngine) engineFor(component string) LLM {
+	if engine, ok := r.Routes[component]; ok {
+		return engine
+	}
+	return r.Default
+}
+
+func (r *RoutingEngine) chat(ctx context.Context, req *chatRequest) (*ChatMessage, error) {
+	component := ComponentFromContext(ctx)
+	engine := r.engineFor(component)
+	if engine == nil {
+		return nil, fmt.Errorf("no engine to route %q requests to", component)
+	}
+	return send(ctx, engine, req)
+}
+
+func (r *RoutingEngine) SupportsFunctionCalls() bool {
+	return SupportsFunctionCalls(r.engineFor(ComponentAgent))
+}
+
+func (r *RoutingEngine) SupportsStreaming() bool {
+	return SupportsStreaming(r.engineFor(ComponentAgent))
+}
+
+func (r *RoutingEngine) SupportsResponseFormat() bool {
+	return SupportsResponseFormat(r.engineFor(ComponentAgent))
+}
+
+func (r *RoutingEngine) Settings() ModelSettings {
+	return EngineSettings(r.engineFor(ComponentAgent))
+}
+
+// Routes requests to defaultEngine,
+// unless a route applies to them.
+func NewRoutingEngine(defaultEngine LLM) *RoutingEngine {
+	r := &RoutingEngine{
+		Default: defaultEngine,
+		Routes:  make(map[string]LLM),
+	}
+	r.middleware = middleware{handle: r.chat}
+	return r
+}
+
+// Routes the requests made by the
+// component to the engine.
+func (r *RoutingEngine) WithRoute(component string, engine LLM) *RoutingEngine {
+	r.Routes[component] = engine
+	return r
+}
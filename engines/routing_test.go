@@ -0,0 +1,172 @@
+package engines
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scriptedEngine struct {
+	reply string
+	err   error
+	calls int
+}
+
+func (e *scriptedEngine) Chat(prompt *ChatPrompt) (*ChatMessage, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &ChatMessage{Role: ConvRoleAssistant, Text: e.reply}, nil
+}
+
+type scriptedFunctionEngine struct {
+	scriptedEngine
+}
+
+func (e *scriptedFunctionEngine) ChatWithFunctions(prompt *ChatPrompt, functions []FunctionSpecs) (*ChatMessage, error) {
+	return e.Chat(prompt)
+}
+
+func TestFallbackEngine(t *testing.T) {
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+	testCases := []struct {
+		name           string
+		engines        []*scriptedEngine
+		shouldFallback func(err error) bool
+		expectedReply  string
+		expectedCalls  []int
+		expectedErr    error
+	}{
+		{
+			name: "primary succeeds",
+			engines: []*scriptedEngine{
+				{reply: "primary"},
+				{reply: "secondary"},
+			},
+			expectedReply: "primary",
+			expectedCalls: []int{1, 0},
+		},
+		{
+			name: "falls back on rate limit",
+			engines: []*scriptedEngine{
+				{err: &APIError{StatusCode: 429}},
+				{reply: "secondary"},
+			},
+			expectedReply: "secondary",
+			expectedCalls: []int{1, 1},
+		},
+		{
+			name: "falls back on token limit",
+			engines: []*scriptedEngine{
+				{err: ErrTokenLimitExceeded},
+				{err: &APIError{StatusCode: 500}},
+				{reply: "tertiary"},
+			},
+			expectedReply: "tertiary",
+			expectedCalls: []int{1, 1, 1},
+		},
+		{
+			name: "all engines fail",
+			engines: []*scriptedEngine{
+				{err: ErrTokenLimitExceeded},
+				{err: &APIError{StatusCode: 429}},
+			},
+			expectedCalls: []int{1, 1},
+			expectedErr:   ErrRateLimited,
+		},
+		{
+			name: "custom fallback condition",
+			engines: []*scriptedEngine{
+				{err: &APIError{StatusCode: 401}},
+				{reply: "secondary"},
+			},
+			shouldFallback: IsRetryable,
+			expectedCalls:  []int{1, 0},
+			expectedErr:    ErrAuthentication,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var backends []LLM
+			for _, engine := range tc.engines {
+				backends = append(backends, engine)
+			}
+			engine := NewFallbackEngine(backends...).WithShouldFallback(tc.shouldFallback)
+			response, err := engine.Chat(prompt)
+			for i, engine := range tc.engines {
+				assert.Equal(t, tc.expectedCalls[i], engine.calls, "calls to engine %d", i)
+			}
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedReply, response.Text)
+		})
+	}
+}
+
+func TestFallbackEngineCapabilities(t *testing.T) {
+	textOnly := &scriptedEngine{reply: "text"}
+	withFunctions := &scriptedFunctionEngine{scriptedEngine{err: ErrServerError}}
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+
+	gpt := NewGPTEngine("token", "gpt-4.1")
+	assert.True(t, SupportsFunctionCalls(NewFallbackEngine(withFunctions, gpt)))
+	assert.True(t, SupportsResponseFormat(NewFallbackEngine(gpt, gpt)))
+	assert.False(t, SupportsFunctionCalls(NewFallbackEngine(textOnly, withFunctions)))
+	assert.False(t, SupportsResponseFormat(NewFallbackEngine(gpt, textOnly)))
+	assert.False(t, SupportsFunctionCalls(NewFallbackEngine()))
+
+	// agents use text actions, so that the
+	// text only engine can serve them
+	engine := NewFallbackEngine(withFunctions, textOnly)
+	assert.False(t, SupportsFunctionCalls(engine))
+	response, err := engine.Chat(prompt)
+	require.NoError(t, err)
+	assert.Equal(t, "text", response.Text)
+
+	// text only engines cannot serve function calls
+	_, err = engine.ChatWithFunctions(prompt, []FunctionSpecs{{Name: "echo"}})
+	assert.ErrorIs(t, err, ErrFunctionCallsUnsupported)
+	assert.Equal(t, 1, textOnly.calls)
+
+	// engines that cannot stream answer in a single delta
+	var deltas []string
+	response, err = engine.ChatStream(context.Background(), prompt, nil, func(delta *ChatMessage) {
+		deltas = append(deltas, delta.Text)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "text", response.Text)
+	assert.Equal(t, []string{"text"}, deltas)
+}
+
+func TestRoutingEngine(t *testing.T) {
+	strong := &scriptedFunctionEngine{scriptedEngine{reply: "strong"}}
+	cheap := &scriptedEngine{reply: "cheap"}
+	engine := NewRoutingEngine(strong).
+		WithRoute(ComponentJSONAutoFixer, cheap).
+		WithRoute(ComponentSummarisedMemory, cheap)
+	prompt := &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}}
+
+	testCases := []struct {
+		component     string
+		expectedReply string
+	}{
+		{component: ComponentAgent, expectedReply: "strong"},
+		{component: ComponentJSONAutoFixer, expectedReply: "cheap"},
+		{component: ComponentSummarisedMemory, expectedReply: "cheap"},
+		{component: "", expectedReply: "strong"},
+	}
+	for _, tc := range testCases {
+		ctx := ContextWithComponent(context.Background(), tc.component)
+		response, err := engine.ChatContext(ctx, prompt)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedReply, response.Text, "component %q", tc.component)
+	}
+	assert.True(t, SupportsFunctionCalls(engine))
+	assert.False(t, SupportsFunctionCalls(NewRoutingEngine(strong).WithRoute(ComponentAgent, cheap)))
+}
@@ -0,0 +1,407 @@
+package engines
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf derives the JSON schema of the JSON encoding
+// of v's type from the type's struct tags:
+//
+//   - json: the name of the property, and whether it is
+//     left out (`json:"-"`) or optional (omitempty).
+//   - description: the description of the property.
+//   - enum: the comma-separated values the property may take.
+//     For slices and maps, it applies to their elements.
+//   - required: "true" or "false", overriding whether the
+//     property is required. Properties are required unless
+//     they are pointers or omitempty.
+//   - format, minimum and maximum: the JSON schema keywords
+//     of the same names.
+//
+// Types that implement json.Marshaler, other than
+// time.Time, are described as any value.
+func SchemaOf(v any) (*ParameterSpecs, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &ParameterSpecs{}, nil
+	}
+	return schemaOfType(t, map[reflect.Type]bool{})
+}
+
+func schemaOfType(t reflect.Type, visiting map[reflect.Type]bool) (*ParameterSpecs, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.String() == "time.Time":
+		return &ParameterSpecs{Type: "string", Format: "date-time"}, nil
+	case t == rawMessageType || t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		return &ParameterSpecs{}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &ParameterSpecs{Type: "string"}, nil
+	case reflect.Bool:
+		return &ParameterSpecs{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &ParameterSpecs{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &ParameterSpecs{Type: "number"}, nil
+	case reflect.Interface:
+		return &ParameterSpecs{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoded as base64
+			return &ParameterSpecs{Type: "string"}, nil
+		}
+		items, err := schemaOfType(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &ParameterSpecs{Type: "array", Items: items}, nil
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := schemaOfType(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &ParameterSpecs{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			// recursive types are not described beyond
+			// their first level
+			return &ParameterSpecs{Type: "object"}, nil
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		schema := &ParameterSpecs{Type: "object", Properties: map[string]*ParameterSpecs{}}
+		if err := addFields(schema, t, visiting); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// addFields adds the properties of the fields of the
+// struct type t to schema. The fields of embedded structs
+// without a JSON name are added as well, as encoding/json
+// promotes them.
+func addFields(schema *ParameterSpecs, t reflect.Type, visiting map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if err := addFields(schema, fieldType, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property, err := schemaOfType(field.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		property.Description = field.Tag.Get("description")
+		if enum, ok := field.Tag.Lookup("enum"); ok {
+			if err := setEnum(property, enum); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		if format, ok := field.Tag.Lookup("format"); ok {
+			property.Format = format
+		}
+		for tag, bound := range map[string]**float64{"minimum": &property.Minimum, "maximum": &property.Maximum} {
+			value, ok := field.Tag.Lookup(tag)
+			if !ok {
+				continue
+			}
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid %s tag: %w", field.Name, tag, err)
+			}
+			*bound = &number
+		}
+		required := field.Type.Kind() != reflect.Pointer && !hasOption(options, "omitempty")
+		if value, ok := field.Tag.Lookup("required"); ok {
+			required, err = strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid required tag: %w", field.Name, err)
+			}
+		}
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// setEnum sets the values of the enum tag on the schema,
+// or on its elements if it is an array or a map.
+func setEnum(schema *ParameterSpecs, tag string) error {
+	switch {
+	case schema.Items != nil:
+		schema = schema.Items
+	case schema.AdditionalProperties != nil:
+		schema = schema.AdditionalProperties
+	}
+	for _, value := range strings.Split(tag, ",") {
+		value = strings.TrimSpace(value)
+		switch schema.Type {
+		case "integer":
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid enum value %q: %w", value, err)
+			}
+			schema.Enum = append(schema.Enum, number)
+		case "number":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid enum value %q: %w", value, err)
+			}
+			schema.Enum = append(schema.Enum, number)
+		case "boolean":
+			boolean, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid enum value %q: %w", value, err)
+			}
+			schema.Enum = append(schema.Enum, boolean)
+		default:
+			schema.Enum = append(schema.Enum, value)
+		}
+	}
+	return nil
+}
+
+// FuzzySchema returns the fuzzy form of the schema that
+// prompts show, as in tools.Tool's ArgsSchema. It has the
+// shape of the JSON values the schema describes, with
+// descriptions in place of the values, e.g.
+// {"stocks": ["stock tickers"]}.
+func FuzzySchema(schema *ParameterSpecs) json.RawMessage {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(fuzzySchema(schema, "")); err != nil {
+		// only strings, maps and slices are encoded
+		panic(err)
+	}
+	return bytes.TrimSuffix(encoded.Bytes(), []byte("\n"))
+}
+
+// fuzzySchema returns the fuzzy form of schema.
+// Values without a description of their own are
+// described by that of their container, if any.
+func fuzzySchema(schema *ParameterSpecs, containerDescription string) any {
+	description := schema.Description
+	if description == "" {
+		description = containerDescription
+	}
+	switch {
+	case schema.Properties != nil:
+		properties := map[string]any{}
+		for name, property := range schema.Properties {
+			properties[name] = fuzzySchema(property, "")
+		}
+		return properties
+	case schema.AdditionalProperties != nil:
+		return map[string]any{"<key>": fuzzySchema(schema.AdditionalProperties, description)}
+	case schema.Items != nil:
+		return []any{fuzzySchema(schema.Items, description)}
+	case len(schema.AnyOf) > 0 && description == "":
+		options := make([]string, 0, len(schema.AnyOf))
+		for _, option := range schema.AnyOf {
+			options = append(options, fmt.Sprint(fuzzySchema(option, "")))
+		}
+		return strings.Join(options, " or ")
+	}
+	if len(schema.Enum) > 0 {
+		values := make([]string, 0, len(schema.Enum))
+		for _, value := range schema.Enum {
+			values = append(values, fmt.Sprint(value))
+		}
+		if description == "" {
+			return strings.Join(values, "/")
+		}
+		return fmt.Sprintf("%s (%s)", description, strings.Join(values, "/"))
+	}
+	switch {
+	case description != "":
+		return description
+	case schema.Type != "":
+		return schema.Type
+	default:
+		return "any value"
+	}
+}
+
+// parameterSpecsJSON is the JSON encoding of ParameterSpecs,
+// whose type and additionalProperties may take other forms.
+type parameterSpecsJSON struct {
+	plainParameterSpecs
+	Type                 any `json:"type,omitempty"`
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+}
+
+type plainParameterSpecs ParameterSpecs
+
+func (specs ParameterSpecs) MarshalJSON() ([]byte, error) {
+	encoded := parameterSpecsJSON{plainParameterSpecs: plainParameterSpecs(specs)}
+	switch {
+	case specs.Nullable && specs.Type != "":
+		encoded.Type = []string{specs.Type, "null"}
+	case specs.Type != "":
+		encoded.Type = specs.Type
+	}
+	switch {
+	case specs.NoAdditionalProperties:
+		encoded.AdditionalProperties = false
+	case specs.AdditionalProperties != nil:
+		encoded.AdditionalProperties = specs.AdditionalProperties
+	}
+	return json.Marshal(encoded)
+}
+
+func (specs *ParameterSpecs) UnmarshalJSON(data []byte) error {
+	var encoded struct {
+		plainParameterSpecs
+		Type                 json.RawMessage `json:"type,omitempty"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	*specs = ParameterSpecs(encoded.plainParameterSpecs)
+	if len(encoded.Type) > 0 && json.Unmarshal(encoded.Type, &specs.Type) != nil {
+		var types []string
+		if err := json.Unmarshal(encoded.Type, &types); err != nil {
+			return fmt.Errorf("invalid type: %s", encoded.Type)
+		}
+		for _, typ := range types {
+			switch {
+			case typ == "null":
+				specs.Nullable = true
+			case specs.Type == "":
+				specs.Type = typ
+			default:
+				return fmt.Errorf("unsupported type %s: use anyOf for values of several types", encoded.Type)
+			}
+		}
+	}
+	if len(encoded.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(encoded.AdditionalProperties, &allowed); err == nil {
+			specs.NoAdditionalProperties = !allowed
+		} else if err := json.Unmarshal(encoded.AdditionalProperties, &specs.AdditionalProperties); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseJSONSchema parses the JSON schema into ParameterSpecs.
+// It fails if the schema uses keywords that ParameterSpecs
+// cannot express, rather than leave them out.
+func ParseJSONSchema(schema json.RawMessage) (*ParameterSpecs, error) {
+	var specs ParameterSpecs
+	if err := json.Unmarshal(schema, &specs); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	var original any
+	if err := json.Unmarshal(schema, &original); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	reencoded, err := json.Marshal(&specs)
+	if err != nil {
+		return nil, err
+	}
+	var parsed any
+	if err := json.Unmarshal(reencoded, &parsed); err != nil {
+		return nil, err
+	}
+	if path, ok := firstDifference(original, parsed, ""); ok {
+		return nil, fmt.Errorf("unsupported JSON schema at %q", path)
+	}
+	return &specs, nil
+}
+
+// firstDifference returns the path to the first
+// value in which a and b differ, if any.
+func firstDifference(a, b any, path string) (string, bool) {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok {
+			return path, true
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if path, ok := firstDifference(a[key], b[key], path+"/"+key); ok {
+				return path, true
+			}
+		}
+		return "", false
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return path, true
+		}
+		for i := range a {
+			if path, ok := firstDifference(a[i], b[i], fmt.Sprintf("%s/%d", path, i)); ok {
+				return path, true
+			}
+		}
+		return "", false
+	default:
+		return path, !reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,214 @@
+package engines
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaTestAddress struct {
+	City string `json:"city" description:"the city"`
+}
+
+type schemaTestTree struct {
+	Value    int               `json:"value"`
+	Children []*schemaTestTree `json:"children,omitempty"`
+}
+
+type schemaTestEmbedded struct {
+	ID string `json:"id"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	testCases := []struct {
+		name        string
+		value       any
+		expected    *ParameterSpecs
+		expectedErr string
+	}{
+		{
+			name:     "string",
+			value:    "",
+			expected: &ParameterSpecs{Type: "string"},
+		},
+		{
+			name: "struct tags",
+			value: struct {
+				Name     string             `json:"name" description:"the name"`
+				Age      int                `json:"age,omitempty"`
+				Unit     string             `json:"unit" enum:"C,F" required:"false"`
+				Levels   []int              `json:"levels" enum:"1,2,3"`
+				Scores   map[string]float64 `json:"scores"`
+				Address  *schemaTestAddress `json:"address" required:"true"`
+				Extra    any                `json:"extra,omitempty"`
+				Untagged bool
+				Skipped  string `json:"-"`
+				hidden   string
+			}{},
+			expected: &ParameterSpecs{
+				Type: "object",
+				Properties: map[string]*ParameterSpecs{
+					"name":   {Type: "string", Description: "the name"},
+					"age":    {Type: "integer"},
+					"unit":   {Type: "string", Enum: []any{"C", "F"}},
+					"levels": {Type: "array", Items: &ParameterSpecs{Type: "integer", Enum: []any{int64(1), int64(2), int64(3)}}},
+					"scores": {Type: "object", AdditionalProperties: &ParameterSpecs{Type: "number"}},
+					"address": {
+						Type:       "object",
+						Properties: map[string]*ParameterSpecs{"city": {Type: "string", Description: "the city"}},
+						Required:   []string{"city"},
+					},
+					"extra":    {},
+					"Untagged": {Type: "boolean"},
+				},
+				Required: []string{"name", "levels", "scores", "address", "Untagged"},
+			},
+		},
+		{
+			name: "embedded struct",
+			value: struct {
+				schemaTestEmbedded
+				CreatedAt time.Time       `json:"created_at"`
+				Raw       json.RawMessage `json:"raw"`
+				Data      []byte          `json:"data"`
+			}{},
+			expected: &ParameterSpecs{
+				Type: "object",
+				Properties: map[string]*ParameterSpecs{
+					"id":         {Type: "string"},
+					"created_at": {Type: "string", Format: "date-time"},
+					"raw":        {},
+					"data":       {Type: "string"},
+				},
+				Required: []string{"id", "created_at", "raw", "data"},
+			},
+		},
+		{
+			name: "keyword tags",
+			value: struct {
+				Email string  `json:"email" format:"email"`
+				Ratio float64 `json:"ratio" minimum:"0" maximum:"1"`
+			}{},
+			expected: &ParameterSpecs{
+				Type: "object",
+				Properties: map[string]*ParameterSpecs{
+					"email": {Type: "string", Format: "email"},
+					"ratio": {Type: "number", Minimum: floatPointer(0), Maximum: floatPointer(1)},
+				},
+				Required: []string{"email", "ratio"},
+			},
+		},
+		{
+			name:  "recursive type",
+			value: schemaTestTree{},
+			expected: &ParameterSpecs{
+				Type: "object",
+				Properties: map[string]*ParameterSpecs{
+					"value":    {Type: "integer"},
+					"children": {Type: "array", Items: &ParameterSpecs{Type: "object"}},
+				},
+				Required: []string{"value"},
+			},
+		},
+		{
+			name: "unsupported type",
+			value: struct {
+				Callback func() `json:"callback"`
+			}{},
+			expectedErr: "field Callback: unsupported type func()",
+		},
+		{
+			name: "invalid enum",
+			value: struct {
+				Level int `json:"level" enum:"low"`
+			}{},
+			expectedErr: `field Level: invalid enum value "low": strconv.ParseInt: parsing "low": invalid syntax`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := SchemaOf(tc.value)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, schema)
+		})
+	}
+}
+
+func floatPointer(f float64) *float64 {
+	return &f
+}
+
+func TestParseJSONSchema(t *testing.T) {
+	testCases := []struct {
+		name        string
+		schema      string
+		expected    *ParameterSpecs
+		expectedErr string
+	}{
+		{
+			name: "all keywords",
+			schema: `{
+				"type": "object",
+				"description": "a search",
+				"properties": {
+					"query": {"type": "string", "description": "the query", "default": "*"},
+					"limit": {"type": ["integer", "null"], "minimum": 1, "maximum": 100},
+					"since": {"type": "string", "format": "date"},
+					"sort": {"type": "string", "enum": ["asc", "desc"]},
+					"filter": {"anyOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+				},
+				"required": ["query"],
+				"additionalProperties": false
+			}`,
+			expected: &ParameterSpecs{
+				Type:        "object",
+				Description: "a search",
+				Properties: map[string]*ParameterSpecs{
+					"query": {Type: "string", Description: "the query", Default: "*"},
+					"limit": {Type: "integer", Nullable: true, Minimum: floatPointer(1), Maximum: floatPointer(100)},
+					"since": {Type: "string", Format: "date"},
+					"sort":  {Type: "string", Enum: []any{"asc", "desc"}},
+					"filter": {AnyOf: []*ParameterSpecs{
+						{Type: "string"},
+						{Type: "array", Items: &ParameterSpecs{Type: "string"}},
+					}},
+					"labels": {Type: "object", AdditionalProperties: &ParameterSpecs{Type: "string"}},
+				},
+				Required:               []string{"query"},
+				NoAdditionalProperties: true,
+			},
+		},
+		{
+			name:        "unsupported keyword",
+			schema:      `{"type": "object", "properties": {"id": {"type": "string", "pattern": "^[a-z]+$"}}}`,
+			expectedErr: `unsupported JSON schema at "/properties/id/pattern"`,
+		},
+		{
+			name:        "several types",
+			schema:      `{"type": ["string", "integer"]}`,
+			expectedErr: `invalid JSON schema: unsupported type ["string", "integer"]: use anyOf for values of several types`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			specs, err := ParseJSONSchema(json.RawMessage(tc.schema))
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, specs)
+			encoded, err := json.Marshal(specs)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.schema, string(encoded))
+		})
+	}
+}
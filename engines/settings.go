@@ -0,0 +1,27 @@
+package engines
+
+// The settings of an engine that its responses
+// depend on, other than the prompt and functions.
+type ModelSettings struct {
+	Provider    string  `json:"provider,omitempty"`
+	BaseURL     string  `json:"base_url,omitempty"`
+	Model       string  `json:"model,omitempty"`
+	Temperature float64 `json:"temperature"`
+	// Provider specific options, e.g. the tool choice.
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// Implemented by engines that report their settings.
+// Engine wrappers report those of the engine they wrap.
+type SettingsReporter interface {
+	Settings() ModelSettings
+}
+
+// EngineSettings returns the settings of the engine,
+// or zero settings if it does not report them.
+func EngineSettings(engine LLM) ModelSettings {
+	if reporter, ok := engine.(SettingsReporter); ok {
+		return reporter.Settings()
+	}
+	return ModelSettings{}
+}
@@ -0,0 +1,81 @@
+package engines
+
+import (
+	"encoding/json"
+
+	"github.com/natexcvi/go-llm/tokenizer"
+)
+
+// The context windows of known models, in tokens, by
+// model name prefix. The longest matching prefix applies,
+// and prefixes only match whole parts of names, so that
+// e.g. "gpt-4" does not match "gpt-4o".
+var ContextWindows = map[string]int{
+	"gpt-3.5-turbo":      16385,
+	"gpt-3.5-turbo-0301": 4096,
+	"gpt-3.5-turbo-0613": 4096,
+	"gpt-4":              8192,
+	"gpt-4-32k":          32768,
+	"gpt-4-turbo":        128000,
+	"gpt-4-1106":         128000,
+	"gpt-4-0125":         128000,
+	"gpt-4o":             128000,
+	"chatgpt-4o":         128000,
+	"gpt-4.1":            1047576,
+	"gpt-4.5":            128000,
+	"gpt-5":              400000,
+	"o1":                 200000,
+	"o3":                 200000,
+	"o4":                 200000,
+}
+
+// ContextWindow returns the context window of the
+// model, or 0 if it is not known.
+func ContextWindow(model string) int {
+	window, longest := 0, -1
+	for prefix, size := range ContextWindows {
+		if tokenizer.HasModelPrefix(model, prefix) && len(prefix) > longest {
+			window, longest = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// The tokens OpenAI adds around each message, each
+// message name, each function and the reply.
+const (
+	tokensPerMessage  = 3
+	tokensPerName     = 1
+	tokensPerFunction = 7
+	tokensPerReply    = 3
+	tokensForTools    = 12
+)
+
+// CountPromptTokens estimates the number of prompt tokens a
+// request with the messages and functions uses, following
+// the way OpenAI models format requests. Counts for other
+// models are an approximation.
+func CountPromptTokens(model string, messages []*ChatMessage, functions []FunctionSpecs) int {
+	encoding := tokenizer.ForModel(model)
+	count := tokensPerReply
+	for _, msg := range messages {
+		count += tokensPerMessage + encoding.Count(string(msg.Role)) + encoding.Count(msg.Text)
+		if msg.Name != "" {
+			count += tokensPerName + encoding.Count(msg.Name)
+		}
+		for _, call := range msg.Calls() {
+			count += tokensPerName + encoding.Count(call.Function.Name) + encoding.Count(call.Function.Args)
+		}
+	}
+	for _, function := range functions {
+		count += tokensPerFunction + encoding.Count(function.Name) + encoding.Count(function.Description)
+		if function.Parameters != nil {
+			parameters, _ := json.Marshal(function.Parameters)
+			count += encoding.Count(string(parameters))
+		}
+	}
+	if len(functions) > 0 {
+		count += tokensForTools
+	}
+	return count
+}
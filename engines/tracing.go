@@ -0,0 +1,60 @@
+package engines
+
+import (
+	"context"
+	"time"
+
+	"github.com/natexcvi/go-llm/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentChat sends a request of the given provider and
+// model: it refuses requests that the budget of ctx cannot
+// afford, and runs the others in a span recording their
+// token usage and latency. The usage is charged to the
+// budget, and the metadata returned by chat, completed
+// with the latency, is attached to the response.
+func instrumentChat(ctx context.Context, system, model string, prompt *ChatPrompt, functions []FunctionSpecs, chat func(ctx context.Context) (*ChatMessage, ResponseMetadata, error)) (*ChatMessage, error) {
+	budget := BudgetFromContext(ctx)
+	if budget != nil {
+		if err := budget.check(model, prompt, functions); err != nil {
+			return nil, err
+		}
+	}
+	ctx, span := tracing.Start(ctx, "engines", "chat "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", system),
+			attribute.String("gen_ai.request.model", model),
+		),
+	)
+	start := time.Now()
+	message, metadata, err := chat(ctx)
+	metadata.Latency = time.Since(start)
+	if metadata.Model == "" {
+		metadata.Model = model
+	}
+	used := metadata.Usage
+	attributes := []attribute.KeyValue{
+		attribute.Int("gen_ai.usage.input_tokens", used.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", used.CompletionTokens),
+		attribute.String("gen_ai.response.model", metadata.Model),
+		attribute.Int64("llm.latency_ms", metadata.Latency.Milliseconds()),
+	}
+	if metadata.FinishReason != "" {
+		attributes = append(attributes, attribute.StringSlice("gen_ai.response.finish_reasons", []string{metadata.FinishReason}))
+	}
+	if metadata.RequestID != "" {
+		attributes = append(attributes, attribute.String("gen_ai.response.id", metadata.RequestID))
+	}
+	tracing.End(span, err, attributes...)
+	if budget != nil && (err == nil || used != Usage{}) {
+		budget.record(ComponentFromContext(ctx), model, used)
+	}
+	if err != nil {
+		return nil, err
+	}
+	message.Metadata = &metadata
+	return message, nil
+}
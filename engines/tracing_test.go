@@ -0,0 +1,49 @@
+package engines
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestChatTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	server := newMockOpenAIServer(t, "hi", nil)
+	gpt := NewGPTEngine("", "gpt-4o").WithBaseURL(server.URL)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	_, err := gpt.ChatContext(ctx, &ChatPrompt{History: []*ChatMessage{{Role: ConvRoleUser, Text: "hello"}}})
+	require.NoError(t, err)
+	parent.End()
+	_, err = NewClaudeEngine("", "claude").WithBaseURL("http://127.0.0.1:0").Chat(&ChatPrompt{})
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	chat := spans[0]
+	assert.Equal(t, "chat gpt-4o", chat.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), chat.Parent.SpanID())
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range chat.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	assert.Equal(t, "openai", attrs["gen_ai.system"].AsString())
+	assert.Equal(t, "gpt-4o", attrs["gen_ai.request.model"].AsString())
+	assert.Equal(t, int64(3), attrs["gen_ai.usage.input_tokens"].AsInt64())
+	assert.Equal(t, int64(1), attrs["gen_ai.usage.output_tokens"].AsInt64())
+	assert.Contains(t, attrs, attribute.Key("llm.latency_ms"))
+
+	failed := spans[2]
+	assert.Equal(t, "chat claude", failed.Name)
+	assert.Equal(t, codes.Error, failed.Status.Code)
+}
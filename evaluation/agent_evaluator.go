@@ -1,6 +1,8 @@
 package evaluation
 
 import (
+	"context"
+
 	"github.com/natexcvi/go-llm/agents"
 )
 
@@ -18,3 +20,7 @@ func NewAgentRunner[Input, Output any](agent agents.Agent[Input, Output]) Runner
 func (t *agentRunner[Input, Output]) Run(input Input) (Output, error) {
 	return t.agent.Run(input)
 }
+
+func (t *agentRunner[Input, Output]) RunContext(ctx context.Context, input Input) (Output, error) {
+	return agents.RunContext(ctx, t.agent, input)
+}
@@ -1,7 +1,10 @@
 package evaluation
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/natexcvi/go-llm/engines"
 	"github.com/samber/mo"
 )
 
@@ -16,6 +19,9 @@ type Options[Input, Output any] struct {
 	// The number of times the test will be repeated. The goodness level of each output will be
 	// averaged.
 	Repetitions int
+	// Prices by model name prefix, used to price the spend of test cases.
+	// They take precedence over engines.DefaultPrices.
+	Prices map[string]engines.Price
 }
 
 // Runner is an interface that represents a test runner that will be used to evaluate the output.
@@ -24,6 +30,13 @@ type Runner[Input, Output any] interface {
 	Run(input Input) (Output, error)
 }
 
+// RunnerWithContext is a Runner that passes a context along to the engine requests it makes,
+// which lets the evaluator attribute their spend to test cases.
+type RunnerWithContext[Input, Output any] interface {
+	Runner[Input, Output]
+	RunContext(ctx context.Context, input Input) (Output, error)
+}
+
 // Evaluator is a struct that runs the tests and evaluates the outputs.
 type Evaluator[Input, Output any] struct {
 	options *Options[Input, Output]
@@ -42,10 +55,19 @@ func NewEvaluator[Input, Output any](runner Runner[Input, Output], options *Opti
 // which is a slice of inputs and returns a slice of float64 which represents the goodness level
 // of each respective output.
 func (e *Evaluator[Input, Output]) Evaluate(testPack []Input) []float64 {
-	repetitionChannels := make([]chan []float64, e.options.Repetitions)
+	report, _ := e.EvaluateWithSpend(testPack)
+	return report
+}
+
+// Runs the tests like Evaluate, and also returns the tokens and money spent by each test case,
+// summed over all repetitions. Spend is attributed only when the runner implements RunnerWithContext,
+// as those returned by NewLLMRunner and NewAgentRunner do. Agents with a budget of their own
+// are charged to it instead.
+func (e *Evaluator[Input, Output]) EvaluateWithSpend(testPack []Input) ([]float64, []engines.Spend) {
+	repetitionChannels := make([]chan *repetitionReport, e.options.Repetitions)
 
 	for i := 0; i < e.options.Repetitions; i++ {
-		repetitionChannels[i] = make(chan []float64)
+		repetitionChannels[i] = make(chan *repetitionReport)
 		go func(i int) {
 			report, err := e.evaluate(testPack)
 			if err != nil {
@@ -56,49 +78,78 @@ func (e *Evaluator[Input, Output]) Evaluate(testPack []Input) []float64 {
 		}(i)
 	}
 
-	responses := make([][]float64, e.options.Repetitions)
+	responses := make([]*repetitionReport, e.options.Repetitions)
 	for i := 0; i < e.options.Repetitions; i++ {
 		responses[i] = <-repetitionChannels[i]
 	}
 
 	report := make([]float64, len(testPack))
+	spend := make([]engines.Spend, len(testPack))
 	for i := 0; i < len(testPack); i++ {
 		sum := 0.0
 		for j := 0; j < e.options.Repetitions; j++ {
-			sum += responses[j][i]
+			sum += responses[j].goodness[i]
+			spend[i].Requests += responses[j].spend[i].Requests
+			spend[i].Usage.PromptTokens += responses[j].spend[i].Usage.PromptTokens
+			spend[i].Usage.CompletionTokens += responses[j].spend[i].Usage.CompletionTokens
+			spend[i].Cost += responses[j].spend[i].Cost
 		}
 		report[i] = sum / float64(e.options.Repetitions)
 	}
 
-	return report
+	return report, spend
 }
 
-func (e *Evaluator[Input, Output]) evaluate(testPack []Input) ([]float64, error) {
-	responses, err := e.test(testPack)
+// The goodness level and spend of each
+// test case in a single repetition.
+type repetitionReport struct {
+	goodness []float64
+	spend    []engines.Spend
+}
+
+func (e *Evaluator[Input, Output]) evaluate(testPack []Input) (*repetitionReport, error) {
+	responses, spend, err := e.test(testPack)
 	if err != nil {
 		return nil, fmt.Errorf("failed to test: %w", err)
 	}
 
-	report := make([]float64, len(testPack))
+	report := &repetitionReport{
+		goodness: make([]float64, len(testPack)),
+		spend:    spend,
+	}
 	for i, response := range responses {
 		res, resErr := response.Get()
-		report[i] = e.options.GoodnessFunction(testPack[i], res, resErr)
+		report.goodness[i] = e.options.GoodnessFunction(testPack[i], res, resErr)
 	}
 
 	return report, nil
 }
 
-func (e *Evaluator[Input, Output]) test(testPack []Input) ([]mo.Result[Output], error) {
+func (e *Evaluator[Input, Output]) test(testPack []Input) ([]mo.Result[Output], []engines.Spend, error) {
 	responses := make([]mo.Result[Output], len(testPack))
+	spend := make([]engines.Spend, len(testPack))
 
 	for i, test := range testPack {
-		response, err := e.runner.Run(test)
+		// each test case is charged to a budget of its own
+		budget := engines.NewBudget()
+		for prefix, price := range e.options.Prices {
+			budget.WithPrice(prefix, price)
+		}
+		response, err := e.run(engines.ContextWithBudget(context.Background(), budget), test)
 		if err != nil {
 			responses[i] = mo.Err[Output](err)
 		} else {
 			responses[i] = mo.Ok(response)
 		}
+		spend[i] = budget.Spent()
 	}
 
-	return responses, nil
+	return responses, spend, nil
+}
+
+func (e *Evaluator[Input, Output]) run(ctx context.Context, input Input) (Output, error) {
+	if runner, ok := e.runner.(RunnerWithContext[Input, Output]); ok {
+		return runner.RunContext(ctx, input)
+	}
+	return e.runner.Run(input)
 }
@@ -1,6 +1,7 @@
 package evaluation
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/natexcvi/go-llm/engines"
@@ -8,7 +9,10 @@ import (
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -28,8 +32,11 @@ func createMockIncrementalLLM(t *testing.T) engines.LLM {
 	t.Helper()
 	ctrl := gomock.NewController(t)
 	mock := mocks.NewMockLLM(ctrl)
+	var mu sync.Mutex
 	counters := make(map[string]int)
 	mock.EXPECT().Chat(gomock.Any()).DoAndReturn(func(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
 		counters[prompt.History[0].Text]++
 		return &engines.ChatMessage{
 			Text: strings.Repeat(prompt.History[0].Text, counters[prompt.History[0].Text]),
@@ -42,8 +49,11 @@ func createMockExponentialLLM(t *testing.T) engines.LLM {
 	t.Helper()
 	ctrl := gomock.NewController(t)
 	mock := mocks.NewMockLLM(ctrl)
+	var mu sync.Mutex
 	counters := make(map[string]int)
 	mock.EXPECT().Chat(gomock.Any()).DoAndReturn(func(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
 		counters[prompt.History[0].Text]++
 		return &engines.ChatMessage{
 			Text: strings.Repeat(prompt.History[0].Text, int(math.Pow(float64(len(prompt.History[0].Text)), float64(counters[prompt.History[0].Text]+1)))),
@@ -56,8 +66,11 @@ func createMockOddErrorLLM(t *testing.T) engines.LLM {
 	t.Helper()
 	ctrl := gomock.NewController(t)
 	mock := mocks.NewMockLLM(ctrl)
+	var mu sync.Mutex
 	counters := make(map[string]int)
 	mock.EXPECT().Chat(gomock.Any()).DoAndReturn(func(prompt *engines.ChatPrompt) (*engines.ChatMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
 		counters[prompt.History[0].Text]++
 		if counters[prompt.History[0].Text]%2 == 1 {
 			return nil, errors.New("error")
@@ -281,3 +294,43 @@ func TestLLMEvaluator(t *testing.T) {
 		})
 	}
 }
+
+func TestLLMEvaluatorWithSharedGPT(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body engines.ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{
+				{"message": map[string]any{"role": "assistant", "content": body.Messages[0].Text}},
+			},
+			"usage": map[string]any{"prompt_tokens": 2, "completion_tokens": 1},
+		}))
+	}))
+	defer server.Close()
+	gpt := engines.NewGPTEngine("token", "local-model").
+		WithBaseURL(server.URL).
+		WithHTTPClient(server.Client())
+	evaluator := NewEvaluator(NewLLMRunner(gpt), &Options[*engines.ChatPrompt, *engines.ChatMessage]{
+		GoodnessFunction: func(_ *engines.ChatPrompt, response *engines.ChatMessage, err error) float64 {
+			if err != nil {
+				return 0
+			}
+			return float64(len(response.Text))
+		},
+		Repetitions: 8,
+		Prices:      map[string]engines.Price{"local-model": {Prompt: 1e6, Completion: 2e6}},
+	})
+
+	got, spend := evaluator.EvaluateWithSpend([]*engines.ChatPrompt{
+		{History: []*engines.ChatMessage{{Role: engines.ConvRoleUser, Text: "a"}}},
+		{History: []*engines.ChatMessage{{Role: engines.ConvRoleUser, Text: "aa"}}},
+	})
+
+	assert.Equal(t, []float64{1, 2}, got)
+	// each test case is charged for its 8 repetitions
+	testCaseSpend := engines.Spend{Requests: 8, Usage: engines.Usage{PromptTokens: 16, CompletionTokens: 8}, Cost: 32}
+	assert.Equal(t, []engines.Spend{testCaseSpend, testCaseSpend}, spend)
+	assert.EqualValues(t, 2*8*2, gpt.PromptTokensUsed.Load())
+	assert.EqualValues(t, 2*8, gpt.CompletionTokensUsed.Load())
+}
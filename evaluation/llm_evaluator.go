@@ -1,6 +1,10 @@
 package evaluation
 
-import "github.com/natexcvi/go-llm/engines"
+import (
+	"context"
+
+	"github.com/natexcvi/go-llm/engines"
+)
 
 type llmRunner struct {
 	llm engines.LLM
@@ -16,3 +20,7 @@ func NewLLMRunner(llm engines.LLM) Runner[*engines.ChatPrompt, *engines.ChatMess
 func (t *llmRunner) Run(input *engines.ChatPrompt) (*engines.ChatMessage, error) {
 	return t.llm.Chat(input)
 }
+
+func (t *llmRunner) RunContext(ctx context.Context, input *engines.ChatPrompt) (*engines.ChatMessage, error) {
+	return engines.ChatContext(ctx, t.llm, input)
+}
@@ -21,11 +21,29 @@ import (
 var (
 	tokenLimit int
 	gptModel   string
+	budget     = engines.NewBudget()
 )
 
+// budgeted charges the requests of the engine to
+// the budget, which --token-limit caps.
+func budgeted(engine engines.LLM) engines.LLM {
+	return engines.NewBudgetedEngine(engine, budget)
+}
+
+func reportSpend() {
+	if budget.Spent().Requests == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr)
+	budget.WriteReport(os.Stderr)
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "go-llm",
 	Short: "A CLI for using the prebuilt agents.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		budget.WithMaxTokens(tokenLimit)
+	},
 }
 
 var codeRefactorAgent = &cobra.Command{
@@ -43,7 +61,7 @@ var codeRefactorAgent = &cobra.Command{
 			log.Errorf("OPENAI_API_KEY environment variable not set")
 			return
 		}
-		engine := engines.NewGPTEngine(apiKey, gptModel)
+		engine := budgeted(engines.NewGPTEngine(apiKey, gptModel))
 		agent := prebuilt.NewCodeRefactorAgent(engine)
 		res, err := agent.Run(prebuilt.CodeBaseRefactorRequest{
 			Dir:  codeBaseDir,
@@ -73,7 +91,7 @@ var tradeAssistantAgent = &cobra.Command{
 			log.Errorf("WOLFRAM_APP_ID environment variable not set")
 			return
 		}
-		engine := engines.NewGPTEngine(apiKey, gptModel)
+		engine := budgeted(engines.NewGPTEngine(apiKey, gptModel))
 		agent := prebuilt.NewTradeAssistantAgent(engine, wolframAppID)
 		res, err := agent.Run(prebuilt.TradeAssistantRequest{
 			Stocks: args,
@@ -113,7 +131,7 @@ is an example unit test file.
 		}
 		sourceFilePath := args[0]
 		exampleFilePath := args[1]
-		engine := engines.NewGPTEngine(apiKey, gptModel)
+		engine := budgeted(engines.NewGPTEngine(apiKey, gptModel))
 		agent, err := prebuilt.NewUnitTestWriter(engine, func(code string) error {
 			return nil
 		})
@@ -156,7 +174,7 @@ var gitAssistantCmd = &cobra.Command{
 			log.Errorf("OPENAI_API_KEY environment variable not set")
 			return
 		}
-		engine := engines.NewGPTEngine(apiKey, gptModel).WithTemperature(0)
+		engine := budgeted(engines.NewGPTEngine(apiKey, gptModel).WithTemperature(0))
 		agent := prebuilt.NewGitAssistantAgent(engine, func(action *agents.ChainAgentAction) bool {
 			isGitCommand := action.Tool.Name() == "git"
 			if !isGitCommand {
@@ -234,7 +252,9 @@ func main() {
 	rootCmd.AddCommand(unitTestWriter)
 	rootCmd.AddCommand(gitAssistantCmd)
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	reportSpend()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,31 @@
+// Package tracing holds the OpenTelemetry helpers shared
+// by the instrumented packages of go-llm. Spans are created
+// with the global tracer provider.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationPrefix = "github.com/natexcvi/go-llm/"
+
+// Start starts a span on the tracer of the given go-llm
+// package, e.g. "engines".
+func Start(ctx context.Context, pkg, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationPrefix+pkg).Start(ctx, name, opts...)
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startSpan(ctx context.Context, name string, memory Memory) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "memory", name,
+		trace.WithAttributes(attribute.String("memory.type", fmt.Sprintf("%T", memory))),
+	)
+}
+
+// AddContext adds the message to the memory, passing ctx
+// along if the memory supports it. Memories that are not
+// context aware are only checked for cancellation.
+func AddContext(ctx context.Context, memory Memory, msg *engines.ChatMessage) (err error) {
+	ctx, span := startSpan(ctx, "Memory.Add", memory)
+	defer func() { tracing.End(span, err) }()
+	if memory, ok := memory.(MemoryWithContext); ok {
+		return memory.AddContext(ctx, msg)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return memory.Add(msg)
+}
+
+// AddPromptContext is the AddPrompt counterpart
+// of AddContext.
+func AddPromptContext(ctx context.Context, memory Memory, prompt *engines.ChatPrompt) (err error) {
+	ctx, span := startSpan(ctx, "Memory.AddPrompt", memory)
+	defer func() { tracing.End(span, err) }()
+	if memory, ok := memory.(MemoryWithContext); ok {
+		return memory.AddPromptContext(ctx, prompt)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return memory.AddPrompt(prompt)
+}
+
+// PromptContext is the PromptWithContext counterpart
+// of AddContext.
+func PromptContext(ctx context.Context, memory Memory, nextMessages ...*engines.ChatMessage) (prompt *engines.ChatPrompt, err error) {
+	ctx, span := startSpan(ctx, "Memory.Prompt", memory)
+	defer func() { tracing.End(span, err) }()
+	if memory, ok := memory.(MemoryWithContext); ok {
+		return memory.PromptContext(ctx, nextMessages...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return memory.PromptWithContext(nextMessages...)
+}
@@ -1,6 +1,10 @@
 package memory
 
-import "github.com/natexcvi/go-llm/engines"
+import (
+	"context"
+
+	"github.com/natexcvi/go-llm/engines"
+)
 
 //go:generate mockgen -source=memory.go -destination=mocks/memory.go -package=mocks
 type Memory interface {
@@ -8,3 +12,13 @@ type Memory interface {
 	AddPrompt(prompt *engines.ChatPrompt) error
 	PromptWithContext(nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error)
 }
+
+// A Memory whose operations can be cancelled
+// through a context, e.g. because they involve
+// calls to an LLM.
+type MemoryWithContext interface {
+	Memory
+	AddContext(ctx context.Context, msg *engines.ChatMessage) error
+	AddPromptContext(ctx context.Context, prompt *engines.ChatPrompt) error
+	PromptContext(ctx context.Context, nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error)
+}
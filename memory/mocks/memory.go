@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -80,3 +81,121 @@ func (mr *MockMemoryMockRecorder) PromptWithContext(nextMessages ...interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PromptWithContext", reflect.TypeOf((*MockMemory)(nil).PromptWithContext), nextMessages...)
 }
+
+// MockMemoryWithContext is a mock of MemoryWithContext interface.
+type MockMemoryWithContext struct {
+	ctrl     *gomock.Controller
+	recorder *MockMemoryWithContextMockRecorder
+}
+
+// MockMemoryWithContextMockRecorder is the mock recorder for MockMemoryWithContext.
+type MockMemoryWithContextMockRecorder struct {
+	mock *MockMemoryWithContext
+}
+
+// NewMockMemoryWithContext creates a new mock instance.
+func NewMockMemoryWithContext(ctrl *gomock.Controller) *MockMemoryWithContext {
+	mock := &MockMemoryWithContext{ctrl: ctrl}
+	mock.recorder = &MockMemoryWithContextMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMemoryWithContext) EXPECT() *MockMemoryWithContextMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockMemoryWithContext) Add(msg *engines.ChatMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockMemoryWithContextMockRecorder) Add(msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockMemoryWithContext)(nil).Add), msg)
+}
+
+// AddContext mocks base method.
+func (m *MockMemoryWithContext) AddContext(ctx context.Context, msg *engines.ChatMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddContext", ctx, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddContext indicates an expected call of AddContext.
+func (mr *MockMemoryWithContextMockRecorder) AddContext(ctx, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddContext", reflect.TypeOf((*MockMemoryWithContext)(nil).AddContext), ctx, msg)
+}
+
+// AddPrompt mocks base method.
+func (m *MockMemoryWithContext) AddPrompt(prompt *engines.ChatPrompt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPrompt", prompt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddPrompt indicates an expected call of AddPrompt.
+func (mr *MockMemoryWithContextMockRecorder) AddPrompt(prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPrompt", reflect.TypeOf((*MockMemoryWithContext)(nil).AddPrompt), prompt)
+}
+
+// AddPromptContext mocks base method.
+func (m *MockMemoryWithContext) AddPromptContext(ctx context.Context, prompt *engines.ChatPrompt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPromptContext", ctx, prompt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddPromptContext indicates an expected call of AddPromptContext.
+func (mr *MockMemoryWithContextMockRecorder) AddPromptContext(ctx, prompt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPromptContext", reflect.TypeOf((*MockMemoryWithContext)(nil).AddPromptContext), ctx, prompt)
+}
+
+// PromptContext mocks base method.
+func (m *MockMemoryWithContext) PromptContext(ctx context.Context, nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range nextMessages {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PromptContext", varargs...)
+	ret0, _ := ret[0].(*engines.ChatPrompt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PromptContext indicates an expected call of PromptContext.
+func (mr *MockMemoryWithContextMockRecorder) PromptContext(ctx interface{}, nextMessages ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, nextMessages...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PromptContext", reflect.TypeOf((*MockMemoryWithContext)(nil).PromptContext), varargs...)
+}
+
+// PromptWithContext mocks base method.
+func (m *MockMemoryWithContext) PromptWithContext(nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range nextMessages {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PromptWithContext", varargs...)
+	ret0, _ := ret[0].(*engines.ChatPrompt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PromptWithContext indicates an expected call of PromptWithContext.
+func (mr *MockMemoryWithContextMockRecorder) PromptWithContext(nextMessages ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PromptWithContext", reflect.TypeOf((*MockMemoryWithContext)(nil).PromptWithContext), nextMessages...)
+}
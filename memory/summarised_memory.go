@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/natexcvi/go-llm/engines"
@@ -21,7 +22,7 @@ func (memory *SummarisedMemory) reduceBuffer() {
 	}
 }
 
-func (memory *SummarisedMemory) updateMemoryState(msg ...*engines.ChatMessage) error {
+func (memory *SummarisedMemory) updateMemoryState(ctx context.Context, msg ...*engines.ChatMessage) error {
 	if memory.memoryState == "" {
 		memory.memoryState = "<memory state is empty>"
 	}
@@ -60,7 +61,7 @@ func (memory *SummarisedMemory) updateMemoryState(msg ...*engines.ChatMessage) e
 		Text: "Please update the memory state to reflect the new messages. " +
 			"Do not forget to give proper weight to the current memory state.",
 	})
-	updatedMemState, err := memory.model.Chat(&prompt)
+	updatedMemState, err := engines.ChatContext(engines.ContextWithComponent(ctx, engines.ComponentSummarisedMemory), memory.model, &prompt)
 	if err != nil {
 		return fmt.Errorf("failed to update memory state: %w", err)
 	}
@@ -70,9 +71,13 @@ func (memory *SummarisedMemory) updateMemoryState(msg ...*engines.ChatMessage) e
 }
 
 func (memory *SummarisedMemory) Add(msg *engines.ChatMessage) error {
+	return memory.AddContext(context.Background(), msg)
+}
+
+func (memory *SummarisedMemory) AddContext(ctx context.Context, msg *engines.ChatMessage) error {
 	memory.recentMessages = append(memory.recentMessages, msg)
 	memory.reduceBuffer()
-	if err := memory.updateMemoryState(msg); err != nil {
+	if err := memory.updateMemoryState(ctx, msg); err != nil {
 		return fmt.Errorf("failed to update memory state: %w", err)
 	}
 	return nil
@@ -83,7 +88,15 @@ func (memory *SummarisedMemory) AddPrompt(prompt *engines.ChatPrompt) error {
 	return nil
 }
 
+func (memory *SummarisedMemory) AddPromptContext(_ context.Context, prompt *engines.ChatPrompt) error {
+	return memory.AddPrompt(prompt)
+}
+
 func (memory *SummarisedMemory) PromptWithContext(nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error) {
+	return memory.PromptContext(context.Background(), nextMessages...)
+}
+
+func (memory *SummarisedMemory) PromptContext(_ context.Context, nextMessages ...*engines.ChatMessage) (*engines.ChatPrompt, error) {
 	promptMessages := make([]*engines.ChatMessage, 0, len(memory.recentMessages)+len(nextMessages))
 	if memory.originalPrompt != nil {
 		promptMessages = append(promptMessages, memory.originalPrompt.History...)
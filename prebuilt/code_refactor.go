@@ -11,32 +11,28 @@ import (
 )
 
 type CodeBaseRefactorRequest struct {
-	Dir  string
-	Goal string
+	Dir  string `json:"dir" description:"path to code base"`
+	Goal string `json:"goal" description:"refactoring goal"`
 }
 
 func (req CodeBaseRefactorRequest) Encode() string {
-	return fmt.Sprintf(`{"dir": "%s", "goal": "%s"}`, req.Dir, req.Goal)
+	return agents.EncodeJSON(req)
 }
 
 func (req CodeBaseRefactorRequest) Schema() string {
-	return `{"dir": "path to code base", "goal": "refactoring goal"}`
+	return agents.PromptSchemaOf(req)
 }
 
 type CodeBaseRefactorResponse struct {
-	RefactoredFiles map[string]string `json:"refactored_files"`
+	RefactoredFiles map[string]string `json:"refactored_files" description:"description of changes, by path"`
 }
 
 func (resp CodeBaseRefactorResponse) Encode() string {
-	marshalled, err := json.Marshal(resp.RefactoredFiles)
-	if err != nil {
-		panic(err)
-	}
-	return string(marshalled)
+	return agents.EncodeJSON(resp)
 }
 
 func (resp CodeBaseRefactorResponse) Schema() string {
-	return `{"refactored_files": {"path": "description of changes"}}`
+	return agents.PromptSchemaOf(resp)
 }
 
 func NewCodeRefactorAgent(engine engines.LLM) agents.Agent[CodeBaseRefactorRequest, CodeBaseRefactorResponse] {
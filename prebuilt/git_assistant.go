@@ -38,37 +38,29 @@ var (
 )
 
 type GitAssistantRequest struct {
-	Instruction string
-	GitStatus   string
-	CurrentDate string
+	Instruction string `json:"instruction" description:"a description of what the user wants to do"`
+	GitStatus   string `json:"git_status,omitempty" description:"output of git status"`
+	CurrentDate string `json:"current_date,omitempty" description:"the current date"`
 }
 
 func (req GitAssistantRequest) Encode() string {
-	marshaled, err := json.Marshal(req)
-	if err != nil {
-		panic(err)
-	}
-	return string(marshaled)
+	return agents.EncodeJSON(req)
 }
 
 func (req GitAssistantRequest) Schema() string {
-	return `{"instruction": "a description of what the user wants to do", "git_status": "output of git status"}`
+	return agents.PromptSchemaOf(req)
 }
 
 type GitAssistantResponse struct {
-	Summary string `json:"summary"`
+	Summary string `json:"summary" description:"a summary of the git operations performed"`
 }
 
 func (resp GitAssistantResponse) Encode() string {
-	marshaled, err := json.Marshal(resp)
-	if err != nil {
-		panic(err)
-	}
-	return string(marshaled)
+	return agents.EncodeJSON(resp)
 }
 
 func (resp GitAssistantResponse) Schema() string {
-	return `{"summary": "a summary of the git operations performed"}`
+	return agents.PromptSchemaOf(resp)
 }
 
 func NewGitAssistantAgent(engine engines.LLM, actionConfirmationHook func(action *agents.ChainAgentAction) bool, additionalTools ...tools.Tool) agents.Agent[GitAssistantRequest, GitAssistantResponse] {
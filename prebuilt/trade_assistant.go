@@ -2,7 +2,6 @@ package prebuilt
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/natexcvi/go-llm/agents"
 	"github.com/natexcvi/go-llm/engines"
@@ -11,15 +10,15 @@ import (
 )
 
 type TradeAssistantRequest struct {
-	Stocks []string `json:"stocks"`
+	Stocks []string `json:"stocks" description:"stock tickers"`
 }
 
 func (r TradeAssistantRequest) Encode() string {
-	return fmt.Sprintf(`{"stocks": %s}`, r.Stocks)
+	return agents.EncodeJSON(r)
 }
 
 func (r TradeAssistantRequest) Schema() string {
-	return `{"stocks": "list of stock tickers"}`
+	return agents.PromptSchemaOf(r)
 }
 
 type Recommendation string
@@ -31,19 +30,15 @@ const (
 )
 
 type TradeAssistantResponse struct {
-	Recommendations map[string]Recommendation
+	Recommendations map[string]Recommendation `json:"recommendations" description:"recommendation, by ticker" enum:"buy,sell,hold"`
 }
 
 func (r TradeAssistantResponse) Encode() string {
-	marshalled, err := json.Marshal(r.Recommendations)
-	if err != nil {
-		panic(err)
-	}
-	return string(marshalled)
+	return agents.EncodeJSON(r)
 }
 
 func (r TradeAssistantResponse) Schema() string {
-	return `{"recommendations": {"ticker": "buy/sell/hold"}}`
+	return agents.PromptSchemaOf(r)
 }
 
 func NewTradeAssistantAgent(engine engines.LLM, wolframAlphaAppID string) agents.Agent[TradeAssistantRequest, TradeAssistantResponse] {
@@ -78,6 +73,9 @@ func NewTradeAssistantAgent(engine engines.LLM, wolframAlphaAppID string) agents
 			},
 		},
 		AnswerParser: func(text string) (TradeAssistantResponse, error) {
+			if res, err := agents.ParseJSON[TradeAssistantResponse](text); err == nil && res.Recommendations != nil {
+				return res, nil
+			}
 			var recommendations map[string]Recommendation
 			if err := json.Unmarshal([]byte(text), &recommendations); err != nil {
 				return TradeAssistantResponse{}, err
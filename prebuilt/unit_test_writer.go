@@ -10,8 +10,8 @@ import (
 )
 
 type UnitTestWriterRequest struct {
-	SourceFile  string `json:"source_file"`
-	ExampleFile string `json:"example_file"`
+	SourceFile  string `json:"source_file" description:"source code file"`
+	ExampleFile string `json:"example_file" description:"example unit test file"`
 }
 
 func (r UnitTestWriterRequest) Encode() string {
@@ -19,23 +19,19 @@ func (r UnitTestWriterRequest) Encode() string {
 }
 
 func (r UnitTestWriterRequest) Schema() string {
-	return `{"source_file": "source code file", "example_file": "example unit test file"}`
+	return agents.PromptSchemaOf(r)
 }
 
 type UnitTestWriterResponse struct {
-	UnitTestFile string `json:"unit_test_file"`
+	UnitTestFile string `json:"unit_test_file" description:"unit test file"`
 }
 
 func (r UnitTestWriterResponse) Encode() string {
-	marshalled, err := json.Marshal(r.UnitTestFile)
-	if err != nil {
-		panic(err)
-	}
-	return string(marshalled)
+	return agents.EncodeJSON(r)
 }
 
 func (r UnitTestWriterResponse) Schema() string {
-	return `{"unit_test_file": "unit test file"}`
+	return agents.PromptSchemaOf(r)
 }
 
 func NewUnitTestWriter(engine engines.LLM, codeValidator func(code string) error) (agents.Agent[UnitTestWriterRequest, UnitTestWriterResponse], error) {
@@ -0,0 +1,267 @@
+// Package tokenizer counts tokens locally with the byte pair
+// encodings used by OpenAI models, so that the size of a
+// request can be known before it is sent. The vocabularies,
+// published by OpenAI with tiktoken (MIT licensed), are
+// embedded in the package.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed *.tiktoken.gz
+var vocabularies embed.FS
+
+// Unicode white space, which \s matches
+// in the patterns of the encodings.
+const space = `\t\n\v\f\r\x{85}\p{Z}`
+
+// The patterns that split text into pieces before it is
+// encoded. The original patterns end with the alternatives
+// \s+(?!\S)|\s+, which Go does not support, so they end with
+// a captured \s+ here that Encoding.split shortens instead.
+var (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)` +
+		`|[^\r\n\p{L}\p{N}]?\p{L}+` +
+		`|\p{N}{1,3}` +
+		`| ?[^` + space + `\p{L}\p{N}]+[\r\n]*` +
+		`|[` + space + `]*[\r\n]+` +
+		`|([` + space + `]+)`
+	o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}` +
+		`| ?[^` + space + `\p{L}\p{N}]+[\r\n/]*` +
+		`|[` + space + `]*[\r\n]+` +
+		`|([` + space + `]+)`
+)
+
+// A byte pair encoding.
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	tokens  []string
+	pattern *regexp.Regexp
+}
+
+var (
+	cl100kBase, o200kBase         *Encoding
+	cl100kBaseOnce, o200kBaseOnce sync.Once
+)
+
+// Cl100kBase returns the encoding of GPT-4
+// and GPT-3.5 models.
+func Cl100kBase() *Encoding {
+	cl100kBaseOnce.Do(func() {
+		cl100kBase = mustLoad("cl100k_base", cl100kPattern)
+	})
+	return cl100kBase
+}
+
+// O200kBase returns the encoding of GPT-4o,
+// GPT-4.1 and o-series models.
+func O200kBase() *Encoding {
+	o200kBaseOnce.Do(func() {
+		o200kBase = mustLoad("o200k_base", o200kPattern)
+	})
+	return o200kBase
+}
+
+// ForModel returns the encoding used by the model. Models
+// that are not known to use o200k_base, including those
+// of other providers, get cl100k_base, whose counts are
+// a reasonable estimate for most modern tokenizers.
+func ForModel(model string) *Encoding {
+	for _, prefix := range []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"} {
+		if HasModelPrefix(model, prefix) {
+			return O200kBase()
+		}
+	}
+	return Cl100kBase()
+}
+
+// HasModelPrefix reports whether the model name starts
+// with the prefix, followed by its end or a dash, so that
+// e.g. gpt-4o-mini is a gpt-4o model, but not a gpt-4 one.
+func HasModelPrefix(model, prefix string) bool {
+	return strings.HasPrefix(model, prefix) &&
+		(len(model) == len(prefix) || model[len(prefix)] == '-')
+}
+
+func mustLoad(name, pattern string) *Encoding {
+	encoding, err := load(name, pattern)
+	if err != nil {
+		panic(fmt.Sprintf("tokenizer: invalid embedded vocabulary %s: %v", name, err))
+	}
+	return encoding
+}
+
+// load reads a vocabulary in the tiktoken format: one
+// base64 encoded token and its rank per line.
+func load(name, pattern string) (*Encoding, error) {
+	data, err := vocabularies.ReadFile(name + ".tiktoken.gz")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	encoding := &Encoding{
+		name:    name,
+		ranks:   make(map[string]int),
+		pattern: regexp.MustCompile(pattern),
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %q", scanner.Text())
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		encoding.ranks[string(token)] = rank
+		for len(encoding.tokens) <= rank {
+			encoding.tokens = append(encoding.tokens, "")
+		}
+		encoding.tokens[rank] = string(token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return encoding, nil
+}
+
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the tokens of the text. Special
+// tokens are encoded as ordinary text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairEncode(piece)...)
+	}
+	return tokens
+}
+
+// Count returns the number of tokens in the text.
+func (e *Encoding) Count(text string) int {
+	count := 0
+	for _, piece := range e.split(text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(e.bytePairEncode(piece))
+	}
+	return count
+}
+
+// Decode returns the text of the tokens.
+func (e *Encoding) Decode(tokens []int) (string, error) {
+	var text strings.Builder
+	for _, token := range tokens {
+		if token < 0 || token >= len(e.tokens) {
+			return "", fmt.Errorf("invalid token %d", token)
+		}
+		text.WriteString(e.tokens[token])
+	}
+	return text.String(), nil
+}
+
+// split splits the text into the pieces that are
+// encoded separately.
+func (e *Encoding) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		match := e.pattern.FindStringSubmatchIndex(text)
+		if match == nil || match[1] == 0 {
+			// unreachable, since every character
+			// is matched by some alternative
+			pieces = append(pieces, text)
+			break
+		}
+		end := match[1]
+		// emulates \s+(?!\S): a run of white space that
+		// is followed by other text leaves its last
+		// character to the next piece
+		if match[2] >= 0 && end < len(text) {
+			if last := strings.LastIndexFunc(text[:end], func(rune) bool { return true }); last > 0 {
+				end = last
+			}
+		}
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+// bytePairEncode repeatedly merges the adjacent parts
+// of the piece whose merge has the lowest rank.
+func (e *Encoding) bytePairEncode(piece string) []int {
+	// the offsets at which the parts
+	// start, and the rank of merging
+	// each part with the next one
+	type part struct {
+		offset int
+		rank   int
+	}
+	parts := make([]part, len(piece)+1)
+	for i := range parts {
+		parts[i] = part{offset: i, rank: math.MaxInt}
+	}
+	rank := func(i int) int {
+		if i+2 >= len(parts) {
+			return math.MaxInt
+		}
+		if rank, ok := e.ranks[piece[parts[i].offset:parts[i+2].offset]]; ok {
+			return rank
+		}
+		return math.MaxInt
+	}
+	for i := 0; i < len(parts)-2; i++ {
+		parts[i].rank = rank(i)
+	}
+	for len(parts) > 1 {
+		minRank, minIndex := math.MaxInt, -1
+		for i, p := range parts[:len(parts)-1] {
+			if p.rank < minRank {
+				minRank, minIndex = p.rank, i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+		parts = append(parts[:minIndex+1], parts[minIndex+2:]...)
+		parts[minIndex].rank = rank(minIndex)
+		if minIndex > 0 {
+			parts[minIndex-1].rank = rank(minIndex - 1)
+		}
+	}
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		tokens = append(tokens, e.ranks[piece[parts[i].offset:parts[i+1].offset]])
+	}
+	return tokens
+}
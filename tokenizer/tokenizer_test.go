@@ -0,0 +1,101 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		encoding *Encoding
+		text     string
+		expected []int
+	}{
+		{
+			name:     "cl100k words",
+			encoding: Cl100kBase(),
+			text:     "hello world",
+			expected: []int{15339, 1917},
+		},
+		{
+			name:     "cl100k merges",
+			encoding: Cl100kBase(),
+			text:     "tiktoken is great!",
+			expected: []int{83, 1609, 5963, 374, 2294, 0},
+		},
+		{
+			name:     "cl100k white space",
+			encoding: Cl100kBase(),
+			text:     "Hello,   world!\n\n  Bye",
+			expected: []int{9906, 11, 256, 1917, 2268, 220, 90425},
+		},
+		{
+			name:     "cl100k unicode",
+			encoding: Cl100kBase(),
+			text:     "日本語 😀",
+			expected: []int{9080, 22656, 45918, 252, 91416},
+		},
+		{
+			name:     "cl100k contractions",
+			encoding: Cl100kBase(),
+			text:     "I'M here",
+			expected: []int{40, 28703, 1618},
+		},
+		{
+			name:     "o200k words",
+			encoding: O200kBase(),
+			text:     "hello world",
+			expected: []int{24912, 2375},
+		},
+		{
+			name:     "o200k white space",
+			encoding: O200kBase(),
+			text:     "Hello,   world!\n\n  Bye",
+			expected: []int{13225, 11, 256, 2375, 1703, 220, 150203},
+		},
+		{
+			name:     "o200k unicode",
+			encoding: O200kBase(),
+			text:     "日本語 😀",
+			expected: []int{9048, 40909, 88038},
+		},
+		{
+			name:     "empty",
+			encoding: Cl100kBase(),
+			text:     "",
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens := tc.encoding.Encode(tc.text)
+			assert.Equal(t, tc.expected, tokens)
+			assert.Equal(t, len(tc.expected), tc.encoding.Count(tc.text))
+			decoded, err := tc.encoding.Decode(tokens)
+			require.NoError(t, err)
+			assert.Equal(t, tc.text, decoded)
+		})
+	}
+}
+
+func TestForModel(t *testing.T) {
+	assert.Equal(t, "o200k_base", ForModel("gpt-4o-mini").Name())
+	assert.Equal(t, "o200k_base", ForModel("o1-preview").Name())
+	assert.Equal(t, "cl100k_base", ForModel("gpt-4-0613").Name())
+	assert.Equal(t, "cl100k_base", ForModel("llama3").Name())
+	assert.Equal(t, "o200k_base", ForModel("gpt-5").Name())
+	for _, model := range []string{"o10", "o3x", "gpt-5x"} {
+		assert.Equal(t, "cl100k_base", ForModel(model).Name(), model)
+	}
+}
+
+func TestHasModelPrefix(t *testing.T) {
+	assert.True(t, HasModelPrefix("gpt-4", "gpt-4"))
+	assert.True(t, HasModelPrefix("gpt-4-0613", "gpt-4"))
+	assert.False(t, HasModelPrefix("gpt-4o", "gpt-4"))
+	assert.False(t, HasModelPrefix("gpt-4.5-preview", "gpt-4"))
+	assert.False(t, HasModelPrefix("gpt", "gpt-4"))
+}
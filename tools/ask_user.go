@@ -70,6 +70,11 @@ func (b *AskUser) CompactArgs(args json.RawMessage) json.RawMessage {
 	return args
 }
 
+// Questions are asked one at a time.
+func (b *AskUser) ConcurrencySafe() bool {
+	return false
+}
+
 func NewAskUser() *AskUser {
 	return &AskUser{
 		source: os.Stdin,
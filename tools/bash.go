@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -10,6 +11,10 @@ type BashTerminal struct {
 }
 
 func (b *BashTerminal) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return b.ExecuteContext(context.Background(), args)
+}
+
+func (b *BashTerminal) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var command struct {
 		Command string `json:"command"`
 	}
@@ -17,7 +22,7 @@ func (b *BashTerminal) Execute(args json.RawMessage) (json.RawMessage, error) {
 	if err != nil {
 		return nil, err
 	}
-	out, err := exec.Command("bash", "-c", command.Command).Output()
+	out, err := exec.CommandContext(ctx, "bash", "-c", command.Command).Output()
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			return nil, fmt.Errorf("bash exited with code %d: %s", exitError.ExitCode(), string(exitError.Stderr))
@@ -43,6 +48,12 @@ func (b *BashTerminal) CompactArgs(args json.RawMessage) json.RawMessage {
 	return args
 }
 
+// Commands may depend on each other's side effects,
+// so they run one at a time.
+func (b *BashTerminal) ConcurrencySafe() bool {
+	return false
+}
+
 func NewBashTerminal() *BashTerminal {
 	return &BashTerminal{}
 }
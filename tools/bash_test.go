@@ -1,9 +1,11 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,3 +44,12 @@ func TestBash(t *testing.T) {
 		})
 	}
 }
+
+func TestBashContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewBashTerminal().ExecuteContext(ctx, json.RawMessage(`{"command": "sleep 10"}`))
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/natexcvi/go-llm/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExecuteContext executes the tool, passing ctx along if
+// the tool supports it. Tools that are not context aware
+// are only checked for cancellation before they run.
+func ExecuteContext(ctx context.Context, tool Tool, args json.RawMessage) (output json.RawMessage, err error) {
+	ctx, span := tracing.Start(ctx, "tools", "execute_tool "+tool.Name(),
+		trace.WithAttributes(attribute.String("tool.name", tool.Name())),
+	)
+	defer func() { tracing.End(span, err) }()
+	if tool, ok := tool.(ToolWithContext); ok {
+		return tool.ExecuteContext(ctx, args)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tool.Execute(args)
+}
+
+// ProcessForTool preprocesses the arguments to the tool,
+// letting preprocessors that depend on the tool know it.
+func ProcessForTool(ctx context.Context, preprocessor PreprocessingTool, tool Tool, args json.RawMessage) (json.RawMessage, error) {
+	if preprocessor, ok := preprocessor.(ToolAwarePreprocessingTool); ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return preprocessor.ProcessForTool(ctx, tool, args)
+	}
+	return ProcessContext(ctx, preprocessor, args)
+}
+
+// ProcessContext is the PreprocessingTool counterpart
+// of ExecuteContext.
+func ProcessContext(ctx context.Context, preprocessor PreprocessingTool, args json.RawMessage) (json.RawMessage, error) {
+	if preprocessor, ok := preprocessor.(PreprocessingToolWithContext); ok {
+		return preprocessor.ProcessContext(ctx, args)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return preprocessor.Process(args)
+}
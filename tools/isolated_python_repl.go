@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -17,6 +18,10 @@ func NewIsolatedPythonREPL() *IsolatedPythonREPL {
 }
 
 func (repl *IsolatedPythonREPL) Execute(arg json.RawMessage) (json.RawMessage, error) {
+	return repl.ExecuteContext(context.Background(), arg)
+}
+
+func (repl *IsolatedPythonREPL) ExecuteContext(ctx context.Context, arg json.RawMessage) (json.RawMessage, error) {
 	var args struct {
 		Code    string   `json:"code"`
 		Modules []string `json:"modules"`
@@ -43,7 +48,7 @@ func (repl *IsolatedPythonREPL) Execute(arg json.RawMessage) (json.RawMessage, e
 	}
 	shArgs = append(shArgs, "python", path.Join("app", "script.py"))
 	cmdArgs = append(cmdArgs, "sh", "-c", strings.Join(shArgs, " "))
-	cmd := exec.Command("docker", cmdArgs...)
+	cmd := exec.CommandContext(ctx, "docker", cmdArgs...)
 	out, err := cmd.Output()
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
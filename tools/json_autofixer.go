@@ -1,12 +1,14 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/natexcvi/go-llm/engines"
+	"github.com/natexcvi/go-llm/internal/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -60,6 +62,16 @@ func (t *JSONAutoFixer) extractJSONFromResponse(response string) string {
 }
 
 func (t *JSONAutoFixer) Process(args json.RawMessage) (json.RawMessage, error) {
+	return t.ProcessContext(context.Background(), args)
+}
+
+func (t *JSONAutoFixer) ProcessContext(ctx context.Context, args json.RawMessage) (output json.RawMessage, err error) {
+	ctx, span := tracing.Start(ctx, "tools", "JSONAutoFixer.Process")
+	defer func() { tracing.End(span, err) }()
+	return t.fix(ctx, args)
+}
+
+func (t *JSONAutoFixer) fix(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	if err := t.validateJSON(string(args)); err == nil {
 		return args, nil
 	}
@@ -67,7 +79,7 @@ func (t *JSONAutoFixer) Process(args json.RawMessage) (json.RawMessage, error) {
 	prompt := t.prompt(args)
 	var cumErr *multierror.Error
 	for i := 0; i < t.maxRetries; i++ {
-		resp, err := t.engine.Chat(prompt)
+		resp, err := engines.ChatContext(engines.ContextWithComponent(ctx, engines.ComponentJSONAutoFixer), t.engine, prompt)
 		if err != nil {
 			return nil, fmt.Errorf("error running JSON auto fixer: %w", err)
 		}
@@ -88,6 +88,10 @@ func (s *KeyValueStore) CompactArgs(args json.RawMessage) json.RawMessage {
 	}
 }
 
+func (s *KeyValueStore) ConcurrencySafe() bool {
+	return false
+}
+
 func (s *KeyValueStore) recursivelyProcessStringFields(input any, processor func(string) string) any {
 	switch input := input.(type) {
 	case map[string]interface{}:
@@ -5,10 +5,13 @@
 package mocks
 
 import (
+	context "context"
 	json "encoding/json"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	engines "github.com/natexcvi/go-llm/engines"
+	tools "github.com/natexcvi/go-llm/tools"
 )
 
 // MockTool is a mock of Tool interface.
@@ -105,6 +108,223 @@ func (mr *MockToolMockRecorder) Name() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockTool)(nil).Name))
 }
 
+// MockToolWithContext is a mock of ToolWithContext interface.
+type MockToolWithContext struct {
+	ctrl     *gomock.Controller
+	recorder *MockToolWithContextMockRecorder
+}
+
+// MockToolWithContextMockRecorder is the mock recorder for MockToolWithContext.
+type MockToolWithContextMockRecorder struct {
+	mock *MockToolWithContext
+}
+
+// NewMockToolWithContext creates a new mock instance.
+func NewMockToolWithContext(ctrl *gomock.Controller) *MockToolWithContext {
+	mock := &MockToolWithContext{ctrl: ctrl}
+	mock.recorder = &MockToolWithContextMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockToolWithContext) EXPECT() *MockToolWithContextMockRecorder {
+	return m.recorder
+}
+
+// ArgsSchema mocks base method.
+func (m *MockToolWithContext) ArgsSchema() json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArgsSchema")
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// ArgsSchema indicates an expected call of ArgsSchema.
+func (mr *MockToolWithContextMockRecorder) ArgsSchema() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArgsSchema", reflect.TypeOf((*MockToolWithContext)(nil).ArgsSchema))
+}
+
+// CompactArgs mocks base method.
+func (m *MockToolWithContext) CompactArgs(args json.RawMessage) json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompactArgs", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// CompactArgs indicates an expected call of CompactArgs.
+func (mr *MockToolWithContextMockRecorder) CompactArgs(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompactArgs", reflect.TypeOf((*MockToolWithContext)(nil).CompactArgs), args)
+}
+
+// Description mocks base method.
+func (m *MockToolWithContext) Description() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Description")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Description indicates an expected call of Description.
+func (mr *MockToolWithContextMockRecorder) Description() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Description", reflect.TypeOf((*MockToolWithContext)(nil).Description))
+}
+
+// Execute mocks base method.
+func (m *MockToolWithContext) Execute(args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Execute", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Execute indicates an expected call of Execute.
+func (mr *MockToolWithContextMockRecorder) Execute(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockToolWithContext)(nil).Execute), args)
+}
+
+// ExecuteContext mocks base method.
+func (m *MockToolWithContext) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteContext", ctx, args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecuteContext indicates an expected call of ExecuteContext.
+func (mr *MockToolWithContextMockRecorder) ExecuteContext(ctx, args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteContext", reflect.TypeOf((*MockToolWithContext)(nil).ExecuteContext), ctx, args)
+}
+
+// Name mocks base method.
+func (m *MockToolWithContext) Name() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Name")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Name indicates an expected call of Name.
+func (mr *MockToolWithContextMockRecorder) Name() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockToolWithContext)(nil).Name))
+}
+
+// MockSchemaTool is a mock of SchemaTool interface.
+type MockSchemaTool struct {
+	ctrl     *gomock.Controller
+	recorder *MockSchemaToolMockRecorder
+}
+
+// MockSchemaToolMockRecorder is the mock recorder for MockSchemaTool.
+type MockSchemaToolMockRecorder struct {
+	mock *MockSchemaTool
+}
+
+// NewMockSchemaTool creates a new mock instance.
+func NewMockSchemaTool(ctrl *gomock.Controller) *MockSchemaTool {
+	mock := &MockSchemaTool{ctrl: ctrl}
+	mock.recorder = &MockSchemaToolMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSchemaTool) EXPECT() *MockSchemaToolMockRecorder {
+	return m.recorder
+}
+
+// ArgsSchema mocks base method.
+func (m *MockSchemaTool) ArgsSchema() json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArgsSchema")
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// ArgsSchema indicates an expected call of ArgsSchema.
+func (mr *MockSchemaToolMockRecorder) ArgsSchema() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArgsSchema", reflect.TypeOf((*MockSchemaTool)(nil).ArgsSchema))
+}
+
+// CompactArgs mocks base method.
+func (m *MockSchemaTool) CompactArgs(args json.RawMessage) json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompactArgs", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// CompactArgs indicates an expected call of CompactArgs.
+func (mr *MockSchemaToolMockRecorder) CompactArgs(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompactArgs", reflect.TypeOf((*MockSchemaTool)(nil).CompactArgs), args)
+}
+
+// Description mocks base method.
+func (m *MockSchemaTool) Description() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Description")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Description indicates an expected call of Description.
+func (mr *MockSchemaToolMockRecorder) Description() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Description", reflect.TypeOf((*MockSchemaTool)(nil).Description))
+}
+
+// Execute mocks base method.
+func (m *MockSchemaTool) Execute(args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Execute", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Execute indicates an expected call of Execute.
+func (mr *MockSchemaToolMockRecorder) Execute(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockSchemaTool)(nil).Execute), args)
+}
+
+// Name mocks base method.
+func (m *MockSchemaTool) Name() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Name")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Name indicates an expected call of Name.
+func (mr *MockSchemaToolMockRecorder) Name() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockSchemaTool)(nil).Name))
+}
+
+// ParametersSchema mocks base method.
+func (m *MockSchemaTool) ParametersSchema() *engines.ParameterSpecs {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ParametersSchema")
+	ret0, _ := ret[0].(*engines.ParameterSpecs)
+	return ret0
+}
+
+// ParametersSchema indicates an expected call of ParametersSchema.
+func (mr *MockSchemaToolMockRecorder) ParametersSchema() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParametersSchema", reflect.TypeOf((*MockSchemaTool)(nil).ParametersSchema))
+}
+
 // MockPreprocessingTool is a mock of PreprocessingTool interface.
 type MockPreprocessingTool struct {
 	ctrl     *gomock.Controller
@@ -142,3 +362,217 @@ func (mr *MockPreprocessingToolMockRecorder) Process(args interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Process", reflect.TypeOf((*MockPreprocessingTool)(nil).Process), args)
 }
+
+// MockPreprocessingToolWithContext is a mock of PreprocessingToolWithContext interface.
+type MockPreprocessingToolWithContext struct {
+	ctrl     *gomock.Controller
+	recorder *MockPreprocessingToolWithContextMockRecorder
+}
+
+// MockPreprocessingToolWithContextMockRecorder is the mock recorder for MockPreprocessingToolWithContext.
+type MockPreprocessingToolWithContextMockRecorder struct {
+	mock *MockPreprocessingToolWithContext
+}
+
+// NewMockPreprocessingToolWithContext creates a new mock instance.
+func NewMockPreprocessingToolWithContext(ctrl *gomock.Controller) *MockPreprocessingToolWithContext {
+	mock := &MockPreprocessingToolWithContext{ctrl: ctrl}
+	mock.recorder = &MockPreprocessingToolWithContextMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPreprocessingToolWithContext) EXPECT() *MockPreprocessingToolWithContextMockRecorder {
+	return m.recorder
+}
+
+// Process mocks base method.
+func (m *MockPreprocessingToolWithContext) Process(args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Process", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Process indicates an expected call of Process.
+func (mr *MockPreprocessingToolWithContextMockRecorder) Process(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Process", reflect.TypeOf((*MockPreprocessingToolWithContext)(nil).Process), args)
+}
+
+// ProcessContext mocks base method.
+func (m *MockPreprocessingToolWithContext) ProcessContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessContext", ctx, args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessContext indicates an expected call of ProcessContext.
+func (mr *MockPreprocessingToolWithContextMockRecorder) ProcessContext(ctx, args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessContext", reflect.TypeOf((*MockPreprocessingToolWithContext)(nil).ProcessContext), ctx, args)
+}
+
+// MockToolAwarePreprocessingTool is a mock of ToolAwarePreprocessingTool interface.
+type MockToolAwarePreprocessingTool struct {
+	ctrl     *gomock.Controller
+	recorder *MockToolAwarePreprocessingToolMockRecorder
+}
+
+// MockToolAwarePreprocessingToolMockRecorder is the mock recorder for MockToolAwarePreprocessingTool.
+type MockToolAwarePreprocessingToolMockRecorder struct {
+	mock *MockToolAwarePreprocessingTool
+}
+
+// NewMockToolAwarePreprocessingTool creates a new mock instance.
+func NewMockToolAwarePreprocessingTool(ctrl *gomock.Controller) *MockToolAwarePreprocessingTool {
+	mock := &MockToolAwarePreprocessingTool{ctrl: ctrl}
+	mock.recorder = &MockToolAwarePreprocessingToolMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockToolAwarePreprocessingTool) EXPECT() *MockToolAwarePreprocessingToolMockRecorder {
+	return m.recorder
+}
+
+// Process mocks base method.
+func (m *MockToolAwarePreprocessingTool) Process(args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Process", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Process indicates an expected call of Process.
+func (mr *MockToolAwarePreprocessingToolMockRecorder) Process(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Process", reflect.TypeOf((*MockToolAwarePreprocessingTool)(nil).Process), args)
+}
+
+// ProcessForTool mocks base method.
+func (m *MockToolAwarePreprocessingTool) ProcessForTool(ctx context.Context, tool tools.Tool, args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessForTool", ctx, tool, args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessForTool indicates an expected call of ProcessForTool.
+func (mr *MockToolAwarePreprocessingToolMockRecorder) ProcessForTool(ctx, tool, args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessForTool", reflect.TypeOf((*MockToolAwarePreprocessingTool)(nil).ProcessForTool), ctx, tool, args)
+}
+
+// MockConcurrencyReportingTool is a mock of ConcurrencyReportingTool interface.
+type MockConcurrencyReportingTool struct {
+	ctrl     *gomock.Controller
+	recorder *MockConcurrencyReportingToolMockRecorder
+}
+
+// MockConcurrencyReportingToolMockRecorder is the mock recorder for MockConcurrencyReportingTool.
+type MockConcurrencyReportingToolMockRecorder struct {
+	mock *MockConcurrencyReportingTool
+}
+
+// NewMockConcurrencyReportingTool creates a new mock instance.
+func NewMockConcurrencyReportingTool(ctrl *gomock.Controller) *MockConcurrencyReportingTool {
+	mock := &MockConcurrencyReportingTool{ctrl: ctrl}
+	mock.recorder = &MockConcurrencyReportingToolMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConcurrencyReportingTool) EXPECT() *MockConcurrencyReportingToolMockRecorder {
+	return m.recorder
+}
+
+// ArgsSchema mocks base method.
+func (m *MockConcurrencyReportingTool) ArgsSchema() json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArgsSchema")
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// ArgsSchema indicates an expected call of ArgsSchema.
+func (mr *MockConcurrencyReportingToolMockRecorder) ArgsSchema() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArgsSchema", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).ArgsSchema))
+}
+
+// CompactArgs mocks base method.
+func (m *MockConcurrencyReportingTool) CompactArgs(args json.RawMessage) json.RawMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompactArgs", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	return ret0
+}
+
+// CompactArgs indicates an expected call of CompactArgs.
+func (mr *MockConcurrencyReportingToolMockRecorder) CompactArgs(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompactArgs", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).CompactArgs), args)
+}
+
+// ConcurrencySafe mocks base method.
+func (m *MockConcurrencyReportingTool) ConcurrencySafe() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConcurrencySafe")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// ConcurrencySafe indicates an expected call of ConcurrencySafe.
+func (mr *MockConcurrencyReportingToolMockRecorder) ConcurrencySafe() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConcurrencySafe", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).ConcurrencySafe))
+}
+
+// Description mocks base method.
+func (m *MockConcurrencyReportingTool) Description() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Description")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Description indicates an expected call of Description.
+func (mr *MockConcurrencyReportingToolMockRecorder) Description() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Description", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).Description))
+}
+
+// Execute mocks base method.
+func (m *MockConcurrencyReportingTool) Execute(args json.RawMessage) (json.RawMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Execute", args)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Execute indicates an expected call of Execute.
+func (mr *MockConcurrencyReportingToolMockRecorder) Execute(args interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).Execute), args)
+}
+
+// Name mocks base method.
+func (m *MockConcurrencyReportingTool) Name() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Name")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Name indicates an expected call of Name.
+func (mr *MockConcurrencyReportingToolMockRecorder) Name() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockConcurrencyReportingTool)(nil).Name))
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,21 +12,21 @@ type PythonREPL struct {
 	pythonBinary string
 }
 
-func (p *PythonREPL) createVenv() error {
+func (p *PythonREPL) createVenv(ctx context.Context) error {
 	if _, err := os.Stat(".venv"); err == nil {
 		return nil
 	}
-	_, err := exec.Command(p.pythonBinary, "-m", "venv", ".venv").Output()
+	_, err := exec.CommandContext(ctx, p.pythonBinary, "-m", "venv", ".venv").Output()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *PythonREPL) installModules(modules []string) error {
+func (p *PythonREPL) installModules(ctx context.Context, modules []string) error {
 	args := []string{"-m", "pip", "install"}
 	args = append(args, modules...)
-	_, err := exec.Command("./.venv/bin/python", args...).Output()
+	_, err := exec.CommandContext(ctx, "./.venv/bin/python", args...).Output()
 	if err != nil {
 		return err
 	}
@@ -33,6 +34,10 @@ func (p *PythonREPL) installModules(modules []string) error {
 }
 
 func (p *PythonREPL) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return p.ExecuteContext(context.Background(), args)
+}
+
+func (p *PythonREPL) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var command struct {
 		Code    string   `json:"code"`
 		Modules []string `json:"modules"`
@@ -41,12 +46,12 @@ func (p *PythonREPL) Execute(args json.RawMessage) (json.RawMessage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal args: %w", err)
 	}
-	err = p.createVenv()
+	err = p.createVenv(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create venv: %w", err)
 	}
 	if len(command.Modules) > 0 {
-		err = p.installModules(command.Modules)
+		err = p.installModules(ctx, command.Modules)
 		if err != nil {
 			if exitError, ok := err.(*exec.ExitError); ok {
 				return nil, fmt.Errorf("failed to install modules: %s", string(exitError.Stderr))
@@ -54,7 +59,7 @@ func (p *PythonREPL) Execute(args json.RawMessage) (json.RawMessage, error) {
 			return nil, fmt.Errorf("failed to install modules: %w", err)
 		}
 	}
-	out, err := exec.Command("./.venv/bin/python", "-c", command.Code).Output()
+	out, err := exec.CommandContext(ctx, "./.venv/bin/python", "-c", command.Code).Output()
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			return nil, fmt.Errorf("python exited with code %d: %s", exitError.ExitCode(), string(exitError.Stderr))
@@ -81,6 +86,11 @@ func (p *PythonREPL) CompactArgs(args json.RawMessage) json.RawMessage {
 	return args
 }
 
+// All executions share the same virtual environment.
+func (p *PythonREPL) ConcurrencySafe() bool {
+	return false
+}
+
 func NewPythonREPL() *PythonREPL {
 	return &PythonREPL{
 		pythonBinary: "python3",
@@ -1,6 +1,11 @@
 package tools
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/natexcvi/go-llm/engines"
+)
 
 //go:generate mockgen -source=tool.go -destination=mocks/tool.go -package=mocks
 type Tool interface {
@@ -26,8 +31,62 @@ type Tool interface {
 	CompactArgs(args json.RawMessage) json.RawMessage
 }
 
+// A Tool whose execution can be cancelled
+// through a context.
+type ToolWithContext interface {
+	Tool
+	// Executes the tool like Execute, aborting
+	// as soon as possible once ctx is done.
+	ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error)
+}
+
+// A Tool that specifies the exact JSON schema of its
+// arguments, which model-native function calls use
+// instead of the one converted from its ArgsSchema.
+// Tools whose JSON schema is written rather than derived
+// can parse it with engines.ParseJSONSchema.
+type SchemaTool interface {
+	Tool
+	ParametersSchema() *engines.ParameterSpecs
+}
+
 type PreprocessingTool interface {
 	// Preprocesses the arguments before
 	// they are passed to any tool.
 	Process(args json.RawMessage) (json.RawMessage, error)
 }
+
+// A PreprocessingTool whose processing can be
+// cancelled through a context.
+type PreprocessingToolWithContext interface {
+	PreprocessingTool
+	// Preprocesses the arguments like Process,
+	// aborting as soon as possible once ctx is done.
+	ProcessContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error)
+}
+
+// A PreprocessingTool whose processing depends on the
+// tool the arguments are for, e.g. to check them
+// against the tool's schema.
+type ToolAwarePreprocessingTool interface {
+	PreprocessingTool
+	// Preprocesses the arguments to the tool.
+	ProcessForTool(ctx context.Context, tool Tool, args json.RawMessage) (json.RawMessage, error)
+}
+
+// A Tool that reports whether it may run concurrently
+// with other actions, e.g. because it has shared state.
+type ConcurrencyReportingTool interface {
+	Tool
+	ConcurrencySafe() bool
+}
+
+// IsConcurrencySafe reports whether the tool may run
+// concurrently with other actions. Tools that do not
+// report it are assumed to be safe.
+func IsConcurrencySafe(tool Tool) bool {
+	if tool, ok := tool.(ConcurrencyReportingTool); ok {
+		return tool.ConcurrencySafe()
+	}
+	return true
+}
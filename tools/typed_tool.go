@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/natexcvi/go-llm/engines"
+)
+
+// A Tool backed by a Go function. Its arguments are the
+// JSON encoding of Args, a struct whose schemas are derived
+// from its struct tags, as described by engines.SchemaOf.
+// Arguments that do not follow the schema are rejected with
+// an error that names the offending fields, and the result
+// of the function is returned as JSON.
+type TypedTool[Args any, Result any] struct {
+	name        string
+	description string
+	schema      *engines.ParameterSpecs
+	argSchema   json.RawMessage
+	handler     func(ctx context.Context, args Args) (Result, error)
+}
+
+func (t *TypedTool[Args, Result]) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *TypedTool[Args, Result]) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	if err := validateArgs(t.schema, args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	var typedArgs Args
+	if err := json.Unmarshal(args, &typedArgs); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	result, err := t.handler(ctx, typedArgs)
+	if err != nil {
+		return nil, err
+	}
+	output, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+	return output, nil
+}
+
+func (t *TypedTool[Args, Result]) Name() string {
+	return t.name
+}
+
+func (t *TypedTool[Args, Result]) Description() string {
+	return t.description
+}
+
+func (t *TypedTool[Args, Result]) ArgsSchema() json.RawMessage {
+	return t.argSchema
+}
+
+func (t *TypedTool[Args, Result]) ParametersSchema() *engines.ParameterSpecs {
+	return t.schema
+}
+
+func (t *TypedTool[Args, Result]) CompactArgs(args json.RawMessage) json.RawMessage {
+	return args
+}
+
+// NewTypedTool creates a tool that calls handler with its
+// arguments. It fails if Args is not a struct, or has fields
+// whose schema cannot be derived.
+func NewTypedTool[Args any, Result any](name, description string, handler func(ctx context.Context, args Args) (Result, error)) (*TypedTool[Args, Result], error) {
+	var args Args
+	schema, err := engines.SchemaOf(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the schema of %T: %w", args, err)
+	}
+	if schema.Type != "object" || schema.Properties == nil {
+		return nil, fmt.Errorf("the arguments of a typed tool must be a struct, got %T", args)
+	}
+	return &TypedTool[Args, Result]{
+		name:        name,
+		description: description,
+		schema:      schema,
+		argSchema:   engines.FuzzySchema(schema),
+		handler:     handler,
+	}, nil
+}
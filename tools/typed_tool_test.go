@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/natexcvi/go-llm/engines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type weatherArgs struct {
+	City string   `json:"city" description:"the city"`
+	Unit string   `json:"unit,omitempty" enum:"C,F"`
+	Days int      `json:"days" description:"number of days"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type weatherResult struct {
+	Forecast []string `json:"forecast"`
+}
+
+func newWeatherTool(t *testing.T) *TypedTool[weatherArgs, weatherResult] {
+	t.Helper()
+	tool, err := NewTypedTool("weather", "Gets the weather", func(ctx context.Context, args weatherArgs) (weatherResult, error) {
+		if args.City == "Atlantis" {
+			return weatherResult{}, errors.New("unknown city")
+		}
+		forecast := make([]string, args.Days)
+		for i := range forecast {
+			forecast[i] = "sunny in " + args.City + " " + args.Unit
+		}
+		return weatherResult{Forecast: forecast}, nil
+	})
+	require.NoError(t, err)
+	return tool
+}
+
+func TestTypedTool(t *testing.T) {
+	testCases := []struct {
+		name           string
+		args           string
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:           "valid arguments",
+			args:           `{"city": "Paris", "unit": "C", "days": 2}`,
+			expectedOutput: `{"forecast":["sunny in Paris C","sunny in Paris C"]}`,
+		},
+		{
+			name:        "missing and mistyped fields",
+			args:        `{"days": "two", "tags": ["a", 1]}`,
+			expectedErr: "invalid arguments: 3 errors occurred:\n\t* field `city` is required\n\t* field `days` must be an integer, got a string (\"two\")\n\t* field `tags[1]` must be a string, got a number (1)\n\n",
+		},
+		{
+			name:        "value not in enum",
+			args:        `{"city": "Paris", "unit": "K", "days": 1}`,
+			expectedErr: "invalid arguments: 1 error occurred:\n\t* field `unit` must be one of C, F, got K\n\n",
+		},
+		{
+			name:        "not an object",
+			args:        `["Paris"]`,
+			expectedErr: "invalid arguments: 1 error occurred:\n\t* arguments must be an object, got an array\n\n",
+		},
+		{
+			name:        "handler error",
+			args:        `{"city": "Atlantis", "days": 1}`,
+			expectedErr: "unknown city",
+		},
+	}
+	tool := newWeatherTool(t)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := tool.Execute(json.RawMessage(tc.args))
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expectedOutput, string(output))
+		})
+	}
+}
+
+func TestTypedToolSchemas(t *testing.T) {
+	tool := newWeatherTool(t)
+	assert.JSONEq(t,
+		`{"city": "the city", "unit": "C/F", "days": "number of days", "tags": ["string"]}`,
+		string(tool.ArgsSchema()),
+	)
+	specs, err := ConvertToNativeFunctionSpecs(tool)
+	require.NoError(t, err)
+	assert.Equal(t, engines.FunctionSpecs{
+		Name:        "weather",
+		Description: "Gets the weather",
+		Parameters: &engines.ParameterSpecs{
+			Type: "object",
+			Properties: map[string]*engines.ParameterSpecs{
+				"city": {Type: "string", Description: "the city"},
+				"unit": {Type: "string", Enum: []any{"C", "F"}},
+				"days": {Type: "integer", Description: "number of days"},
+				"tags": {Type: "array", Items: &engines.ParameterSpecs{Type: "string"}},
+			},
+			Required: []string{"city", "days"},
+		},
+	}, specs)
+
+	_, err = NewTypedTool("echo", "Echoes the input", func(ctx context.Context, text string) (string, error) {
+		return text, nil
+	})
+	assert.EqualError(t, err, "the arguments of a typed tool must be a struct, got string")
+}
@@ -13,6 +13,13 @@ var (
 )
 
 func ConvertToNativeFunctionSpecs(tool Tool) (engines.FunctionSpecs, error) {
+	if tool, ok := tool.(SchemaTool); ok {
+		return engines.FunctionSpecs{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.ParametersSchema(),
+		}, nil
+	}
 	parameterSpecs, err := convertArgSchemaToParameterSpecs(tool.ArgsSchema())
 	if err != nil {
 		return engines.FunctionSpecs{}, err
@@ -34,7 +41,10 @@ func convertArgSchemaToParameterSpecs(argSchema json.RawMessage) (engines.Parame
 		specs := engines.ParameterSpecs{
 			Type:       "object",
 			Properties: map[string]*engines.ParameterSpecs{},
-			Required:   []string{},
+			// An example-based schema cannot tell which properties
+			// a tool requires, so all of them stay optional. Tools
+			// with required properties implement SchemaTool.
+			Required: []string{},
 		}
 		for key, value := range schema {
 			marshaledValue, err := json.Marshal(value)
@@ -46,7 +56,6 @@ func convertArgSchemaToParameterSpecs(argSchema json.RawMessage) (engines.Parame
 				return engines.ParameterSpecs{}, err
 			}
 			specs.Properties[key] = &propertySpecs
-			// specs.Required = append(specs.Required, key)
 		}
 		return specs, nil
 	case []any:
@@ -65,7 +74,8 @@ func convertArgSchemaToParameterSpecs(argSchema json.RawMessage) (engines.Parame
 				return engines.ParameterSpecs{}, err
 			}
 			if specs.Items != nil && specs.Items.Type != propertySpecs.Type {
-				return engines.ParameterSpecs{}, fmt.Errorf("%w: arrays with values of more than one type not currently supported", ErrCannotAutoConvertArgSchema)
+				specs.Items = withAlternative(specs.Items, &propertySpecs)
+				continue
 			}
 			if specs.Items != nil && specs.Items.Description != propertySpecs.Description {
 				propertySpecs.Description = strings.Join([]string{
@@ -95,3 +105,18 @@ func convertArgSchemaToParameterSpecs(argSchema json.RawMessage) (engines.Parame
 		return engines.ParameterSpecs{}, ErrCannotAutoConvertArgSchema
 	}
 }
+
+// withAlternative returns the item specs of an array whose
+// items may also follow alternative, as one of anyOf.
+func withAlternative(items, alternative *engines.ParameterSpecs) *engines.ParameterSpecs {
+	if items.Type != "" {
+		items = &engines.ParameterSpecs{AnyOf: []*engines.ParameterSpecs{items}}
+	}
+	for _, option := range items.AnyOf {
+		if option.Type == alternative.Type {
+			return items
+		}
+	}
+	items.AnyOf = append(items.AnyOf, alternative)
+	return items
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/natexcvi/go-llm/engines"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockTool struct {
@@ -33,6 +34,25 @@ func (t *mockTool) CompactArgs(args json.RawMessage) json.RawMessage {
 	return args
 }
 
+type mockSchemaTool struct {
+	mockTool
+	schema *engines.ParameterSpecs
+}
+
+func (t *mockSchemaTool) ParametersSchema() *engines.ParameterSpecs {
+	return t.schema
+}
+
+func newMockSchemaTool(t *testing.T, name, schema string) *mockSchemaTool {
+	t.Helper()
+	specs, err := engines.ParseJSONSchema(json.RawMessage(schema))
+	require.NoError(t, err)
+	return &mockSchemaTool{
+		mockTool: mockTool{name: name, description: "This is a test.", argsSchema: `{"text": "some text"}`},
+		schema:   specs,
+	}
+}
+
 func TestConvertToLLMFunctionSpecs(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -102,12 +122,59 @@ func TestConvertToLLMFunctionSpecs(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "Tool args with mixed array",
+			tool: &mockTool{
+				name:        "mixed_tool",
+				description: "This is a test.",
+				argsSchema:  `{"text": "some text", "mixed": ["a word", 1, "another word"]}`,
+			},
+			expectedOutput: engines.FunctionSpecs{
+				Name:        "mixed_tool",
+				Description: "This is a test.",
+				Parameters: &engines.ParameterSpecs{
+					Type: "object",
+					Properties: map[string]*engines.ParameterSpecs{
+						"text": {Type: "string", Description: "some text"},
+						"mixed": {
+							Type: "array",
+							Items: &engines.ParameterSpecs{AnyOf: []*engines.ParameterSpecs{
+								{Type: "string", Description: "a word"},
+								{Type: "number", Description: "a number"},
+							}},
+						},
+					},
+					Required: []string{},
+				},
+			},
+		},
+		{
+			name: "Tool with JSON schema",
+			tool: newMockSchemaTool(t, "schema_tool",
+				`{"type": "object", "properties": {"text": {"type": ["string", "null"], "default": ""}}, "additionalProperties": false}`,
+			),
+			expectedOutput: engines.FunctionSpecs{
+				Name:        "schema_tool",
+				Description: "This is a test.",
+				Parameters: &engines.ParameterSpecs{
+					Type: "object",
+					Properties: map[string]*engines.ParameterSpecs{
+						"text": {Type: "string", Nullable: true, Default: ""},
+					},
+					NoAdditionalProperties: true,
+				},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			output, err := ConvertToNativeFunctionSpecs(tc.tool)
 			assert.Equal(t, tc.expectedOutput, output)
-			assert.Equal(t, tc.expectedErr, err)
+			if tc.expectedErr != nil {
+				assert.EqualError(t, err, tc.expectedErr.Error())
+				return
+			}
+			assert.NoError(t, err)
 		})
 	}
 }
@@ -0,0 +1,328 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/natexcvi/go-llm/engines"
+)
+
+// ArgsValidator is a PreprocessingTool that checks the
+// arguments of each action against the exact schema of its
+// tool before the tool runs. Only SchemaTool tools are
+// checked, since the types of fuzzy schemas are guessed
+// from their example values.
+// Its errors name the offending fields by their path in the
+// arguments, e.g. "field `items[0].name` is required", so
+// that the agent can correct them.
+type ArgsValidator struct {
+	// Whether obvious mismatches are converted to the
+	// expected type rather than reported, e.g. the
+	// string "42" where a number is expected. Null
+	// optional properties that are not nullable are
+	// then left out rather than reported.
+	Coerce bool
+}
+
+// Process returns the arguments as they are,
+// since there is no tool to check them against.
+func (v *ArgsValidator) Process(args json.RawMessage) (json.RawMessage, error) {
+	return args, nil
+}
+
+func (v *ArgsValidator) ProcessForTool(_ context.Context, tool Tool, args json.RawMessage) (json.RawMessage, error) {
+	schemaTool, ok := tool.(SchemaTool)
+	if !ok || schemaTool.ParametersSchema() == nil {
+		// the tool's arguments cannot be checked
+		return args, nil
+	}
+	return checkArgs(schemaTool.ParametersSchema(), args, v.Coerce)
+}
+
+// Converts obvious mismatches to the expected
+// type rather than report them.
+func (v *ArgsValidator) WithCoercion() *ArgsValidator {
+	v.Coerce = true
+	return v
+}
+
+func NewArgsValidator() *ArgsValidator {
+	return &ArgsValidator{}
+}
+
+// validateArgs checks that the arguments follow the schema.
+func validateArgs(schema *engines.ParameterSpecs, args json.RawMessage) error {
+	_, err := checkArgs(schema, args, false)
+	return err
+}
+
+// checkArgs checks that the arguments follow the schema,
+// returning them with the coerced values, if any.
+func checkArgs(schema *engines.ParameterSpecs, args json.RawMessage, coerce bool) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	check := &argsCheck{coerce: coerce}
+	value = check.value(schema, value, "")
+	if err := check.errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	if !check.coerced {
+		return args, nil
+	}
+	return json.Marshal(value)
+}
+
+type argsCheck struct {
+	coerce  bool
+	coerced bool
+	errs    *multierror.Error
+}
+
+func (c *argsCheck) report(format string, a ...any) {
+	c.errs = multierror.Append(c.errs, fmt.Errorf(format, a...))
+}
+
+// value checks the value against the schema, and
+// returns it, coerced to the schema's type if needed.
+func (c *argsCheck) value(schema *engines.ParameterSpecs, value any, path string) any {
+	if schema == nil || (value == nil && schema.Nullable) {
+		return value
+	}
+	if len(schema.AnyOf) > 0 && !c.matchesAny(schema.AnyOf, value, path) {
+		c.report("%s must match one of: %s", describePath(path), describeOptions(schema.AnyOf))
+		return value
+	}
+	if !hasType(schema.Type, value) {
+		coerced, ok := c.coerceValue(schema.Type, value)
+		if !ok {
+			c.report("%s must be %s, got %s", describePath(path), typeName(schema.Type), jsonTypeOf(value))
+			return value
+		}
+		value = coerced
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		values := make([]string, 0, len(schema.Enum))
+		for _, enumValue := range schema.Enum {
+			values = append(values, fmt.Sprint(enumValue))
+		}
+		c.report("%s must be one of %s, got %v", describePath(path), strings.Join(values, ", "), value)
+		return value
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		c.object(schema, value, path)
+	case []any:
+		for i, item := range value {
+			value[i] = c.value(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case json.Number:
+		number, _ := value.Float64()
+		if schema.Minimum != nil && number < *schema.Minimum {
+			c.report("%s must be at least %v, got %v", describePath(path), *schema.Minimum, value)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			c.report("%s must be at most %v, got %v", describePath(path), *schema.Maximum, value)
+		}
+	}
+	return value
+}
+
+func (c *argsCheck) object(schema *engines.ParameterSpecs, value map[string]any, path string) {
+	for _, name := range schema.Required {
+		property, ok := value[name]
+		if !ok || (property == nil && !isNullable(schema.Properties[name])) {
+			c.report("%s is required", describePath(joinPath(path, name)))
+		}
+	}
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyPath := joinPath(path, name)
+		property, ok := schema.Properties[name]
+		switch {
+		case ok:
+		case schema.NoAdditionalProperties:
+			c.report("%s is not allowed", describePath(propertyPath))
+			continue
+		default:
+			property = schema.AdditionalProperties
+		}
+		if value[name] == nil && !isNullable(property) {
+			if isRequired(schema, name) {
+				// missing required properties are reported above
+				continue
+			}
+			if c.coerce && property != nil && !c.matchesAny([]*engines.ParameterSpecs{property}, nil, propertyPath) {
+				// a null optional property is as good as omitted
+				delete(value, name)
+				c.coerced = true
+				continue
+			}
+		}
+		value[name] = c.value(property, value[name], propertyPath)
+	}
+}
+
+// matchesAny reports whether the value matches any of the
+// options, checking it against each without reporting.
+func (c *argsCheck) matchesAny(options []*engines.ParameterSpecs, value any, path string) bool {
+	for _, option := range options {
+		check := &argsCheck{}
+		check.value(option, value, path)
+		if check.errs == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// coerceValue converts the value to the type, if
+// coercion is enabled and the conversion is obvious.
+func (c *argsCheck) coerceValue(typ string, value any) (any, bool) {
+	if !c.coerce {
+		return nil, false
+	}
+	var coerced any
+	switch value := value.(type) {
+	case string:
+		switch typ {
+		case "number", "integer":
+			number := json.Number(strings.TrimSpace(value))
+			if _, err := number.Float64(); err != nil || !hasType(typ, number) {
+				return nil, false
+			}
+			coerced = number
+		case "boolean":
+			boolean, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, false
+			}
+			coerced = boolean
+		default:
+			return nil, false
+		}
+	case json.Number, bool:
+		if typ != "string" {
+			return nil, false
+		}
+		coerced = fmt.Sprint(value)
+	default:
+		return nil, false
+	}
+	c.coerced = true
+	return coerced, true
+}
+
+func isRequired(schema *engines.ParameterSpecs, name string) bool {
+	for _, required := range schema.Required {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isNullable(schema *engines.ParameterSpecs) bool {
+	return schema != nil && schema.Nullable
+}
+
+func hasType(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		// 1.0 and 1e3 are integers too
+		float, err := number.Float64()
+		return err == nil && float == math.Trunc(float) && !math.IsInf(float, 0)
+	default:
+		return true
+	}
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, enumValue := range enum {
+		if fmt.Sprint(enumValue) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeOptions(options []*engines.ParameterSpecs) string {
+	descriptions := make([]string, 0, len(options))
+	for _, option := range options {
+		descriptions = append(descriptions, string(engines.FuzzySchema(option)))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func jsonTypeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("a string (%q)", value)
+	case bool:
+		return "a boolean"
+	default:
+		return fmt.Sprintf("a number (%v)", value)
+	}
+}
+
+func typeName(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	default:
+		return "a " + typ
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return fmt.Sprintf("field `%s`", path)
+}
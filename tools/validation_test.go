@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgsValidator(t *testing.T) {
+	orderTool := newMockSchemaTool(t, "order", `{
+		"type": "object",
+		"properties": {
+			"items": {"type": "array", "items": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"quantity": {"type": "integer", "minimum": 1, "maximum": 10}
+				},
+				"required": ["name", "quantity"]
+			}},
+			"express": {"type": "boolean"},
+			"note": {"type": ["string", "null"]},
+			"coupon": {"anyOf": [{"type": "string"}, {"type": "integer"}]},
+			"size": {"type": "string", "enum": ["S", "M", "L"]}
+		},
+		"required": ["items", "note"],
+		"additionalProperties": false
+	}`)
+	testCases := []struct {
+		name         string
+		tool         Tool
+		coerce       bool
+		args         string
+		expectedArgs string
+		expectedErr  string
+	}{
+		{
+			name:         "valid arguments",
+			tool:         orderTool,
+			args:         `{"items": [{"name": "tea", "quantity": 2}], "note": null, "coupon": 10, "size": "M"}`,
+			expectedArgs: `{"items": [{"name": "tea", "quantity": 2}], "note": null, "coupon": 10, "size": "M"}`,
+		},
+		{
+			name: "invalid arguments",
+			tool: orderTool,
+			args: `{"items": [{"name": "tea", "quantity": 0}, {"quantity": "2"}], "express": "yes", "coupon": true, "size": "XL", "gift": true}`,
+			expectedErr: "8 errors occurred:\n" +
+				"\t* field `note` is required\n" +
+				"\t* field `coupon` must match one of: \"string\", \"integer\"\n" +
+				"\t* field `express` must be a boolean, got a string (\"yes\")\n" +
+				"\t* field `gift` is not allowed\n" +
+				"\t* field `items[0].quantity` must be at least 1, got 0\n" +
+				"\t* field `items[1].name` is required\n" +
+				"\t* field `items[1].quantity` must be an integer, got a string (\"2\")\n" +
+				"\t* field `size` must be one of S, M, L, got XL\n\n",
+		},
+		{
+			name:         "coerced arguments",
+			tool:         orderTool,
+			coerce:       true,
+			args:         `{"items": [{"name": 7, "quantity": " 3"}], "express": "true", "note": false}`,
+			expectedArgs: `{"items": [{"name": "7", "quantity": 3}], "express": true, "note": "false"}`,
+		},
+		{
+			name:        "arguments that cannot be coerced",
+			tool:        orderTool,
+			coerce:      true,
+			args:        `{"items": [{"name": "tea", "quantity": "2.5"}], "note": null}`,
+			expectedErr: "1 error occurred:\n\t* field `items[0].quantity` must be an integer, got a string (\"2.5\")\n\n",
+		},
+		{
+			name:         "integers written as decimals",
+			tool:         orderTool,
+			args:         `{"items": [{"name": "tea", "quantity": 2.0}, {"name": "milk", "quantity": 1e1}], "note": null}`,
+			expectedArgs: `{"items": [{"name": "tea", "quantity": 2.0}, {"name": "milk", "quantity": 1e1}], "note": null}`,
+		},
+		{
+			name:        "fractional integer",
+			tool:        orderTool,
+			args:        `{"items": [{"name": "tea", "quantity": 2.5}], "note": null}`,
+			expectedErr: "1 error occurred:\n\t* field `items[0].quantity` must be an integer, got a number (2.5)\n\n",
+		},
+		{
+			name:        "null optional arguments",
+			tool:        orderTool,
+			args:        `{"items": [], "note": null, "express": null, "size": null}`,
+			expectedErr: "2 errors occurred:\n\t* field `express` must be a boolean, got null\n\t* field `size` must be a string, got null\n\n",
+		},
+		{
+			name:         "coerced null optional arguments",
+			tool:         orderTool,
+			coerce:       true,
+			args:         `{"items": [], "note": null, "express": null}`,
+			expectedArgs: `{"items": [], "note": null}`,
+		},
+		{
+			name:         "tool with fuzzy schema and numeric argument",
+			tool:         &mockTool{name: "search", argsSchema: `{"query": "search query", "limit": "max number of results"}`},
+			args:         `{"query": "go", "limit": 5}`,
+			expectedArgs: `{"query": "go", "limit": 5}`,
+		},
+		{
+			name:         "tool with fuzzy schema and omitted argument",
+			tool:         &mockTool{name: "search", argsSchema: `{"query": "search query", "limit": "max number of results"}`},
+			args:         `{"query": "go"}`,
+			expectedArgs: `{"query": "go"}`,
+		},
+		{
+			name:         "tool with fuzzy schema and coercion",
+			tool:         &mockTool{name: "search", argsSchema: `{"query": "search query", "limit": "max number of results"}`},
+			coerce:       true,
+			args:         `{"query": 42, "limit": "5"}`,
+			expectedArgs: `{"query": 42, "limit": "5"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			validator := NewArgsValidator()
+			if tc.coerce {
+				validator = validator.WithCoercion()
+			}
+			args, err := ProcessForTool(context.Background(), validator, tc.tool, json.RawMessage(tc.args))
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expectedArgs, string(args))
+		})
+	}
+}
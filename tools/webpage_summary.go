@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -37,8 +38,12 @@ func (*WebpageSummary) stripHTMLTags(s string) string {
 	return text
 }
 
-func (w *WebpageSummary) getStrippedWebpage(url string) (string, error) {
-	resp, err := http.Get(url)
+func (w *WebpageSummary) getStrippedWebpage(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to get webpage: %w", err)
 	}
@@ -53,8 +58,8 @@ func (w *WebpageSummary) getStrippedWebpage(url string) (string, error) {
 	return w.stripHTMLTags(string(body)), nil
 }
 
-func (w *WebpageSummary) summariseContent(url, focusOn string) (string, error) {
-	content, err := w.getStrippedWebpage(url)
+func (w *WebpageSummary) summariseContent(ctx context.Context, url, focusOn string) (string, error) {
+	content, err := w.getStrippedWebpage(ctx, url)
 	if err != nil {
 		return "", fmt.Errorf("failed to get stripped webpage: %w", err)
 	}
@@ -75,7 +80,7 @@ func (w *WebpageSummary) summariseContent(url, focusOn string) (string, error) {
 			},
 		},
 	}
-	summary, err := w.model.Chat(&prompt)
+	summary, err := engines.ChatContext(engines.ContextWithComponent(ctx, engines.ComponentWebpageSummary), w.model, &prompt)
 	if err != nil {
 		return "", fmt.Errorf("failed to predict: %w", err)
 	}
@@ -83,6 +88,10 @@ func (w *WebpageSummary) summariseContent(url, focusOn string) (string, error) {
 }
 
 func (w *WebpageSummary) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return w.ExecuteContext(context.Background(), args)
+}
+
+func (w *WebpageSummary) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var command struct {
 		URL     string `json:"url"`
 		FocusOn string `json:"focus_on"`
@@ -91,7 +100,7 @@ func (w *WebpageSummary) Execute(args json.RawMessage) (json.RawMessage, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal args: %w", err)
 	}
-	summary, err := w.summariseContent(command.URL, command.FocusOn)
+	summary, err := w.summariseContent(ctx, command.URL, command.FocusOn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to summarise content: %w", err)
 	}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -26,8 +27,8 @@ func NewWolframAlphaWithServiceURL(serviceURL, appID string) *WolframAlpha {
 	}
 }
 
-func (wa *WolframAlpha) shortAnswer(query string) (answer string, err error) {
-	req, err := http.NewRequest("GET", wa.ServiceURL, nil)
+func (wa *WolframAlpha) shortAnswer(ctx context.Context, query string) (answer string, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", wa.ServiceURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -52,6 +53,10 @@ func (wa *WolframAlpha) shortAnswer(query string) (answer string, err error) {
 }
 
 func (wa *WolframAlpha) Execute(args json.RawMessage) (json.RawMessage, error) {
+	return wa.ExecuteContext(context.Background(), args)
+}
+
+func (wa *WolframAlpha) ExecuteContext(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var query struct {
 		Query string `json:"query"`
 	}
@@ -59,7 +64,7 @@ func (wa *WolframAlpha) Execute(args json.RawMessage) (json.RawMessage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal args: %w", err)
 	}
-	answer, err := wa.shortAnswer(query.Query)
+	answer, err := wa.shortAnswer(ctx, query.Query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query WolframAlpha: %w", err)
 	}